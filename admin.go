@@ -0,0 +1,29 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gemini requests made since the process started, for /admin/stats
+var geminiCalls atomic.Int64
+
+var processStarted = time.Now()
+
+// adminAuth only lets requests through with "Authorization: Bearer <key>",
+// where key is ADMIN_API_KEY
+func adminAuth(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(key)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "admin API key required"})
+			return
+		}
+		c.Next()
+	}
+}
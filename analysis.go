@@ -0,0 +1,775 @@
+package main
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"terrahack2025-backend/database"
+)
+
+// analysisData holds every record the analysis endpoints work from
+type analysisData struct {
+	Sleep     []database.Sleep
+	Diet      []database.Diet
+	Menstrual []database.Menstrual
+	Symptoms  []database.Symptom
+	Journal   []database.Journal
+
+	CustomFactors []database.CustomFactor
+}
+
+func loadAnalysisData(ctx context.Context, queries *database.Queries) (analysisData, error) {
+	var data analysisData
+	var err error
+	if data.Sleep, err = queries.GetAllSleep(ctx); err != nil {
+		return data, err
+	}
+	if data.Diet, err = queries.GetAllDiet(ctx); err != nil {
+		return data, err
+	}
+	if data.Menstrual, err = queries.GetAllMenstrual(ctx); err != nil {
+		return data, err
+	}
+	if data.Symptoms, err = queries.GetAllSymptoms(ctx); err != nil {
+		return data, err
+	}
+	if data.Journal, err = queries.GetAllJournal(ctx); err != nil {
+		return data, err
+	}
+	if data.CustomFactors, err = queries.GetAllCustomFactors(ctx); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
+// fromSources keeps only the records logged through one of sources, or
+// everything when sources is empty. Journal notes and custom factors have
+// no source and are always kept.
+func (data analysisData) fromSources(sources []string) analysisData {
+	if len(sources) == 0 {
+		return data
+	}
+	data.Sleep = withSource(data.Sleep, sources, func(r database.Sleep) string { return r.Source })
+	data.Diet = withSource(data.Diet, sources, func(r database.Diet) string { return r.Source })
+	data.Menstrual = withSource(data.Menstrual, sources, func(r database.Menstrual) string { return r.Source })
+	data.Symptoms = withSource(data.Symptoms, sources, func(r database.Symptom) string { return r.Source })
+	return data
+}
+
+// withSource keeps the rows logged through one of sources, all of them when
+// sources is empty
+func withSource[T any](rows []T, sources []string, source func(T) string) []T {
+	if len(sources) == 0 {
+		return rows
+	}
+	var kept []T
+	for _, r := range rows {
+		if slices.Contains(sources, source(r)) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// dailyData indexes the non-symptom records by "2006-01-02" date
+type dailyData struct {
+	Sleep     map[string]database.Sleep
+	Diet      map[string][]database.Diet
+	Menstrual map[string]database.Menstrual
+	// Custom holds the names of the custom factors marked present
+	Custom map[string][]string
+	// SleepTrigger is which sleep measure counts as low sleep, defaulting
+	// to duration when empty
+	SleepTrigger string
+}
+
+func indexByDate(data analysisData) dailyData {
+	d := dailyData{
+		Sleep:     map[string]database.Sleep{},
+		Diet:      map[string][]database.Diet{},
+		Menstrual: map[string]database.Menstrual{},
+		Custom:    map[string][]string{},
+	}
+	for _, s := range data.Sleep {
+		d.Sleep[s.Date.Time.Format("2006-01-02")] = s
+	}
+	for _, diet := range data.Diet {
+		date := diet.Date.Time.Format("2006-01-02")
+		d.Diet[date] = append(d.Diet[date], diet)
+	}
+	for _, m := range data.Menstrual {
+		d.Menstrual[m.Date.Time.Format("2006-01-02")] = m
+	}
+	for _, f := range data.CustomFactors {
+		if f.Present {
+			date := f.Date.Time.Format("2006-01-02")
+			d.Custom[date] = append(d.Custom[date], f.FactorName)
+		}
+	}
+	return d
+}
+
+// Sleep shorter than this many hours, or with sleep_trigger=quality rated
+// below this quality, counts as a low-sleep trigger
+const (
+	lowSleepHours   = 6
+	lowSleepQuality = 5
+)
+
+// lowSleep reports whether a night counts as the low-sleep trigger. With
+// "both" either a short or a poor night is enough.
+func (d dailyData) lowSleep(s database.Sleep) bool {
+	short := s.Duration.Float64 < lowSleepHours
+	poor := s.Quality.Valid && s.Quality.Int32 < lowSleepQuality
+	switch d.SleepTrigger {
+	case sleepTriggerQuality:
+		return poor
+	case sleepTriggerBoth:
+		return short || poor
+	default:
+		return short
+	}
+}
+
+// factors returns the trigger factors present on a date, keyed as
+// "low_sleep", "food:<item>", "menstrual_event:<event>", "flow_level:<level>"
+// and "custom:<name>"
+func (d dailyData) factors(date string) map[string]bool {
+	present := map[string]bool{}
+	if sleep, ok := d.Sleep[date]; ok && d.lowSleep(sleep) {
+		present["low_sleep"] = true
+	}
+	for _, diet := range d.Diet[date] {
+		for _, item := range diet.Items {
+			present["food:"+item] = true
+		}
+	}
+	if menstrual, ok := d.Menstrual[date]; ok {
+		present["menstrual_event:"+menstrual.PeriodEvent.String] = true
+		present["flow_level:"+menstrual.FlowLevel.String] = true
+	}
+	for _, name := range d.Custom[date] {
+		present["custom:"+name] = true
+	}
+	return present
+}
+
+type triggerCounts struct {
+	LowSleepHours  int
+	MenstrualEvent map[string]int
+	FlowLevel      map[string]int
+	FoodItems      map[string]int
+	CustomFactors  map[string]int
+}
+
+type triggerDetail struct {
+	Date            string  `json:"date"`
+	TriggerSeverity float64 `json:"trigger_severity"`
+}
+
+type scoredDay struct {
+	Date  time.Time
+	Score float64
+}
+
+// symptomScore combines a symptom entry's logged components into one
+// severity: their average by default, or the worst component with aggregate
+// "max". Components left out of a partial entry are null and ignored rather
+// than counted as 0. It returns false when no component was logged.
+func symptomScore(sym database.Symptom, aggregate string) (float64, bool) {
+	var total, worst float64
+	var n int
+	for _, v := range []pgtype.Int4{sym.Nausea, sym.Fatigue, sym.Pain} {
+		if !v.Valid {
+			continue
+		}
+		total += float64(v.Int32)
+		worst = max(worst, float64(v.Int32))
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+	if aggregate == aggregateMax {
+		return worst, true
+	}
+	return total / float64(n), true
+}
+
+// scoreSymptomDays scores every symptom entry and combines entries logged on
+// the same date (e.g. morning and evening) into one day, sorted by date. The
+// day takes the entries' mean score, or their highest under aggregate=max so
+// a bad evening isn't diluted by a mild morning. This matches
+// GetDailySymptomAverages.
+func scoreSymptomDays(symptoms []database.Symptom, aggregate string) []scoredDay {
+	totals := map[time.Time]float64{}
+	counts := map[time.Time]int{}
+	for _, sym := range symptoms {
+		score, ok := symptomScore(sym, aggregate)
+		if !ok {
+			continue
+		}
+		date := sym.Date.Time
+		if aggregate == aggregateMax && counts[date] > 0 {
+			totals[date] = max(totals[date], score)
+		} else {
+			totals[date] += score
+		}
+		counts[date]++
+	}
+	days := make([]scoredDay, 0, len(totals))
+	for date, total := range totals {
+		if aggregate != aggregateMax {
+			total /= float64(counts[date])
+		}
+		days = append(days, scoredDay{Date: date, Score: total})
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date.Before(days[j].Date)
+	})
+	return days
+}
+
+// loadDailyScores fetches one score per logged day, aggregated in Postgres,
+// counting only entries logged through sources (all of them when nil). Use
+// it when only the daily score is needed, not the individual components.
+func loadDailyScores(ctx context.Context, queries *database.Queries, aggregate string, sources []string) ([]scoredDay, error) {
+	rows, err := queries.GetDailySymptomAverages(ctx, sources)
+	if err != nil {
+		return nil, err
+	}
+	days := make([]scoredDay, 0, len(rows))
+	for _, row := range rows {
+		score := row.MeanScore
+		if aggregate == aggregateMax {
+			score = row.MaxScore
+		}
+		days = append(days, scoredDay{Date: row.Date.Time, Score: score})
+	}
+	return days, nil
+}
+
+// meanStdDev returns the mean and sample (n-1) standard deviation of the
+// values, the one spread measure the analyses use. Fewer than two values
+// have a standard deviation of 0.
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	if len(values) < 2 {
+		return mean, 0
+	}
+	var squaredDiffSum float64
+	for _, v := range values {
+		squaredDiffSum += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squaredDiffSum / float64(len(values)-1))
+}
+
+// pearson returns the Pearson correlation of paired samples. It reports
+// false when there are fewer than two pairs or either side has no variance.
+func pearson(xs, ys []float64) (float64, bool) {
+	if len(xs) != len(ys) || len(xs) < 2 {
+		return 0, false
+	}
+	meanX, _ := meanStdDev(xs)
+	meanY, _ := meanStdDev(ys)
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(varX*varY), true
+}
+
+// spikeEnrichmentPValue is the one-sided Fisher's exact test for a factor:
+// the chance that, of total days with spikes among them, the present days
+// the factor came before would include at least spikesPresent spikes if the
+// factor made no difference. Small values mean the factor really does come
+// before spikes more than chance.
+func spikeEnrichmentPValue(total, spikes, present, spikesPresent int) float64 {
+	logChoose := func(n, k int) float64 {
+		a, _ := math.Lgamma(float64(n + 1))
+		b, _ := math.Lgamma(float64(k + 1))
+		c, _ := math.Lgamma(float64(n - k + 1))
+		return a - b - c
+	}
+	denominator := logChoose(total, present)
+	var p float64
+	for k := spikesPresent; k <= min(spikes, present); k++ {
+		if present-k > total-spikes {
+			continue
+		}
+		p += math.Exp(logChoose(spikes, k) + logChoose(total-spikes, present-k) - denominator)
+	}
+	return min(p, 1)
+}
+
+// dailySeverity averages the scores of all entries logged on each date
+func dailySeverity(days []scoredDay) map[string]float64 {
+	totals := map[string]float64{}
+	counts := map[string]int{}
+	for _, d := range days {
+		date := d.Date.Format("2006-01-02")
+		totals[date] += d.Score
+		counts[date]++
+	}
+	for date := range totals {
+		totals[date] /= float64(counts[date])
+	}
+	return totals
+}
+
+// daysBetween returns the number of calendar days from a to b
+func daysBetween(a, b time.Time) int {
+	return int(math.Round(b.Sub(a).Hours() / 24))
+}
+
+type flareEpisode struct {
+	Start        string  `json:"start"`
+	End          string  `json:"end"`
+	DurationDays int     `json:"duration_days"`
+	PeakSeverity float64 `json:"peak_severity"`
+}
+
+// findFlareEpisodes groups above-threshold days into episodes. Two flare days
+// belong to the same episode when at most maxGap days separate them.
+func findFlareEpisodes(days []scoredDay, threshold float64, maxGap int) []flareEpisode {
+	var episodes []flareEpisode
+	var start, end time.Time
+	var peak float64
+	inEpisode := false
+
+	closeEpisode := func() {
+		episodes = append(episodes, flareEpisode{
+			Start:        start.Format("2006-01-02"),
+			End:          end.Format("2006-01-02"),
+			DurationDays: daysBetween(start, end) + 1,
+			PeakSeverity: peak,
+		})
+	}
+
+	for _, d := range days {
+		if d.Score <= threshold {
+			continue
+		}
+		if inEpisode && daysBetween(end, d.Date) <= maxGap+1 {
+			end = d.Date
+			peak = math.Max(peak, d.Score)
+			continue
+		}
+		if inEpisode {
+			closeEpisode()
+		}
+		start, end, peak = d.Date, d.Date, d.Score
+		inEpisode = true
+	}
+	if inEpisode {
+		closeEpisode()
+	}
+	return episodes
+}
+
+type symptomFreeStreak struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Logged days in the streak, unlogged days tolerated by maxGap don't count
+	Days int `json:"days"`
+}
+
+// findSymptomFreeStreaks is the inverse of findFlareEpisodes: runs of days
+// at or below threshold. A flare day ends a streak, and so does a logging
+// gap of more than maxGap days. current is the streak running through the
+// latest scored day, nil when that day was a flare day.
+func findSymptomFreeStreaks(days []scoredDay, threshold float64, maxGap int) (current, longest *symptomFreeStreak) {
+	var run *symptomFreeStreak
+	var end time.Time
+	for _, d := range days {
+		if d.Score > threshold {
+			run = nil
+			continue
+		}
+		if run == nil || daysBetween(end, d.Date) > maxGap+1 {
+			run = &symptomFreeStreak{Start: d.Date.Format("2006-01-02")}
+		}
+		end = d.Date
+		run.End = end.Format("2006-01-02")
+		run.Days++
+		if longest == nil || run.Days > longest.Days {
+			best := *run
+			longest = &best
+		}
+	}
+	return run, longest
+}
+
+// Entries older than this make analysis responses carry a stale-data warning
+const staleDataDays = 14
+
+// dataFreshness reports how many days old the most recent entry across all
+// domains is relative to today, and whether that exceeds staleDataDays. With
+// no data at all the age is -1 and the data is considered stale.
+func dataFreshness(today time.Time, sleep []database.Sleep, diet []database.Diet, menstrual []database.Menstrual, symptoms []database.Symptom) (int, bool) {
+	var latest time.Time
+	track := func(d time.Time) {
+		if d.After(latest) {
+			latest = d
+		}
+	}
+	for _, s := range sleep {
+		track(s.Date.Time)
+	}
+	for _, d := range diet {
+		track(d.Date.Time)
+	}
+	for _, m := range menstrual {
+		track(m.Date.Time)
+	}
+	for _, s := range symptoms {
+		track(s.Date.Time)
+	}
+	if latest.IsZero() {
+		return -1, true
+	}
+
+	age := daysBetween(latest, today)
+	return age, age > staleDataDays
+}
+
+// diffThreshold is the mean day-over-day change plus one standard
+// deviation, using the same sample (n-1) standard deviation as meanStdDev so
+// every spread in the analysis is measured alike. With no diffs (a single
+// symptom day) it is 0; one diff has no spread, so its threshold equals the
+// diff itself and it is not a spike.
+func diffThreshold(diffs []float64) float64 {
+	mean, stdDev := meanStdDev(diffs)
+	return mean + stdDev
+}
+
+// rollingThreshold computes the spike threshold for day i from only the diffs
+// of the preceding window days, so "spike" is relative to recent normal.
+// diffs[k-1] is the change into day k. Falls back to the global threshold
+// when the window holds fewer than two diffs.
+func rollingThreshold(days []scoredDay, diffs []float64, i, window int, global float64) float64 {
+	windowStart := days[i].Date.AddDate(0, 0, -window)
+	var recent []float64
+	for k := 1; k < i; k++ {
+		if !days[k].Date.Before(windowStart) && days[k].Date.Before(days[i].Date) {
+			recent = append(recent, diffs[k-1])
+		}
+	}
+	if len(recent) < 2 {
+		return global
+	}
+	return diffThreshold(recent)
+}
+
+// triggerAnalysis is the spike detection and day-before trigger attribution
+// shared by /find_triggers, /predict_flareups and /recommendations
+type triggerAnalysis struct {
+	Mean       float64
+	StdDev     float64
+	Threshold  float64
+	ScoredDays []scoredDay
+	SpikeDays  map[string]float64 // date => symptom severity
+	ByDate     dailyData
+
+	// The embedded set holds triggers logged the day before each spike.
+	// SameDay holds those logged on the spike day itself and is only set
+	// with the include_same_day option.
+	triggerSet
+	SameDay *triggerSet
+
+	RecencyHalfLife float64
+}
+
+// triggerSet counts the factors logged at a fixed offset from spike days
+type triggerSet struct {
+	Triggers              triggerCounts
+	LowSleepDetails       []triggerDetail
+	FoodItemDetails       map[string][]triggerDetail
+	MenstrualEventDetails map[string][]triggerDetail
+	FlowLevelDetails      map[string][]triggerDetail
+	CustomFactorDetails   map[string][]triggerDetail
+}
+
+// collectTriggers counts the factors logged offsetDays from each spike day
+// (-1 for the day before, 0 for the same day)
+func collectTriggers(byDate dailyData, spikeDays map[string]float64, offsetDays int) triggerSet {
+	t := triggerSet{
+		Triggers: triggerCounts{
+			MenstrualEvent: make(map[string]int),
+			FlowLevel:      make(map[string]int),
+			FoodItems:      make(map[string]int),
+			CustomFactors:  make(map[string]int),
+		},
+		FoodItemDetails:       map[string][]triggerDetail{},
+		MenstrualEventDetails: map[string][]triggerDetail{},
+		FlowLevelDetails:      map[string][]triggerDetail{},
+		CustomFactorDetails:   map[string][]triggerDetail{},
+	}
+
+	for spikeDateStr, severity := range spikeDays {
+		spikeDate, _ := time.Parse("2006-01-02", spikeDateStr)
+		day := spikeDate.AddDate(0, 0, offsetDays).Format("2006-01-02")
+		detail := triggerDetail{Date: day, TriggerSeverity: severity}
+
+		if sleep, ok := byDate.Sleep[day]; ok {
+			if byDate.lowSleep(sleep) {
+				t.Triggers.LowSleepHours++
+				t.LowSleepDetails = append(t.LowSleepDetails, detail)
+			}
+		}
+
+		if diets, ok := byDate.Diet[day]; ok {
+			for _, d := range diets {
+				for _, item := range d.Items {
+					t.Triggers.FoodItems[item]++
+					t.FoodItemDetails[item] = append(t.FoodItemDetails[item], detail)
+				}
+			}
+		}
+
+		if menstrual, ok := byDate.Menstrual[day]; ok {
+			t.Triggers.MenstrualEvent[menstrual.PeriodEvent.String]++
+			t.MenstrualEventDetails[menstrual.PeriodEvent.String] = append(t.MenstrualEventDetails[menstrual.PeriodEvent.String], detail)
+
+			t.Triggers.FlowLevel[menstrual.FlowLevel.String]++
+			t.FlowLevelDetails[menstrual.FlowLevel.String] = append(t.FlowLevelDetails[menstrual.FlowLevel.String], detail)
+		}
+
+		for _, name := range byDate.Custom[day] {
+			t.Triggers.CustomFactors[name]++
+			t.CustomFactorDetails[name] = append(t.CustomFactorDetails[name], detail)
+		}
+	}
+	return t
+}
+
+// dropRare removes the food items, menstrual events and flow levels logged
+// before fewer than min distinct spikes, returning how many were removed.
+// Counts can't be used, an item eaten at two meals before one spike is
+// counted twice.
+func (t *triggerSet) dropRare(min int) int {
+	dropped := 0
+	for _, s := range []struct {
+		counts  map[string]int
+		details map[string][]triggerDetail
+	}{
+		{t.Triggers.FoodItems, t.FoodItemDetails},
+		{t.Triggers.MenstrualEvent, t.MenstrualEventDetails},
+		{t.Triggers.FlowLevel, t.FlowLevelDetails},
+	} {
+		for name := range s.counts {
+			spikes := map[string]bool{}
+			for _, d := range s.details[name] {
+				spikes[d.Date] = true
+			}
+			if len(spikes) < min {
+				delete(s.counts, name)
+				delete(s.details, name)
+				dropped++
+			}
+		}
+	}
+	return dropped
+}
+
+// analyzeTriggers finds symptom spikes (day-over-day jumps above the mean
+// jump plus one standard deviation) and counts the triggers logged on the
+// day before each spike. Callers must check there is symptom data first.
+func analyzeTriggers(data analysisData, opts analysisOptions) triggerAnalysis {
+	data = data.fromSources(opts.Sources)
+	a := triggerAnalysis{ByDate: indexByDate(data), RecencyHalfLife: opts.RecencyHalfLife}
+	a.ByDate.SleepTrigger = opts.SleepTrigger
+
+	// Calculate mean and std dev of symptom severity
+	a.ScoredDays = scoreSymptomDays(data.Symptoms, opts.Aggregate)
+	var scores []float64
+	for _, d := range a.ScoredDays {
+		scores = append(scores, d.Score)
+	}
+	a.Mean, a.StdDev = meanStdDev(scores)
+
+	// Calculate spike threshold based on symptom score differences
+	var diffs []float64
+	for i := 1; i < len(a.ScoredDays); i++ {
+		diffs = append(diffs, a.ScoredDays[i].Score-a.ScoredDays[i-1].Score)
+	}
+	a.Threshold = opts.floorThreshold(diffThreshold(diffs))
+
+	// Find spike days based on diff threshold and the minimum severity, keep
+	// symptom severity for spike day
+	a.SpikeDays = make(map[string]float64)
+	for i := 1; i < len(a.ScoredDays); i++ {
+		threshold := a.Threshold
+		if opts.Baseline == baselineRolling {
+			threshold = opts.floorThreshold(rollingThreshold(a.ScoredDays, diffs, i, opts.BaselineWindow, a.Threshold))
+		}
+		if diffs[i-1] > threshold && a.ScoredDays[i].Score >= opts.MinSpikeSeverity {
+			a.SpikeDays[a.ScoredDays[i].Date.Format("2006-01-02")] = a.ScoredDays[i].Score
+		}
+	}
+
+	// Check triggers on the day before spike days
+	a.triggerSet = collectTriggers(a.ByDate, a.SpikeDays, -1)
+	if opts.IncludeSameDay {
+		sameDay := collectTriggers(a.ByDate, a.SpikeDays, 0)
+		a.SameDay = &sameDay
+	}
+
+	return a
+}
+
+type factorLift struct {
+	DaysPresent int     // candidate days with the factor logged the day before
+	Spikes      int     // of those, how many were spikes
+	Lift        float64 // P(spike | factor the day before) / P(spike)
+}
+
+// lifts normalizes each trigger by its base rate. Every scored day after the
+// first could have been a spike; the base rate is the share that were, and a
+// factor's lift is the spike rate on days following it divided by that base
+// rate. A lift above 1 means spikes are more likely after the factor.
+func (a triggerAnalysis) lifts() (float64, map[string]factorLift) {
+	candidates := map[string]bool{}
+	for i := 1; i < len(a.ScoredDays); i++ {
+		candidates[a.ScoredDays[i].Date.Format("2006-01-02")] = true
+	}
+
+	lifts := map[string]factorLift{}
+	if len(candidates) == 0 {
+		return 0, lifts
+	}
+	baseRate := float64(len(a.SpikeDays)) / float64(len(candidates))
+
+	for date := range candidates {
+		d, _ := time.Parse("2006-01-02", date)
+		_, spike := a.SpikeDays[date]
+		for factor := range a.ByDate.factors(d.AddDate(0, 0, -1).Format("2006-01-02")) {
+			l := lifts[factor]
+			l.DaysPresent++
+			if spike {
+				l.Spikes++
+			}
+			lifts[factor] = l
+		}
+	}
+
+	for factor, l := range lifts {
+		if baseRate > 0 {
+			l.Lift = (float64(l.Spikes) / float64(l.DaysPresent)) / baseRate
+		}
+		lifts[factor] = l
+	}
+	return baseRate, lifts
+}
+
+// weightedCounts sums each trigger's occurrences decayed by age, keyed like
+// lifts. An occurrence RecencyHalfLife days before the latest scored day
+// counts half. Without decay every weight is 1 and these equal the counts.
+func (a triggerAnalysis) weightedCounts() map[string]float64 {
+	var latest time.Time
+	if len(a.ScoredDays) > 0 {
+		latest = a.ScoredDays[len(a.ScoredDays)-1].Date
+	}
+	sum := func(details []triggerDetail) float64 {
+		var total float64
+		for _, d := range details {
+			if a.RecencyHalfLife <= 0 {
+				total++
+				continue
+			}
+			date, _ := time.Parse("2006-01-02", d.Date)
+			total += math.Pow(0.5, float64(daysBetween(date, latest))/a.RecencyHalfLife)
+		}
+		return total
+	}
+
+	weighted := map[string]float64{"low_sleep": sum(a.LowSleepDetails)}
+	for item, details := range a.FoodItemDetails {
+		weighted["food:"+item] = sum(details)
+	}
+	for event, details := range a.MenstrualEventDetails {
+		weighted["menstrual_event:"+event] = sum(details)
+	}
+	for level, details := range a.FlowLevelDetails {
+		weighted["flow_level:"+level] = sum(details)
+	}
+	for name, details := range a.CustomFactorDetails {
+		weighted["custom:"+name] = sum(details)
+	}
+	return weighted
+}
+
+type rankedTrigger struct {
+	Type          string  `json:"type"` // low_sleep, food, menstrual_event, flow_level or custom
+	Name          string  `json:"name"`
+	Count         int     `json:"count"`
+	WeightedCount float64 `json:"weighted_count,omitempty"`
+	Lift          float64 `json:"lift"`
+}
+
+// rankTriggers flattens the trigger counts into one list ordered by how many
+// spikes each preceded (recency-weighted when decay is on), then by lift,
+// then by name
+func (a triggerAnalysis) rankTriggers() []rankedTrigger {
+	_, lifts := a.lifts()
+	var ranked []rankedTrigger
+	if a.Triggers.LowSleepHours > 0 {
+		ranked = append(ranked, rankedTrigger{Type: "low_sleep", Name: "low sleep hours", Count: a.Triggers.LowSleepHours, Lift: lifts["low_sleep"].Lift})
+	}
+	for item, n := range a.Triggers.FoodItems {
+		ranked = append(ranked, rankedTrigger{Type: "food", Name: item, Count: n, Lift: lifts["food:"+item].Lift})
+	}
+	for event, n := range a.Triggers.MenstrualEvent {
+		ranked = append(ranked, rankedTrigger{Type: "menstrual_event", Name: event, Count: n, Lift: lifts["menstrual_event:"+event].Lift})
+	}
+	for level, n := range a.Triggers.FlowLevel {
+		ranked = append(ranked, rankedTrigger{Type: "flow_level", Name: level, Count: n, Lift: lifts["flow_level:"+level].Lift})
+	}
+	for name, n := range a.Triggers.CustomFactors {
+		ranked = append(ranked, rankedTrigger{Type: "custom", Name: name, Count: n, Lift: lifts["custom:"+name].Lift})
+	}
+	if a.RecencyHalfLife > 0 {
+		weighted := a.weightedCounts()
+		for i := range ranked {
+			key := ranked[i].Type + ":" + ranked[i].Name
+			if ranked[i].Type == "low_sleep" {
+				key = "low_sleep"
+			}
+			ranked[i].WeightedCount = weighted[key]
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].WeightedCount != ranked[j].WeightedCount {
+			return ranked[i].WeightedCount > ranked[j].WeightedCount
+		}
+		if ranked[i].Count != ranked[j].Count {
+			return ranked[i].Count > ranked[j].Count
+		}
+		if ranked[i].Lift != ranked[j].Lift {
+			return ranked[i].Lift > ranked[j].Lift
+		}
+		return ranked[i].Type+ranked[i].Name < ranked[j].Type+ranked[j].Name
+	})
+	return ranked
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"terrahack2025-backend/database"
+)
+
+func TestDropRare(t *testing.T) {
+	detail := func(dates ...string) []triggerDetail {
+		var details []triggerDetail
+		for _, d := range dates {
+			details = append(details, triggerDetail{Date: d})
+		}
+		return details
+	}
+	set := triggerSet{
+		Triggers: triggerCounts{
+			// Eaten at two meals before the same spike
+			FoodItems:      map[string]int{"coffee": 2, "rice": 2, "bread": 1},
+			MenstrualEvent: map[string]int{"start": 1},
+			FlowLevel:      map[string]int{"heavy": 2},
+		},
+		FoodItemDetails: map[string][]triggerDetail{
+			"coffee": detail("2025-07-01", "2025-07-01"),
+			"rice":   detail("2025-07-01", "2025-07-05"),
+			"bread":  detail("2025-07-05"),
+		},
+		MenstrualEventDetails: map[string][]triggerDetail{"start": detail("2025-07-01")},
+		FlowLevelDetails:      map[string][]triggerDetail{"heavy": detail("2025-07-01", "2025-07-05")},
+	}
+
+	if dropped := set.dropRare(2); dropped != 3 {
+		t.Errorf("dropped %d triggers, want 3", dropped)
+	}
+	for _, item := range []string{"coffee", "bread"} {
+		if _, ok := set.Triggers.FoodItems[item]; ok {
+			t.Errorf("%s was seen before one spike and should be dropped", item)
+		}
+		if _, ok := set.FoodItemDetails[item]; ok {
+			t.Errorf("%s details should be dropped with its count", item)
+		}
+	}
+	if _, ok := set.Triggers.FoodItems["rice"]; !ok {
+		t.Error("rice was seen before two spikes and should be kept")
+	}
+	if _, ok := set.Triggers.MenstrualEvent["start"]; ok {
+		t.Error("menstrual event start should be dropped")
+	}
+	if _, ok := set.Triggers.FlowLevel["heavy"]; !ok {
+		t.Error("flow level heavy should be kept")
+	}
+}
+
+func TestDropRareDefaultKeepsEverything(t *testing.T) {
+	set := triggerSet{
+		Triggers: triggerCounts{
+			FoodItems:      map[string]int{"bread": 1},
+			MenstrualEvent: map[string]int{},
+			FlowLevel:      map[string]int{},
+		},
+		FoodItemDetails: map[string][]triggerDetail{"bread": {{Date: "2025-07-05"}}},
+	}
+	if dropped := set.dropRare(1); dropped != 0 || len(set.Triggers.FoodItems) != 1 {
+		t.Errorf("min_occurrences=1 dropped %d triggers, want none", dropped)
+	}
+}
+
+func TestSymptomScoreSkipsNullComponents(t *testing.T) {
+	tests := []struct {
+		name     string
+		sym      database.Symptom
+		wantMean float64
+		wantMax  float64
+		wantOK   bool
+	}{
+		{"all logged", testSymptom("2025-07-19", 2, 4, 9), 5, 9, true},
+		{"pain only", testSymptom("2025-07-19", -1, -1, 6), 6, 6, true},
+		// A null is left out, so 4 and 8 average to 6 rather than 4
+		{"nausea missing", testSymptom("2025-07-19", -1, 4, 8), 6, 8, true},
+		// A logged 0 still counts
+		{"zero logged", testSymptom("2025-07-19", 0, -1, 6), 3, 6, true},
+		{"nothing logged", testSymptom("2025-07-19", -1, -1, -1), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, ok := symptomScore(tt.sym, aggregateMean)
+			if ok != tt.wantOK || math.Abs(mean-tt.wantMean) > 1e-9 {
+				t.Errorf("mean score = %v, %v, want %v, %v", mean, ok, tt.wantMean, tt.wantOK)
+			}
+			worst, ok := symptomScore(tt.sym, aggregateMax)
+			if ok != tt.wantOK || worst != tt.wantMax {
+				t.Errorf("max score = %v, %v, want %v, %v", worst, ok, tt.wantMax, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestScoreSymptomDays(t *testing.T) {
+	symptoms := []database.Symptom{
+		testSymptom("2025-07-20", 2, 2, 2),
+		// Morning and evening entries on the same day
+		testSymptom("2025-07-19", 1, 2, 3),
+		testSymptom("2025-07-19", 0, 0, 9),
+		// Nothing logged, so it doesn't make the day count
+		testSymptom("2025-07-21", -1, -1, -1),
+	}
+	tests := []struct {
+		aggregate string
+		want      map[string]float64
+	}{
+		// Entry scores 2 and 3 average to 2.5
+		{aggregateMean, map[string]float64{"2025-07-19": 2.5, "2025-07-20": 2}},
+		// Entry scores 3 and 9 combine to the worse one
+		{aggregateMax, map[string]float64{"2025-07-19": 9, "2025-07-20": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.aggregate, func(t *testing.T) {
+			days := scoreSymptomDays(symptoms, tt.aggregate)
+			if len(days) != len(tt.want) {
+				t.Fatalf("got %d days, want %d", len(days), len(tt.want))
+			}
+			for i, d := range days {
+				date := d.Date.Format("2006-01-02")
+				if i > 0 && !days[i-1].Date.Before(d.Date) {
+					t.Errorf("days not sorted by date at %s", date)
+				}
+				if want := tt.want[date]; math.Abs(d.Score-want) > 1e-9 {
+					t.Errorf("%s scored %v, want %v", date, d.Score, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeTriggersFewSymptomDays(t *testing.T) {
+	tests := []struct {
+		name     string
+		symptoms []database.Symptom
+	}{
+		{"one day", []database.Symptom{testSymptom("2025-07-01", 2, 2, 2)}},
+		// The single diff has no spread, so it equals the threshold
+		{"two days", []database.Symptom{testSymptom("2025-07-01", 1, 1, 1), testSymptom("2025-07-02", 9, 9, 9)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := analyzeTriggers(analysisData{Symptoms: tt.symptoms}, defaultAnalysisOptions())
+			if math.IsNaN(a.Threshold) || math.IsInf(a.Threshold, 0) {
+				t.Errorf("threshold = %v, want a finite number", a.Threshold)
+			}
+			if math.IsNaN(a.StdDev) {
+				t.Errorf("standard deviation = %v, want a number", a.StdDev)
+			}
+			if len(a.SpikeDays) != 0 {
+				t.Errorf("spike days %v, want none", a.SpikeDays)
+			}
+		})
+	}
+}
+
+func TestDiffThresholdUsesSampleStdDev(t *testing.T) {
+	// Mean 0 and squared deviations summing to 2 over 7 diffs: the sample
+	// deviation is sqrt(2/6), where the population one would be sqrt(2/7)
+	diffs := []float64{0, 0, 0, 1, -1, 0, 0}
+	if got, want := diffThreshold(diffs), math.Sqrt(2.0/6); math.Abs(got-want) > 1e-9 {
+		t.Errorf("diffThreshold() = %v, want %v", got, want)
+	}
+
+	// Behavior change: scores 0, 0, 1, 3, 0 have diffs 0, 1, 2, -3 and a
+	// threshold of sqrt(14/3) = 2.16, so the jump of 2 into 2025-07-04 is
+	// no longer the spike it was against the population threshold of
+	// sqrt(14/4) = 1.87
+	var symptoms []database.Symptom
+	for i, score := range []int32{0, 0, 1, 3, 0} {
+		symptoms = append(symptoms, testSymptom(time.Date(2025, 7, 1+i, 0, 0, 0, 0, time.UTC).Format("2006-01-02"), score, score, score))
+	}
+	a := analyzeTriggers(analysisData{Symptoms: symptoms}, defaultAnalysisOptions())
+	if math.Abs(a.Threshold-math.Sqrt(14.0/3)) > 1e-9 {
+		t.Errorf("threshold = %v, want sqrt(14/3)", a.Threshold)
+	}
+	if len(a.SpikeDays) != 0 {
+		t.Errorf("spike days %v, want none under the sample threshold", a.SpikeDays)
+	}
+}
+
+func TestMinSpikeSeverity(t *testing.T) {
+	// A steady 1.0 with one jump to 2.0 on 2025-07-05. The diffs have mean 0
+	// and standard deviation about 0.58, so the jump of 1 clears the threshold.
+	data := analysisData{Symptoms: []database.Symptom{
+		testSymptom("2025-07-01", 1, 1, 1),
+		testSymptom("2025-07-02", 1, 1, 1),
+		testSymptom("2025-07-03", 1, 1, 1),
+		testSymptom("2025-07-04", 1, 1, 1),
+		testSymptom("2025-07-05", 2, 2, 2),
+		testSymptom("2025-07-06", 1, 1, 1),
+		testSymptom("2025-07-07", 1, 1, 1),
+	}}
+	tests := []struct {
+		name        string
+		minSeverity float64
+		wantSpike   bool
+	}{
+		{"default counts any jump", 0, true},
+		{"at the spike score", 2, true},
+		{"gate above the spike score", 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := defaultAnalysisOptions()
+			opts.MinSpikeSeverity = tt.minSeverity
+			a := analyzeTriggers(data, opts)
+			severity, spike := a.SpikeDays["2025-07-05"]
+			if spike != tt.wantSpike {
+				t.Fatalf("min_spike_severity %v: spike days %v, want spike on 2025-07-05 %v", tt.minSeverity, a.SpikeDays, tt.wantSpike)
+			}
+			if spike && severity != 2 {
+				t.Errorf("spike severity = %v, want 2", severity)
+			}
+			if len(a.SpikeDays) > 1 {
+				t.Errorf("spike days %v, want only 2025-07-05", a.SpikeDays)
+			}
+		})
+	}
+}
+
+// weeklyAveragesInGo is the Go-side alternative to GetWeeklySymptomAverages:
+// load every entry, score the days, then bucket them into Monday weeks
+func weeklyAveragesInGo(ctx context.Context, queries *database.Queries, aggregate string) (map[time.Time]float64, error) {
+	symptoms, err := queries.GetAllSymptoms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	totals := map[time.Time]float64{}
+	counts := map[time.Time]int{}
+	for _, d := range scoreSymptomDays(symptoms, aggregate) {
+		week := d.Date.AddDate(0, 0, -(int(d.Date.Weekday())+6)%7)
+		totals[week] += d.Score
+		counts[week]++
+	}
+	for week := range totals {
+		totals[week] /= float64(counts[week])
+	}
+	return totals, nil
+}
+
+// benchmarkQueries connects to TEST_DATABASE_URL, which should hold a
+// realistic amount of symptom history, skipping the benchmark without it
+func benchmarkQueries(b *testing.B) *database.Queries {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		b.Skip("set TEST_DATABASE_URL to run the weekly summary benchmarks")
+	}
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(pool.Close)
+	return database.New(pool)
+}
+
+func BenchmarkWeeklySummarySQL(b *testing.B) {
+	queries := benchmarkQueries(b)
+	ctx := context.Background()
+
+	// Both approaches have to agree before their speed is worth comparing
+	rows, err := queries.GetWeeklySymptomAverages(ctx, database.GetWeeklySymptomAveragesParams{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, aggregate := range []string{aggregateMean, aggregateMax} {
+		inGo, err := weeklyAveragesInGo(ctx, queries, aggregate)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, row := range rows {
+			got := row.MeanScore
+			if aggregate == aggregateMax {
+				got = row.MaxScore
+			}
+			if want := inGo[row.WeekStart.Time]; math.Abs(got-want) > 1e-9 {
+				b.Fatalf("week of %s: SQL %s %v, Go %s %v", row.WeekStart.Time.Format("2006-01-02"), aggregate, got, aggregate, want)
+			}
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := queries.GetWeeklySymptomAverages(ctx, database.GetWeeklySymptomAveragesParams{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWeeklySummaryGo(b *testing.B) {
+	queries := benchmarkQueries(b)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		if _, err := weeklyAveragesInGo(ctx, queries, aggregateMean); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// testSymptom is a symptom entry on date with nausea, fatigue and pain in
+// that order, a negative value leaving the component null
+func testSymptom(date string, components ...int32) database.Symptom {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		panic(err)
+	}
+	s := database.Symptom{Date: pgtype.Date{Time: d, Valid: true}, Source: sourceManual}
+	fields := []*pgtype.Int4{&s.Nausea, &s.Fatigue, &s.Pain}
+	for i, v := range components {
+		if v >= 0 {
+			*fields[i] = pgtype.Int4{Int32: v, Valid: true}
+		}
+	}
+	return s
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"terrahack2025-backend/database"
+)
+
+// Below this many values the quartiles are too unstable to flag outliers
+const minAnomalySamples = 8
+
+type anomaly struct {
+	Type   string    `json:"type"`
+	ID     int32     `json:"id"`
+	Date   time.Time `json:"date"`
+	Field  string    `json:"field"`
+	Value  float64   `json:"value"`
+	Reason string    `json:"reason"`
+}
+
+type fieldValue struct {
+	ID    int32
+	Date  time.Time
+	Value float64
+}
+
+// quartiles returns the first and third quartiles of sorted values using
+// linear interpolation between the closest ranks
+func quartiles(sorted []float64) (float64, float64) {
+	at := func(p float64) float64 {
+		pos := p * float64(len(sorted)-1)
+		lo := int(pos)
+		if lo+1 >= len(sorted) {
+			return sorted[lo]
+		}
+		return sorted[lo] + (pos-float64(lo))*(sorted[lo+1]-sorted[lo])
+	}
+	return at(0.25), at(0.75)
+}
+
+// flagField reports values outside [minValid, maxValid] as impossible, and
+// the rest as outliers when they fall beyond 1.5 IQR of the user's own values
+func flagField(recordType, field string, values []fieldValue, minValid, maxValid float64) []anomaly {
+	var anomalies []anomaly
+	var valid []float64
+	for _, v := range values {
+		if v.Value < minValid || v.Value > maxValid {
+			anomalies = append(anomalies, anomaly{
+				Type:   recordType,
+				ID:     v.ID,
+				Date:   v.Date,
+				Field:  field,
+				Value:  v.Value,
+				Reason: fmt.Sprintf("outside the possible range %g to %g", minValid, maxValid),
+			})
+			continue
+		}
+		valid = append(valid, v.Value)
+	}
+
+	if len(valid) < minAnomalySamples {
+		return anomalies
+	}
+	sort.Float64s(valid)
+	q1, q3 := quartiles(valid)
+	iqr := q3 - q1
+	// A constant distribution would flag every differing value
+	if iqr == 0 {
+		return anomalies
+	}
+	low, high := q1-1.5*iqr, q3+1.5*iqr
+	for _, v := range values {
+		if v.Value < minValid || v.Value > maxValid {
+			continue
+		}
+		if v.Value < low || v.Value > high {
+			anomalies = append(anomalies, anomaly{
+				Type:   recordType,
+				ID:     v.ID,
+				Date:   v.Date,
+				Field:  field,
+				Value:  v.Value,
+				Reason: fmt.Sprintf("outlier, your usual range is %.1f to %.1f", low, high),
+			})
+		}
+	}
+	return anomalies
+}
+
+// findAnomalies flags implausible sleep and symptom values in existing data
+func findAnomalies(sleep []database.Sleep, symptoms []database.Symptom) []anomaly {
+	var duration, quality []fieldValue
+	for _, s := range sleep {
+		if s.Duration.Valid {
+			duration = append(duration, fieldValue{s.ID, s.Date.Time, s.Duration.Float64})
+		}
+		if s.Quality.Valid {
+			quality = append(quality, fieldValue{s.ID, s.Date.Time, float64(s.Quality.Int32)})
+		}
+	}
+
+	var nausea, fatigue, pain []fieldValue
+	for _, s := range symptoms {
+		if s.Nausea.Valid {
+			nausea = append(nausea, fieldValue{s.ID, s.Date.Time, float64(s.Nausea.Int32)})
+		}
+		if s.Fatigue.Valid {
+			fatigue = append(fatigue, fieldValue{s.ID, s.Date.Time, float64(s.Fatigue.Int32)})
+		}
+		if s.Pain.Valid {
+			pain = append(pain, fieldValue{s.ID, s.Date.Time, float64(s.Pain.Int32)})
+		}
+	}
+
+	anomalies := []anomaly{}
+	anomalies = append(anomalies, flagField("sleep", "duration", duration, 0, 24)...)
+	anomalies = append(anomalies, flagField("sleep", "quality", quality, 0, 10)...)
+	anomalies = append(anomalies, flagField("symptoms", "nausea", nausea, 0, 10)...)
+	anomalies = append(anomalies, flagField("symptoms", "fatigue", fatigue, 0, 10)...)
+	anomalies = append(anomalies, flagField("symptoms", "pain", pain, 0, 10)...)
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].Date.Before(anomalies[j].Date)
+	})
+	return anomalies
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Share of the pool's connections in use above which analytics requests are
+// shed, overridable with POOL_SATURATION_THRESHOLD
+const defaultPoolSaturationThreshold = 0.9
+
+func poolSaturationThreshold() float64 {
+	v := os.Getenv("POOL_SATURATION_THRESHOLD")
+	if v == "" {
+		return defaultPoolSaturationThreshold
+	}
+	threshold, err := strconv.ParseFloat(v, 64)
+	if err != nil || threshold <= 0 || threshold > 1 {
+		log.Fatalf("Invalid POOL_SATURATION_THRESHOLD %q, expected a number in (0, 1]", v)
+	}
+	return threshold
+}
+
+// poolBackpressure fails a request fast with 503 when the pool is saturated
+// instead of letting it queue for a connection until its context times out.
+// It is only attached to the heavy read-only analytics routes, so writes
+// still get through during a spike.
+func poolBackpressure(pool *pgxpool.Pool, threshold float64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stat := pool.Stat()
+		if float64(stat.AcquiredConns()) >= threshold*float64(stat.MaxConns()) {
+			slog.Warn("shedding request, database pool saturated",
+				"path", c.FullPath(),
+				"acquired", stat.AcquiredConns(),
+				"max", stat.MaxConns(),
+			)
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "server is busy, try again shortly"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func poolMetrics(stat *pgxpool.Stat) gin.H {
+	return gin.H{
+		"acquired_conns":             stat.AcquiredConns(),
+		"idle_conns":                 stat.IdleConns(),
+		"constructing_conns":         stat.ConstructingConns(),
+		"total_conns":                stat.TotalConns(),
+		"max_conns":                  stat.MaxConns(),
+		"acquire_count":              stat.AcquireCount(),
+		"empty_acquire_count":        stat.EmptyAcquireCount(),
+		"canceled_acquire_count":     stat.CanceledAcquireCount(),
+		"acquire_duration_ms":        stat.AcquireDuration().Milliseconds(),
+		"new_conns_count":            stat.NewConnsCount(),
+		"max_lifetime_destroy_count": stat.MaxLifetimeDestroyCount(),
+		"max_idle_destroy_count":     stat.MaxIdleDestroyCount(),
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// Scored days of history before the first backtest point
+	minBacktestHistory = 14
+	// Points a backtest needs before its metrics are reported
+	minBacktestPoints = 10
+	// Only the most recent points are replayed, each reruns the analysis
+	maxBacktestPoints = 365
+	// Flare-up probability, in percent, at which a flare-up counts as predicted
+	backtestFlareupThreshold = 50.0
+)
+
+// flareupBacktest compares /predict_flareups, replayed with only the data
+// logged before each day, against whether the day was a spike
+type flareupBacktest struct {
+	Model          string  `json:"model"`
+	Threshold      float64 `json:"threshold"`
+	Points         int     `json:"points"`
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	TrueNegatives  int     `json:"true_negatives"`
+	// Null without any predicted or actual spikes to divide by
+	Precision *float64 `json:"precision"`
+	Recall    *float64 `json:"recall"`
+	// Days the model couldn't predict, e.g. nothing logged recently
+	Skipped          int  `json:"skipped"`
+	InsufficientData bool `json:"insufficient_data"`
+}
+
+// severityBacktest compares /period_symptom_forecast's expected severity,
+// the mean score on the same cycle day in earlier cycles, with each day's
+// actual score
+type severityBacktest struct {
+	Points int      `json:"points"`
+	MAE    *float64 `json:"mae"`
+	// MAE of always forecasting the mean of every earlier day, the bar the
+	// cycle forecast has to clear to be useful
+	BaselineMAE      *float64 `json:"baseline_mae"`
+	InsufficientData bool     `json:"insufficient_data"`
+}
+
+// backtestStart is the index of the first scored day replayed
+func backtestStart(days []scoredDay) int {
+	return max(minBacktestHistory, len(days)-maxBacktestPoints)
+}
+
+// backtestFlareups replays the flare-up prediction for each day after the
+// warm-up. Spikes are judged with the full history, the prediction only
+// sees the data logged before the day.
+func backtestFlareups(data analysisData, opts analysisOptions, model flareupModel) flareupBacktest {
+	res := flareupBacktest{Model: model.Name(), Threshold: backtestFlareupThreshold}
+	actual := analyzeTriggers(data, opts)
+	for i := backtestStart(actual.ScoredDays); i < len(actual.ScoredDays); i++ {
+		date := actual.ScoredDays[i].Date
+		past := data.inRange(dateRange{To: date})
+		p := predictFlareups(past, analyzeTriggers(past, opts), model)
+		if p.Requirement != "" {
+			res.Skipped++
+			continue
+		}
+		res.Points++
+		predicted := p.Probability >= backtestFlareupThreshold
+		_, spike := actual.SpikeDays[date.Format("2006-01-02")]
+		switch {
+		case predicted && spike:
+			res.TruePositives++
+		case predicted:
+			res.FalsePositives++
+		case spike:
+			res.FalseNegatives++
+		default:
+			res.TrueNegatives++
+		}
+	}
+
+	if res.Points < minBacktestPoints {
+		res.InsufficientData = true
+		return res
+	}
+	if n := res.TruePositives + res.FalsePositives; n > 0 {
+		precision := float64(res.TruePositives) / float64(n)
+		res.Precision = &precision
+	}
+	if n := res.TruePositives + res.FalseNegatives; n > 0 {
+		recall := float64(res.TruePositives) / float64(n)
+		res.Recall = &recall
+	}
+	return res
+}
+
+// backtestSeverity forecasts each day after the warm-up from the period
+// starts and scores before it, once minCycles complete cycles are known
+func backtestSeverity(days []scoredDay, starts []time.Time, minCycles int) severityBacktest {
+	var res severityBacktest
+	var errs, baselineErrs float64
+	for i := backtestStart(days); i < len(days); i++ {
+		date := days[i].Date
+		var pastStarts []time.Time
+		for _, s := range starts {
+			if s.Before(date) {
+				pastStarts = append(pastStarts, s)
+			}
+		}
+		if len(cycleLengths(pastStarts)) < minCycles {
+			continue
+		}
+		day, ok := cycleDay(date, pastStarts)
+		if !ok {
+			continue
+		}
+
+		var sameDay, all []float64
+		for _, d := range days[:i] {
+			all = append(all, d.Score)
+			if past, ok := cycleDay(d.Date, pastStarts); ok && past == day {
+				sameDay = append(sameDay, d.Score)
+			}
+		}
+		if len(sameDay) == 0 {
+			continue
+		}
+		forecast, _ := meanStdDev(sameDay)
+		baseline, _ := meanStdDev(all)
+		errs += math.Abs(forecast - days[i].Score)
+		baselineErrs += math.Abs(baseline - days[i].Score)
+		res.Points++
+	}
+
+	if res.Points < minBacktestPoints {
+		res.InsufficientData = true
+		return res
+	}
+	mae := errs / float64(res.Points)
+	baselineMAE := baselineErrs / float64(res.Points)
+	res.MAE, res.BaselineMAE = &mae, &baselineMAE
+	return res
+}
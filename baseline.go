@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The reference ranges /compare_to_baseline uses are stored as JSON in the
+// "reference_ranges" setting, any range left out keeps its default
+const referenceRangesSetting = "reference_ranges"
+
+// Attached to every baseline comparison
+const baselineDisclaimer = "Reference ranges are general guidance for orientation only, not a diagnosis. Talk to your doctor about what is typical for you."
+
+type referenceRange struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Unit string  `json:"unit"`
+}
+
+type referenceRanges struct {
+	SleepHours      referenceRange `json:"sleep_hours"`
+	SymptomSeverity referenceRange `json:"symptom_severity"`
+}
+
+func defaultReferenceRanges() referenceRanges {
+	return referenceRanges{
+		SleepHours:      referenceRange{Min: 7, Max: 9, Unit: "h"},
+		SymptomSeverity: referenceRange{Min: 0, Max: 3, Unit: "/10"},
+	}
+}
+
+func (r referenceRanges) validate() error {
+	if r.SleepHours.Min > r.SleepHours.Max {
+		return errors.New("invalid sleep_hours range, min must not be above max")
+	}
+	if r.SymptomSeverity.Min > r.SymptomSeverity.Max {
+		return errors.New("invalid symptom_severity range, min must not be above max")
+	}
+	return nil
+}
+
+// validReferenceRangesSetting checks a value for the reference_ranges
+// setting before it is stored
+func validReferenceRangesSetting(value []byte) error {
+	ranges := defaultReferenceRanges()
+	if err := json.Unmarshal(value, &ranges); err != nil {
+		return errors.New("reference_ranges must be an object of {min, max, unit} ranges")
+	}
+	return ranges.validate()
+}
+
+const (
+	baselineBelow  = "below"
+	baselineWithin = "within"
+	baselineAbove  = "above"
+	baselineNoData = "no_data"
+)
+
+type baselineComparison struct {
+	Average  *float64       `json:"average"`
+	Range    referenceRange `json:"range"`
+	Position string         `json:"position"`
+	Message  string         `json:"message"`
+}
+
+// compareToRange places the mean of values against rr. label names the
+// measure in the message, e.g. "sleep".
+func compareToRange(label string, values []float64, rr referenceRange) baselineComparison {
+	res := baselineComparison{Range: rr, Position: baselineNoData}
+	if len(values) == 0 {
+		res.Message = fmt.Sprintf("No %s data logged yet", label)
+		return res
+	}
+	avg, _ := meanStdDev(values)
+	res.Average = &avg
+
+	var where string
+	switch {
+	case avg < rr.Min:
+		res.Position, where = baselineBelow, "below"
+	case avg > rr.Max:
+		res.Position, where = baselineAbove, "above"
+	default:
+		res.Position, where = baselineWithin, "within"
+	}
+	res.Message = fmt.Sprintf("Your %s averages %.1f%s, %s the typical %g–%g%s", label, avg, rr.Unit, where, rr.Min, rr.Max, rr.Unit)
+	return res
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"terrahack2025-backend/database"
+)
+
+// batchInput is shared by every report in a batch, loaded and analysed once
+type batchInput struct {
+	Data         analysisData
+	Opts         analysisOptions
+	Requirements dataRequirements
+	Analysis     triggerAnalysis
+	// PeriodStarts covers all history, so days at the start of a date range
+	// still get a cycle day
+	PeriodStarts []time.Time
+}
+
+// batchResult holds a report's result or, when it couldn't be computed,
+// why, so one failing report doesn't fail the batch
+type batchResult struct {
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+var errBatchNoSymptoms = errors.New("insufficient data, requires " + requireSymptomEntry)
+
+// batchReports are the reports /analytics/batch can compute by name
+var batchReports = map[string]func(in batchInput) (any, error){
+	"triggers": func(in batchInput) (any, error) {
+		a := in.Analysis
+		if len(a.ScoredDays) == 0 {
+			return nil, errBatchNoSymptoms
+		}
+		baseRate, _ := a.lifts()
+		return map[string]any{
+			"symptom_spike_threshold": a.Threshold,
+			"symptom_average":         a.Mean,
+			"standard_deviation":      a.StdDev,
+			"base_spike_rate":         baseRate,
+			"ranked_triggers":         a.rankTriggers(),
+		}, nil
+	},
+	"scores": func(in batchInput) (any, error) {
+		type scoreDay struct {
+			Date  time.Time `json:"date"`
+			Score float64   `json:"score"`
+			Spike bool      `json:"spike"`
+		}
+		days := []scoreDay{}
+		for _, d := range in.Analysis.ScoredDays {
+			_, spike := in.Analysis.SpikeDays[d.Date.Format("2006-01-02")]
+			days = append(days, scoreDay{Date: d.Date, Score: d.Score, Spike: spike})
+		}
+		return days, nil
+	},
+	"correlations": func(in batchInput) (any, error) {
+		if len(in.Data.Symptoms) == 0 {
+			return nil, errBatchNoSymptoms
+		}
+		return map[string]any{
+			"factors":          correlationFactors,
+			"matrix":           correlationMatrix(dailyFactorSeries(in.Data, in.Opts.Aggregate), correlationFactors, in.Requirements.CorrelationOverlapDays),
+			"min_overlap_days": in.Requirements.CorrelationOverlapDays,
+		}, nil
+	},
+	"cycle_phases": func(in batchInput) (any, error) {
+		if len(in.PeriodStarts) == 0 {
+			return nil, errors.New("insufficient data, requires at least 1 logged period start")
+		}
+		return cyclePhaseStats(in.Analysis, in.PeriodStarts), nil
+	},
+}
+
+type phaseStats struct {
+	Days         int      `json:"days"`
+	AverageScore *float64 `json:"average_score"`
+	Spikes       int      `json:"spikes"`
+}
+
+// cyclePhaseStats summarises the scored days by the cycle phase they fell in
+func cyclePhaseStats(a triggerAnalysis, starts []time.Time) map[string]phaseStats {
+	scores := map[string][]float64{}
+	stats := map[string]phaseStats{}
+	for _, phase := range []string{"menstrual", "follicular", "ovulatory", "luteal"} {
+		stats[phase] = phaseStats{}
+	}
+	for _, d := range a.ScoredDays {
+		day, ok := cycleDay(d.Date, starts)
+		if !ok {
+			continue
+		}
+		phase := cyclePhase(day)
+		s := stats[phase]
+		s.Days++
+		if _, spike := a.SpikeDays[d.Date.Format("2006-01-02")]; spike {
+			s.Spikes++
+		}
+		stats[phase] = s
+		scores[phase] = append(scores[phase], d.Score)
+	}
+	for phase, values := range scores {
+		mean, _ := meanStdDev(values)
+		s := stats[phase]
+		s.AverageScore = &mean
+		stats[phase] = s
+	}
+	return stats
+}
+
+// inRange keeps the records dated within r
+func (data analysisData) inRange(r dateRange) analysisData {
+	data.Sleep = filterByDate(data.Sleep, func(s database.Sleep) pgtype.Date { return s.Date }, r)
+	data.Diet = filterByDate(data.Diet, func(d database.Diet) pgtype.Date { return d.Date }, r)
+	data.Menstrual = filterByDate(data.Menstrual, func(m database.Menstrual) pgtype.Date { return m.Date }, r)
+	data.Symptoms = filterByDate(data.Symptoms, func(s database.Symptom) pgtype.Date { return s.Date }, r)
+	data.Journal = filterByDate(data.Journal, func(j database.Journal) pgtype.Date { return j.Date }, r)
+	data.CustomFactors = filterByDate(data.CustomFactors, func(f database.CustomFactor) pgtype.Date { return f.Date }, r)
+	return data
+}
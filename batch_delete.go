@@ -0,0 +1,20 @@
+package main
+
+// batchDeleteResults reports each requested id as "deleted" or, when the
+// soft delete didn't return it because it doesn't exist or was already
+// deleted, "not_found", so those ids don't fail the whole batch
+func batchDeleteResults(ids, deleted []int32) map[int32]string {
+	found := map[int32]bool{}
+	for _, id := range deleted {
+		found[id] = true
+	}
+	results := map[int32]string{}
+	for _, id := range ids {
+		if found[id] {
+			results[id] = "deleted"
+		} else {
+			results[id] = "not_found"
+		}
+	}
+	return results
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBatchDeleteResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []int32
+		deleted []int32
+		want    map[int32]string
+	}{
+		{
+			"all found",
+			[]int32{1, 2},
+			[]int32{1, 2},
+			map[int32]string{1: "deleted", 2: "deleted"},
+		},
+		{
+			// 3 doesn't exist and 4 was deleted earlier, so neither is returned
+			"mixed found, missing and already deleted",
+			[]int32{1, 3, 4, 2},
+			[]int32{2, 1},
+			map[int32]string{1: "deleted", 2: "deleted", 3: "not_found", 4: "not_found"},
+		},
+		{
+			"none found",
+			[]int32{5},
+			nil,
+			map[int32]string{5: "not_found"},
+		},
+		{
+			"repeated id",
+			[]int32{1, 1},
+			[]int32{1},
+			map[int32]string{1: "deleted"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchDeleteResults(tt.ids, tt.deleted); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batchDeleteResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ifMatchVersion reads the record version an edit expects from If-Match,
+// e.g. If-Match: "3" as sent back from the ETag of an earlier response.
+// Without the header, or with *, the edit isn't checked. It responds 400
+// itself when the header isn't a single version.
+func ifMatchVersion(c *gin.Context) (pgtype.Int4, bool) {
+	v := strings.TrimSpace(c.GetHeader("If-Match"))
+	if v == "" || v == "*" {
+		return pgtype.Int4{}, true
+	}
+	n, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(v, "W/"), `"`), 10, 32)
+	if err != nil || n < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid If-Match, expected a single record version like \"3\""})
+		return pgtype.Int4{}, false
+	}
+	return pgtype.Int4{Int32: int32(n), Valid: true}, true
+}
+
+// versionETag is the ETag of a record version, in the form If-Match takes
+func versionETag(version int32) string {
+	return strconv.Quote(strconv.Itoa(int(version)))
+}
+
+// respondVersionConflict answers 409 with the record's current version when
+// an If-Match edit matched no row because the record was edited since. It
+// returns false, leaving err to respondDBError, for any other outcome,
+// including a record that no longer exists.
+func respondVersionConflict(c *gin.Context, err error, expected pgtype.Int4, name string, currentVersion func() (int32, error)) bool {
+	if !errors.Is(err, pgx.ErrNoRows) || !expected.Valid {
+		return false
+	}
+	current, err := currentVersion()
+	if err != nil {
+		return false
+	}
+	c.Header("ETag", versionETag(current))
+	c.JSON(http.StatusConflict, gin.H{
+		"error":           name + " was changed by another edit, reload it and try again",
+		"current_version": current,
+	})
+	return true
+}
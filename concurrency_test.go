@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestIfMatchVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		header string
+		want   pgtype.Int4
+		ok     bool
+	}{
+		{"", pgtype.Int4{}, true},
+		{"*", pgtype.Int4{}, true},
+		{`"3"`, pgtype.Int4{Int32: 3, Valid: true}, true},
+		{`W/"3"`, pgtype.Int4{Int32: 3, Valid: true}, true},
+		{"12", pgtype.Int4{Int32: 12, Valid: true}, true},
+		{`"0"`, pgtype.Int4{}, false},
+		{`"3", "4"`, pgtype.Int4{}, false},
+		{`"abc"`, pgtype.Int4{}, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/diet/1/items", nil)
+		if tt.header != "" {
+			c.Request.Header.Set("If-Match", tt.header)
+		}
+		got, ok := ifMatchVersion(c)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("If-Match %q = %v, %v, want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+		if !ok && w.Code != http.StatusBadRequest {
+			t.Errorf("If-Match %q responded %d, want 400", tt.header, w.Code)
+		}
+	}
+}
+
+func TestRespondVersionConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stale := pgtype.Int4{Int32: 3, Valid: true}
+	current := func() (int32, error) { return 4, nil }
+
+	// A stale If-Match matches no row while the entry exists at version 4
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	if !respondVersionConflict(c, pgx.ErrNoRows, stale, "diet entry", current) {
+		t.Fatal("stale edit was not reported as a conflict")
+	}
+	if w.Code != http.StatusConflict {
+		t.Errorf("status %d, want 409", w.Code)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"4"` {
+		t.Errorf("ETag %s, want \"4\"", etag)
+	}
+	var res struct {
+		CurrentVersion int32 `json:"current_version"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.CurrentVersion != 4 {
+		t.Errorf("body %s, want current_version 4", w.Body)
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected pgtype.Int4
+		current  func() (int32, error)
+	}{
+		{"edit succeeded", nil, stale, current},
+		{"no If-Match", pgx.ErrNoRows, pgtype.Int4{}, current},
+		{"entry deleted", pgx.ErrNoRows, stale, func() (int32, error) { return 0, pgx.ErrNoRows }},
+		{"other error", errors.New("connection reset"), stale, current},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		if respondVersionConflict(c, tt.err, tt.expected, "diet entry", tt.current) {
+			t.Errorf("%s: reported a conflict", tt.name)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import "sort"
+
+const (
+	defaultCooccurrenceLimit = 10
+	maxCooccurrenceLimit     = 50
+
+	// Spikes before the trigger analysis has any pair worth testing, unless
+	// the data_requirements setting overrides it
+	minCooccurrenceSpikes = 5
+	// A pair has to precede this many spikes together to be reported
+	minPairSpikes = 2
+)
+
+// triggerPair is two factors logged together the day before, in the same
+// "low_sleep", "food:x" form the trigger analysis counts
+type triggerPair struct {
+	Factors [2]string `json:"factors"`
+	// Days both were logged and the following day was scored
+	DaysPresent int `json:"days_present"`
+	Spikes      int `json:"spikes"`
+	// P(spike | both logged the day before) / P(spike)
+	JointLift float64 `json:"joint_lift"`
+	// Joint lift over the stronger factor's own lift, above 1 means the
+	// combination is worse than either factor alone
+	Synergy float64 `json:"synergy"`
+	PValue  float64 `json:"p_value"`
+}
+
+// triggerPairs finds pairs of factors after which spikes are more likely
+// than on an average day, strongest joint lift first
+func (a triggerAnalysis) triggerPairs(limit int) []triggerPair {
+	baseRate, lifts := a.lifts()
+	if baseRate == 0 {
+		return []triggerPair{}
+	}
+
+	counts := map[[2]string]*triggerPair{}
+	for i := 1; i < len(a.ScoredDays); i++ {
+		date := a.ScoredDays[i].Date.Format("2006-01-02")
+		_, spike := a.SpikeDays[date]
+		var factors []string
+		for f := range a.ByDate.factors(a.ScoredDays[i].Date.AddDate(0, 0, -1).Format("2006-01-02")) {
+			factors = append(factors, f)
+		}
+		sort.Strings(factors)
+		for x := 0; x < len(factors); x++ {
+			for y := x + 1; y < len(factors); y++ {
+				key := [2]string{factors[x], factors[y]}
+				p := counts[key]
+				if p == nil {
+					p = &triggerPair{Factors: key}
+					counts[key] = p
+				}
+				p.DaysPresent++
+				if spike {
+					p.Spikes++
+				}
+			}
+		}
+	}
+
+	pairs := []triggerPair{}
+	for _, p := range counts {
+		if p.Spikes < minPairSpikes {
+			continue
+		}
+		p.JointLift = (float64(p.Spikes) / float64(p.DaysPresent)) / baseRate
+		if p.JointLift <= 1 {
+			continue
+		}
+		if single := max(lifts[p.Factors[0]].Lift, lifts[p.Factors[1]].Lift); single > 0 {
+			p.Synergy = p.JointLift / single
+		}
+		p.PValue = a.significance(factorLift{DaysPresent: p.DaysPresent, Spikes: p.Spikes}).PValue
+		pairs = append(pairs, *p)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].JointLift != pairs[j].JointLift {
+			return pairs[i].JointLift > pairs[j].JointLift
+		}
+		if pairs[i].Spikes != pairs[j].Spikes {
+			return pairs[i].Spikes > pairs[j].Spikes
+		}
+		if pairs[i].Factors[0] != pairs[j].Factors[0] {
+			return pairs[i].Factors[0] < pairs[j].Factors[0]
+		}
+		return pairs[i].Factors[1] < pairs[j].Factors[1]
+	})
+	if len(pairs) > limit {
+		pairs = pairs[:limit]
+	}
+	return pairs
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pairs with fewer overlapping days than this are reported without a
+// correlation, a handful of points gives a meaningless r. The
+// data_requirements setting can override it.
+const minCorrelationOverlap = 7
+
+// correlationFactors are the numeric daily series, in matrix order
+var correlationFactors = []string{
+	"sleep_duration",
+	"sleep_quality",
+	"nausea",
+	"fatigue",
+	"pain",
+	"symptom_score",
+	"diet_item_count",
+}
+
+type correlationCell struct {
+	Correlation      *float64 `json:"correlation"`
+	SampleSize       int      `json:"sample_size"`
+	InsufficientData bool     `json:"insufficient_data"`
+}
+
+// dailyFactorSeries averages every numeric factor per date. Days without a
+// value for a factor are simply absent from its series.
+func dailyFactorSeries(data analysisData, aggregate string) map[string]map[string]float64 {
+	totals := map[string]map[string]float64{}
+	counts := map[string]map[string]int{}
+	add := func(factor, date string, v float64) {
+		if totals[factor] == nil {
+			totals[factor] = map[string]float64{}
+			counts[factor] = map[string]int{}
+		}
+		totals[factor][date] += v
+		counts[factor][date]++
+	}
+
+	for _, s := range data.Sleep {
+		date := s.Date.Time.Format("2006-01-02")
+		if s.Duration.Valid {
+			add("sleep_duration", date, s.Duration.Float64)
+		}
+		if s.Quality.Valid {
+			add("sleep_quality", date, float64(s.Quality.Int32))
+		}
+	}
+	for _, s := range data.Symptoms {
+		date := s.Date.Time.Format("2006-01-02")
+		if s.Nausea.Valid {
+			add("nausea", date, float64(s.Nausea.Int32))
+		}
+		if s.Fatigue.Valid {
+			add("fatigue", date, float64(s.Fatigue.Int32))
+		}
+		if s.Pain.Valid {
+			add("pain", date, float64(s.Pain.Int32))
+		}
+		if score, ok := symptomScore(s, aggregate); ok {
+			add("symptom_score", date, score)
+		}
+	}
+
+	// Item counts are summed across a day's meals rather than averaged
+	itemCounts := map[string]float64{}
+	for _, d := range data.Diet {
+		itemCounts[d.Date.Time.Format("2006-01-02")] += float64(len(d.Items))
+	}
+
+	series := map[string]map[string]float64{"diet_item_count": itemCounts}
+	for factor, byDate := range totals {
+		series[factor] = map[string]float64{}
+		for date, total := range byDate {
+			series[factor][date] = total / float64(counts[factor][date])
+		}
+	}
+	return series
+}
+
+// correlationMatrix computes Pearson's r for every pair of factors over the
+// days both were logged, for pairs with at least minOverlap such days
+func correlationMatrix(series map[string]map[string]float64, factors []string, minOverlap int) [][]correlationCell {
+	matrix := make([][]correlationCell, len(factors))
+	for i, a := range factors {
+		matrix[i] = make([]correlationCell, len(factors))
+		for j, b := range factors {
+			if j < i {
+				matrix[i][j] = matrix[j][i]
+				continue
+			}
+
+			var dates []string
+			for date := range series[a] {
+				if _, ok := series[b][date]; ok {
+					dates = append(dates, date)
+				}
+			}
+			sort.Strings(dates)
+			xs := make([]float64, len(dates))
+			ys := make([]float64, len(dates))
+			for k, date := range dates {
+				xs[k], ys[k] = series[a][date], series[b][date]
+			}
+
+			cell := correlationCell{SampleSize: len(dates)}
+			if len(dates) < minOverlap {
+				cell.InsufficientData = true
+			} else if r, ok := pearson(xs, ys); ok {
+				cell.Correlation = &r
+			}
+			matrix[i][j] = cell
+		}
+	}
+	return matrix
+}
+
+// respondCorrelationMatrix answers /correlation_matrix from the loaded data
+func respondCorrelationMatrix(c *gin.Context, data analysisData, aggregate string, minOverlap int) {
+	if len(data.Symptoms) == 0 {
+		respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+		return
+	}
+
+	series := dailyFactorSeries(data, aggregate)
+	respondRounded(c, gin.H{
+		"factors":          correlationFactors,
+		"matrix":           correlationMatrix(series, correlationFactors, minOverlap),
+		"min_overlap_days": minOverlap,
+		"note":             "cells with fewer than min_overlap_days days logged for both factors are marked insufficient_data and have no correlation",
+	})
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mimeCSV = "text/csv"
+
+// respondAnalytics writes an analytics result as JSON or, with Accept:
+// text/csv, flattened to CSV (see encodeCSV), table= picking which list
+// to export when the result has several. Other Accept values get 406.
+// respondRounded does the same with numbers rounded, which most results
+// want.
+func respondAnalytics(c *gin.Context, v any) {
+	format, ok := negotiateAnalytics(c)
+	if !ok {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeAnalytics(c, format, b)
+}
+
+// negotiateAnalytics picks JSON or CSV from the Accept header, responding
+// 406 itself when neither is acceptable
+func negotiateAnalytics(c *gin.Context) (string, bool) {
+	c.Header("Vary", "Accept")
+	format := c.NegotiateFormat(gin.MIMEJSON, mimeCSV)
+	if format == "" {
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": "unsupported Accept, expected application/json or text/csv"})
+		return "", false
+	}
+	return format, true
+}
+
+// writeAnalytics writes the encoded JSON result b in format
+func writeAnalytics(c *gin.Context, format string, b []byte) {
+	if format != mimeCSV {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", b)
+		return
+	}
+	out, err := encodeCSV(b, c.Query("table"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", out)
+}
+
+// jsonField is one key of a decoded JSON object, kept in encoded order so
+// CSV columns come out in the same order as the JSON fields
+type jsonField struct {
+	Key   string
+	Value any
+}
+
+// decodeOrdered decodes JSON like encoding/json into any, except objects
+// become []jsonField instead of maps
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		fields := []jsonField{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, jsonField{Key: key.(string), Value: v})
+		}
+		_, err := dec.Token()
+		return fields, err
+	case json.Delim('['):
+		items := []any{}
+		for dec.More() {
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		_, err := dec.Token()
+		return items, err
+	}
+	return tok, nil
+}
+
+// csvRows picks the rows of a JSON result: the result itself when it is an
+// array, the array field named by table, or the result's only array of
+// objects. Anything else is a single row.
+func csvRows(v any, table string) ([]any, error) {
+	if items, ok := v.([]any); ok {
+		return items, nil
+	}
+	fields, _ := v.([]jsonField)
+	if table != "" {
+		for _, f := range fields {
+			if items, ok := f.Value.([]any); ok && f.Key == table {
+				return items, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid table %q, expected one of %s", table, strings.Join(tableNames(fields), ", "))
+	}
+	names := tableNames(fields)
+	switch len(names) {
+	case 0:
+		return []any{v}, nil
+	case 1:
+		for _, f := range fields {
+			if f.Key == names[0] {
+				return f.Value.([]any), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("the result has several tables, choose one with table=%s", strings.Join(names, "|"))
+}
+
+// tableNames lists the fields holding an array of objects
+func tableNames(fields []jsonField) []string {
+	var names []string
+	for _, f := range fields {
+		if items, ok := f.Value.([]any); ok && len(items) > 0 {
+			if _, ok := items[0].([]jsonField); ok {
+				names = append(names, f.Key)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// csvHeader holds the column names in the order first seen
+type csvHeader struct {
+	names []string
+	seen  map[string]bool
+}
+
+func (c *csvHeader) add(name string) {
+	if !c.seen[name] {
+		c.seen[name] = true
+		c.names = append(c.names, name)
+	}
+}
+
+// flattenCSV adds the cells of v under prefix: nested objects become dotted
+// columns, arrays of plain values are joined with "; " and anything deeper
+// is kept as JSON
+func flattenCSV(prefix string, v any, row map[string]string, columns *csvHeader) {
+	set := func(value string) {
+		columns.add(prefix)
+		row[prefix] = value
+	}
+	switch v := v.(type) {
+	case []jsonField:
+		if len(v) == 0 {
+			set("")
+		}
+		for _, f := range v {
+			flattenCSV(joinPath(prefix, f.Key), f.Value, row, columns)
+		}
+	case []any:
+		var parts []string
+		for _, item := range v {
+			switch item.(type) {
+			case []jsonField, []any:
+				b, _ := json.Marshal(plainJSON(v))
+				set(string(b))
+				return
+			}
+			parts = append(parts, csvCell(item))
+		}
+		set(strings.Join(parts, "; "))
+	default:
+		if prefix == "" {
+			prefix = "value"
+		}
+		set(csvCell(v))
+	}
+}
+
+func csvCell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// plainJSON turns decoded ordered objects back into values encoding/json
+// can marshal
+func plainJSON(v any) any {
+	switch v := v.(type) {
+	case []jsonField:
+		m := map[string]any{}
+		for _, f := range v {
+			m[f.Key] = plainJSON(f.Value)
+		}
+		return m
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = plainJSON(item)
+		}
+		return items
+	}
+	return v
+}
+
+// encodeCSV flattens an encoded JSON result into CSV with a header row,
+// taking the rows as csvRows does. Columns are the union of every row's
+// cells in the order first seen.
+func encodeCSV(b []byte, table string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	items, err := csvRows(v, table)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := &csvHeader{seen: map[string]bool{}}
+	rows := make([]map[string]string, len(items))
+	for i, item := range items {
+		rows[i] = map[string]string{}
+		flattenCSV("", item, rows[i], columns)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(columns.names)
+	for _, row := range rows {
+		record := make([]string, len(columns.names))
+		for i, col := range columns.names {
+			record[i] = row[col]
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
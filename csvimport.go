@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Only the first few problems are reported, a badly mapped file would
+// otherwise produce one error per line
+const maxCSVErrors = 20
+
+// csvLineError is a problem with one line of an uploaded CSV. Line is the
+// 1-based line in the file, so the header is line 1.
+type csvLineError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// csvColumns returns the CSV column names accepted for a row type, which are
+// its JSON field names
+func csvColumns(rowType reflect.Type) map[string]int {
+	columns := map[string]int{}
+	for i := 0; i < rowType.NumField(); i++ {
+		name := strings.SplitN(rowType.Field(i).Tag.Get("json"), ",", 2)[0]
+		columns[name] = i
+	}
+	return columns
+}
+
+// decodeCSVRow fills row, a pointer to an import row struct, from the cells
+// of one record. List fields such as diet items are separated by semicolons.
+func decodeCSVRow(row any, header []string, record []string) []fieldError {
+	v := reflect.ValueOf(row).Elem()
+	columns := csvColumns(v.Type())
+
+	var errs []fieldError
+	for i, name := range header {
+		cell := strings.TrimSpace(record[i])
+		if cell == "" {
+			continue
+		}
+		field := v.Field(columns[name])
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(cell)
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(cell, 64)
+			if err != nil {
+				errs = append(errs, fieldError{Field: name, Message: "must be a number"})
+				continue
+			}
+			field.SetFloat(f)
+		case reflect.Int32:
+			n, err := strconv.ParseInt(cell, 10, 32)
+			if err != nil {
+				errs = append(errs, fieldError{Field: name, Message: "must be an integer"})
+				continue
+			}
+			field.SetInt(n)
+		case reflect.Pointer:
+			// Optional integers such as symptom components, null when the cell is empty
+			n, err := strconv.ParseInt(cell, 10, 32)
+			if err != nil {
+				errs = append(errs, fieldError{Field: name, Message: "must be an integer"})
+				continue
+			}
+			v := int32(n)
+			field.Set(reflect.ValueOf(&v))
+		case reflect.Slice:
+			field.Set(reflect.ValueOf(strings.Split(cell, ";")))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	if err := binding.Validator.ValidateStruct(row); err != nil {
+		return fieldErrors(err)
+	}
+	if r, ok := row.(entryRequest); ok {
+		return r.check()
+	}
+	return nil
+}
+
+// parseCSVImport reads a CSV with a header row into an import payload for a
+// single domain. Header problems are returned as an error; problems with
+// individual lines are collected, up to maxCSVErrors, so the whole file can
+// be fixed in one pass.
+func parseCSVImport(r io.Reader, domain string) (importPayload, []csvLineError, error) {
+	var payload importPayload
+	var newRow func() any
+	switch domain {
+	case "sleep":
+		newRow = func() any { return &importSleepRow{} }
+	case "diet":
+		newRow = func() any { return &importDietRow{} }
+	case "menstrual":
+		newRow = func() any { return &importMenstrualRow{} }
+	case "symptoms":
+		newRow = func() any { return &importSymptomsRow{} }
+	default:
+		return payload, nil, errors.New("invalid type, expected one of sleep, diet, menstrual, symptoms")
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return payload, nil, errors.New("CSV is empty, expected a header row")
+	}
+	if err != nil {
+		return payload, nil, err
+	}
+
+	columns := csvColumns(reflect.TypeOf(newRow()).Elem())
+	hasDate := false
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; !ok {
+			return payload, nil, fmt.Errorf("unknown column %q for %s", name, domain)
+		}
+		header[i] = name
+		hasDate = hasDate || name == "date"
+	}
+	if !hasDate {
+		return payload, nil, errors.New("missing required date column")
+	}
+
+	var lineErrs []csvLineError
+	for len(lineErrs) < maxCSVErrors {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return payload, nil, err
+			}
+			lineErrs = append(lineErrs, csvLineError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := newRow()
+		if errs := decodeCSVRow(row, header, record); len(errs) > 0 {
+			for _, fe := range errs {
+				lineErrs = append(lineErrs, csvLineError{Line: line, Field: fe.Field, Message: fe.Message})
+			}
+			continue
+		}
+		switch row := row.(type) {
+		case *importSleepRow:
+			payload.Sleep = append(payload.Sleep, *row)
+		case *importDietRow:
+			payload.Diet = append(payload.Diet, *row)
+		case *importMenstrualRow:
+			payload.Menstrual = append(payload.Menstrual, *row)
+		case *importSymptomsRow:
+			payload.Symptoms = append(payload.Symptoms, *row)
+		}
+	}
+	if len(lineErrs) > maxCSVErrors {
+		lineErrs = lineErrs[:maxCSVErrors]
+	}
+	return payload, lineErrs, nil
+}
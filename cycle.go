@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"terrahack2025-backend/database"
+)
+
+const (
+	// Gaps outside this range usually mean a missed "start" log rather than
+	// a real cycle, so they are left out of cycle statistics
+	minCycleLength = 15
+	maxCycleLength = 60
+
+	minForecastCycles = 3
+)
+
+// periodStarts returns the sorted, de-duplicated dates logged as a period start
+func periodStarts(menstrual []database.Menstrual) []time.Time {
+	return periodEventDates(menstrual, "start")
+}
+
+// periodEventDates returns the sorted, de-duplicated dates event was logged
+func periodEventDates(menstrual []database.Menstrual, event string) []time.Time {
+	seen := map[time.Time]bool{}
+	var dates []time.Time
+	for _, m := range menstrual {
+		if m.PeriodEvent.String != event || seen[m.Date.Time] {
+			continue
+		}
+		seen[m.Date.Time] = true
+		dates = append(dates, m.Date.Time)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates
+}
+
+// cycleLengths returns the plausible gaps in days between consecutive starts
+func cycleLengths(starts []time.Time) []float64 {
+	var lengths []float64
+	for i := 1; i < len(starts); i++ {
+		n := daysBetween(starts[i-1], starts[i])
+		if n >= minCycleLength && n <= maxCycleLength {
+			lengths = append(lengths, float64(n))
+		}
+	}
+	return lengths
+}
+
+// cycleDay returns the 1-based day of the cycle containing date, or false
+// when date falls before the first start or in an implausibly long gap
+func cycleDay(date time.Time, starts []time.Time) (int, bool) {
+	i := sort.Search(len(starts), func(i int) bool { return starts[i].After(date) }) - 1
+	if i < 0 {
+		return 0, false
+	}
+	day := daysBetween(starts[i], date) + 1
+	if day > maxCycleLength {
+		return 0, false
+	}
+	return day, true
+}
+
+// cyclePhase tags a cycle day with its approximate phase, assuming ovulation
+// around the middle of a typical cycle
+func cyclePhase(day int) string {
+	switch {
+	case day <= 5:
+		return "menstrual"
+	case day <= 13:
+		return "follicular"
+	case day <= 16:
+		return "ovulatory"
+	default:
+		return "luteal"
+	}
+}
+
+// predictNextPeriod projects the next start from the mean cycle length,
+// rolling forward past today when recent starts weren't logged
+func predictNextPeriod(starts []time.Time, meanLength float64, today time.Time) time.Time {
+	length := int(math.Round(meanLength))
+	next := starts[len(starts)-1].AddDate(0, 0, length)
+	for next.Before(today) {
+		next = next.AddDate(0, 0, length)
+	}
+	return next
+}
+
+// forecastConfidence grades a forecast by how much cycle history backs it
+// and how regular the cycles are, minCycles being the forecast_cycles
+// requirement
+func forecastConfidence(cycles int, lengthStdDev float64, minCycles int) string {
+	switch {
+	case cycles >= max(6, minCycles) && lengthStdDev <= 3:
+		return "high"
+	case cycles >= minCycles && lengthStdDev <= 5:
+		return "medium"
+	default:
+		return "low"
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+type overlayPoint struct {
+	CycleDay int     `json:"cycle_day"`
+	Score    float64 `json:"score"`
+}
+
+// overlayCycle is one cycle's scored days, aligned so day 1 is its start
+type overlayCycle struct {
+	Start time.Time `json:"start"`
+	// Days until the next start, null for the current cycle or one followed
+	// by an implausible gap
+	LengthDays *int           `json:"length_days"`
+	Days       []overlayPoint `json:"days"`
+}
+
+// overlayDay is the typical severity on one cycle day across all cycles.
+// The band is a 95% confidence interval for the mean, left null with fewer
+// than two cycles scored on that day.
+type overlayDay struct {
+	CycleDay     int      `json:"cycle_day"`
+	Phase        string   `json:"phase"`
+	Average      float64  `json:"average"`
+	StdDev       float64  `json:"std_dev"`
+	Lower        *float64 `json:"lower"`
+	Upper        *float64 `json:"upper"`
+	CyclesScored int      `json:"cycles_scored"`
+}
+
+// cycleOverlay aligns the scored days on cycle day and averages them, up to
+// the latest cycle day any cycle was scored on
+func cycleOverlay(days []scoredDay, starts []time.Time) ([]overlayCycle, []overlayDay) {
+	cycles := make([]overlayCycle, len(starts))
+	for i, start := range starts {
+		cycles[i] = overlayCycle{Start: start, Days: []overlayPoint{}}
+		if i+1 < len(starts) {
+			if n := daysBetween(start, starts[i+1]); n >= minCycleLength && n <= maxCycleLength {
+				cycles[i].LengthDays = &n
+			}
+		}
+	}
+
+	byDay := map[int][]float64{}
+	maxDay := 0
+	for _, d := range days {
+		day, ok := cycleDay(d.Date, starts)
+		if !ok {
+			continue
+		}
+		i := sort.Search(len(starts), func(i int) bool { return starts[i].After(d.Date) }) - 1
+		cycles[i].Days = append(cycles[i].Days, overlayPoint{CycleDay: day, Score: d.Score})
+		byDay[day] = append(byDay[day], d.Score)
+		maxDay = max(maxDay, day)
+	}
+
+	// Cycles without a single scored day add nothing to the overlay
+	scored := []overlayCycle{}
+	for _, c := range cycles {
+		if len(c.Days) > 0 {
+			scored = append(scored, c)
+		}
+	}
+
+	average := []overlayDay{}
+	for day := 1; day <= maxDay; day++ {
+		scores := byDay[day]
+		if len(scores) == 0 {
+			continue
+		}
+		mean, stdDev := meanStdDev(scores)
+		od := overlayDay{CycleDay: day, Phase: cyclePhase(day), Average: mean, StdDev: stdDev, CyclesScored: len(scores)}
+		if len(scores) > 1 {
+			margin := 1.96 * stdDev / math.Sqrt(float64(len(scores)))
+			lower, upper := math.Max(0, mean-margin), math.Min(10, mean+margin)
+			od.Lower, od.Upper = &lower, &upper
+		}
+		average = append(average, od)
+	}
+	return scored, average
+}
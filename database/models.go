@@ -5,15 +5,63 @@
 package database
 
 import (
+	"encoding/json"
+
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AnalysisSnapshot struct {
+	ID          int32
+	Data        []byte
+	DataVersion string
+	CreatedAt   pgtype.Timestamptz
+}
+
+type CustomFactor struct {
+	ID         int32
+	FactorName string
+	Date       pgtype.Date
+	Present    bool
+}
+
+type DataChange struct {
+	ID        int32
+	ChangedAt pgtype.Timestamptz
+}
+
 type Diet struct {
-	ID    int32
-	Meal  pgtype.Text
-	Date  pgtype.Date
-	Items []string
-	Notes pgtype.Text
+	ID               int32
+	Meal             pgtype.Text
+	Date             pgtype.Date
+	Items            []string
+	Notes            pgtype.Text
+	ContainsCaffeine bool
+	ContainsAlcohol  bool
+	DeletedAt        pgtype.Timestamptz
+	ItemDetails      json.RawMessage
+	Source           string
+	Version          int32
+}
+
+type FoodCategory struct {
+	Item     string
+	Category string
+}
+
+type Insight struct {
+	ID          int32
+	Kind        string
+	Fingerprint string
+	Message     string
+	Data        []byte
+	GeneratedAt pgtype.Timestamptz
+	DismissedAt pgtype.Timestamptz
+}
+
+type Journal struct {
+	ID   int32
+	Date pgtype.Date
+	Text string
 }
 
 type Menstrual struct {
@@ -22,6 +70,8 @@ type Menstrual struct {
 	Date        pgtype.Date
 	FlowLevel   pgtype.Text
 	Notes       pgtype.Text
+	DeletedAt   pgtype.Timestamptz
+	Source      string
 }
 
 type Prediction struct {
@@ -31,6 +81,29 @@ type Prediction struct {
 	Probability pgtype.Numeric
 }
 
+type RecordVersion struct {
+	ID            int32
+	RecordType    string
+	RecordID      int32
+	Data          []byte
+	ChangedFields []string
+	ChangedAt     pgtype.Timestamptz
+}
+
+type Setting struct {
+	Key       string
+	Value     []byte
+	UpdatedAt pgtype.Timestamptz
+}
+
+type Share struct {
+	Token     string
+	Data      []byte
+	CreatedAt pgtype.Timestamptz
+	ExpiresAt pgtype.Timestamptz
+	RevokedAt pgtype.Timestamptz
+}
+
 type Sleep struct {
 	ID          int32
 	Date        pgtype.Date
@@ -38,13 +111,24 @@ type Sleep struct {
 	Quality     pgtype.Int4
 	Disruptions pgtype.Text
 	Notes       pgtype.Text
+	DeletedAt   pgtype.Timestamptz
+	Source      string
 }
 
 type Symptom struct {
-	ID      int32
-	Date    pgtype.Date
-	Nausea  pgtype.Int4
-	Fatigue pgtype.Int4
-	Pain    pgtype.Int4
-	Notes   pgtype.Text
+	ID        int32
+	Date      pgtype.Date
+	Nausea    pgtype.Int4
+	Fatigue   pgtype.Int4
+	Pain      pgtype.Int4
+	Notes     pgtype.Text
+	DeletedAt pgtype.Timestamptz
+	Source    string
+}
+
+type Weather struct {
+	Date        pgtype.Date
+	PressureHpa pgtype.Float8
+	HumidityPct pgtype.Float8
+	FetchedAt   pgtype.Timestamptz
 }
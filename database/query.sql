@@ -1,31 +1,295 @@
 -- name: InsertSleep :one
-insert into sleep (date, duration, quality, disruptions, notes)
-values ($1, $2, $3, $4, $5)
+insert into sleep (date, duration, quality, disruptions, notes, source)
+values ($1, $2, $3, $4, $5, coalesce(sqlc.narg(source), 'manual'))
 returning *;
 
 -- name: InsertDiet :one
-insert into diet (meal, date, items, notes)
-values ($1, $2, $3, $4)
+insert into diet (meal, date, items, notes, contains_caffeine, contains_alcohol, item_details, source)
+values ($1, $2, $3, $4, $5, $6, $7, coalesce(sqlc.narg(source), 'manual'))
 returning *;
 
 -- name: InsertMenstrual :one
-insert into menstrual (period_event, date, flow_level, notes)
-values ($1, $2, $3, $4)
+insert into menstrual (period_event, date, flow_level, notes, source)
+values ($1, $2, $3, $4, coalesce(sqlc.narg(source), 'manual'))
 returning *;
 
 -- name: InsertSymptoms :one
-insert into symptoms (date, nausea, fatigue, pain, notes)
-values ($1, $2, $3, $4, $5)
+insert into symptoms (date, nausea, fatigue, pain, notes, source)
+values ($1, $2, $3, $4, $5, coalesce(sqlc.narg(source), 'manual'))
+returning *;
+
+-- name: InsertJournal :one
+insert into journal (date, text)
+values ($1, $2)
 returning *;
 
+-- name: GetAllJournal :many
+select * from journal order by date, id;
+
+-- name: UpsertCustomFactor :one
+insert into custom_factors (factor_name, date, present)
+values ($1, $2, $3)
+on conflict (factor_name, date) do update set present = excluded.present
+returning *;
+
+-- name: GetAllCustomFactors :many
+select * from custom_factors order by date, factor_name;
+
 -- name: GetAllSleep :many
-select * from sleep;
+select * from sleep where deleted_at is null;
 
 -- name: GetAllDiet :many
-select * from diet;
+select * from diet where deleted_at is null;
 
 -- name: GetAllMenstrual :many
-select * from menstrual;
+select * from menstrual where deleted_at is null;
 
 -- name: GetAllSymptoms :many
-select * from symptoms;
+select * from symptoms where deleted_at is null;
+
+-- name: GetRecordHistory :many
+select * from record_versions
+where record_type = $1 and record_id = $2
+order by changed_at, id;
+
+-- name: UpdateDietFlags :execrows
+update diet set contains_caffeine = $2, contains_alcohol = $3
+where id = $1 and (contains_caffeine <> $2 or contains_alcohol <> $3);
+
+-- name: GetDietVersion :one
+select version from diet where id = $1 and deleted_at is null;
+
+-- name: UpdateDietItems :execrows
+update diet set items = $2, item_details = $3, contains_caffeine = $4, contains_alcohol = $5, version = version + 1
+where id = $1 and deleted_at is null;
+
+-- name: GetSetting :one
+select * from settings where key = $1;
+
+-- name: GetAllSettings :many
+select * from settings order by key;
+
+-- name: UpsertSetting :one
+insert into settings (key, value, updated_at)
+values ($1, $2, now())
+on conflict (key) do update set value = excluded.value, updated_at = now()
+returning *;
+
+-- name: AppendDietItem :one
+-- A null expected_version skips the version check
+update diet set items = array_append(items, sqlc.arg(item)::text),
+    item_details = item_details || jsonb_build_array(jsonb_build_object('name', sqlc.arg(item)::text)),
+    version = version + 1
+where id = sqlc.arg(id) and deleted_at is null
+    and (sqlc.narg(expected_version)::int is null or version = sqlc.narg(expected_version))
+returning *;
+
+-- name: RemoveDietItem :one
+-- A null expected_version skips the version check
+update diet set items = array_remove(items, sqlc.arg(item)::text),
+    item_details = (
+        select jsonb_agg(e) from jsonb_array_elements(item_details) e
+        where e ->> 'name' <> sqlc.arg(item)::text
+    ),
+    version = version + 1
+where id = sqlc.arg(id) and deleted_at is null
+    and (sqlc.narg(expected_version)::int is null or version = sqlc.narg(expected_version))
+returning *;
+
+-- name: DeleteSleepByDate :execrows
+delete from sleep where date = $1 and deleted_at is null;
+
+-- name: DeleteDietByDateAndMeal :execrows
+delete from diet where date = $1 and meal = $2 and deleted_at is null;
+
+-- name: DeleteMenstrualByDate :execrows
+delete from menstrual where date = $1 and deleted_at is null;
+
+-- name: DeleteSymptomsByDate :execrows
+delete from symptoms where date = $1 and deleted_at is null;
+
+-- name: GetDailySymptomAverages :many
+select date,
+    avg((coalesce(nausea, 0) + coalesce(fatigue, 0) + coalesce(pain, 0))::float8 / num_nonnulls(nausea, fatigue, pain))::float8 as mean_score,
+    max(greatest(nausea, fatigue, pain))::float8 as max_score,
+    count(*)::int as entries
+from symptoms
+-- Components left out of a partial entry are null and don't count
+where deleted_at is null and num_nonnulls(nausea, fatigue, pain) > 0
+    and (sqlc.narg(sources)::text[] is null or source = any(sqlc.narg(sources)::text[]))
+group by date
+order by date;
+
+-- name: GetWeeklySymptomAverages :many
+-- Weeks start on Monday. Each day is scored as in GetDailySymptomAverages
+-- and the week averages its days, so days with several entries don't weigh
+-- more. A component never logged in the week is null.
+with days as (
+    select date,
+        avg(nausea)::float8 as nausea,
+        avg(fatigue)::float8 as fatigue,
+        avg(pain)::float8 as pain,
+        avg((coalesce(nausea, 0) + coalesce(fatigue, 0) + coalesce(pain, 0))::float8 / num_nonnulls(nausea, fatigue, pain))::float8 as mean_score,
+        max(greatest(nausea, fatigue, pain))::float8 as max_score,
+        count(*)::int as entries
+    from symptoms
+    where deleted_at is null and num_nonnulls(nausea, fatigue, pain) > 0
+        and (sqlc.narg(from_date)::date is null or date >= sqlc.narg(from_date))
+        and (sqlc.narg(to_date)::date is null or date < sqlc.narg(to_date))
+        and (sqlc.narg(sources)::text[] is null or source = any(sqlc.narg(sources)::text[]))
+    group by date
+)
+select date_trunc('week', date)::date as week_start,
+    avg(nausea)::float8 as nausea,
+    avg(fatigue)::float8 as fatigue,
+    avg(pain)::float8 as pain,
+    avg(mean_score)::float8 as mean_score,
+    avg(max_score)::float8 as max_score,
+    sum(entries)::int as entries,
+    count(*)::int as days_logged
+from days
+group by week_start
+order by week_start;
+
+-- name: GetFoodCategories :many
+select * from food_categories order by item;
+
+-- name: UpsertFoodCategory :one
+insert into food_categories (item, category)
+values ($1, $2)
+on conflict (item) do update set category = excluded.category
+returning *;
+
+-- name: SoftDeleteSleep :many
+update sleep set deleted_at = now()
+where id = any(sqlc.arg(ids)::int[]) and deleted_at is null
+returning id;
+
+-- name: SoftDeleteDiet :many
+update diet set deleted_at = now()
+where id = any(sqlc.arg(ids)::int[]) and deleted_at is null
+returning id;
+
+-- name: SoftDeleteMenstrual :many
+update menstrual set deleted_at = now()
+where id = any(sqlc.arg(ids)::int[]) and deleted_at is null
+returning id;
+
+-- name: SoftDeleteSymptoms :many
+update symptoms set deleted_at = now()
+where id = any(sqlc.arg(ids)::int[]) and deleted_at is null
+returning id;
+
+-- name: InsertInsight :execrows
+insert into insights (kind, fingerprint, message, data)
+values ($1, $2, $3, $4)
+on conflict (fingerprint) do nothing;
+
+-- name: GetInsights :many
+select * from insights
+where dismissed_at is null or sqlc.arg(include_dismissed)::bool
+order by generated_at desc, id desc;
+
+-- name: DismissInsight :one
+update insights set dismissed_at = coalesce(dismissed_at, now())
+where id = $1
+returning *;
+
+-- name: GetAnalysisSnapshot :one
+select * from analysis_snapshot where id = 1;
+
+-- name: UpsertAnalysisSnapshot :one
+insert into analysis_snapshot (id, data, data_version, created_at)
+values (1, $1, $2, now())
+on conflict (id) do update set data = excluded.data, data_version = excluded.data_version, created_at = now()
+returning *;
+
+-- name: GetLastDataChange :one
+select changed_at from data_changes where id = 1;
+
+-- name: GetUsageStats :one
+with logged as (
+    select date from sleep where deleted_at is null
+    union select date from diet where deleted_at is null
+    union select date from menstrual where deleted_at is null
+    union select date from symptoms where deleted_at is null
+)
+select
+    (select count(*) from sleep where deleted_at is null)::int as sleep_records,
+    (select count(*) from diet where deleted_at is null)::int as diet_records,
+    (select count(*) from menstrual where deleted_at is null)::int as menstrual_records,
+    (select count(*) from symptoms where deleted_at is null)::int as symptom_records,
+    (select count(*) from journal)::int as journal_records,
+    (select count(*) from logged where date > current_date - 7)::int as active_days_7,
+    (select count(*) from logged where date > current_date - 30)::int as active_days_30;
+
+-- name: GetPeriodEventCounts :many
+select period_event, count(*)::int as count
+from menstrual
+where deleted_at is null
+group by period_event
+order by count desc, period_event;
+
+-- name: GetFlowLevelCounts :many
+select flow_level, count(*)::int as count
+from menstrual
+where deleted_at is null
+group by flow_level
+order by count desc, flow_level;
+
+-- name: GetTableNames :many
+select table_name::text from information_schema.tables
+where table_schema = current_schema()
+order by table_name;
+
+-- name: InsertShare :one
+insert into shares (token, data, expires_at)
+values ($1, $2, $3)
+returning *;
+
+-- name: GetActiveShare :one
+select * from shares
+where token = $1 and revoked_at is null and expires_at > now();
+
+-- name: RevokeShare :execrows
+update shares set revoked_at = now()
+where token = $1 and revoked_at is null;
+
+-- name: LockImports :exec
+-- Held until the end of the importing transaction
+select pg_advisory_xact_lock(hashtext('import'));
+
+-- name: UpsertWeather :exec
+insert into weather (date, pressure_hpa, humidity_pct, fetched_at)
+values ($1, $2, $3, now())
+on conflict (date) do update set pressure_hpa = excluded.pressure_hpa, humidity_pct = excluded.humidity_pct, fetched_at = now();
+
+-- name: GetAllWeather :many
+select * from weather order by date;
+
+-- name: PurgeSleepBefore :execrows
+-- Soft-deleted rows are purged too, retention covers them as well
+delete from sleep where date < $1;
+
+-- name: PurgeDietBefore :execrows
+delete from diet where date < $1;
+
+-- name: PurgeMenstrualBefore :execrows
+delete from menstrual where date < $1;
+
+-- name: PurgeSymptomsBefore :execrows
+delete from symptoms where date < $1;
+
+-- name: PurgeJournalBefore :execrows
+delete from journal where date < $1;
+
+-- name: PurgeCustomFactorsBefore :execrows
+delete from custom_factors where date < $1;
+
+-- name: PurgeOrphanedRecordVersions :execrows
+-- Prior versions of records that no longer exist
+delete from record_versions v
+where not exists (select 1 from sleep s where v.record_type = 'sleep' and s.id = v.record_id)
+    and not exists (select 1 from diet d where v.record_type = 'diet' and d.id = v.record_id)
+    and not exists (select 1 from menstrual m where v.record_type = 'menstrual' and m.id = v.record_id)
+    and not exists (select 1 from symptoms s where v.record_type = 'symptoms' and s.id = v.record_id);
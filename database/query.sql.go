@@ -7,12 +7,169 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const appendDietItem = `-- name: AppendDietItem :one
+update diet set items = array_append(items, $1::text),
+    item_details = item_details || jsonb_build_array(jsonb_build_object('name', $1::text)),
+    version = version + 1
+where id = $2 and deleted_at is null
+    and ($3::int is null or version = $3)
+returning id, meal, date, items, notes, contains_caffeine, contains_alcohol, deleted_at, item_details, source, version
+`
+
+type AppendDietItemParams struct {
+	Item            string
+	ID              int32
+	ExpectedVersion pgtype.Int4
+}
+
+// A null expected_version skips the version check
+func (q *Queries) AppendDietItem(ctx context.Context, arg AppendDietItemParams) (Diet, error) {
+	row := q.db.QueryRow(ctx, appendDietItem, arg.Item, arg.ID, arg.ExpectedVersion)
+	var i Diet
+	err := row.Scan(
+		&i.ID,
+		&i.Meal,
+		&i.Date,
+		&i.Items,
+		&i.Notes,
+		&i.ContainsCaffeine,
+		&i.ContainsAlcohol,
+		&i.DeletedAt,
+		&i.ItemDetails,
+		&i.Source,
+		&i.Version,
+	)
+	return i, err
+}
+
+const deleteDietByDateAndMeal = `-- name: DeleteDietByDateAndMeal :execrows
+delete from diet where date = $1 and meal = $2 and deleted_at is null
+`
+
+type DeleteDietByDateAndMealParams struct {
+	Date pgtype.Date
+	Meal pgtype.Text
+}
+
+func (q *Queries) DeleteDietByDateAndMeal(ctx context.Context, arg DeleteDietByDateAndMealParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteDietByDateAndMeal, arg.Date, arg.Meal)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteMenstrualByDate = `-- name: DeleteMenstrualByDate :execrows
+delete from menstrual where date = $1 and deleted_at is null
+`
+
+func (q *Queries) DeleteMenstrualByDate(ctx context.Context, date pgtype.Date) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteMenstrualByDate, date)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteSleepByDate = `-- name: DeleteSleepByDate :execrows
+delete from sleep where date = $1 and deleted_at is null
+`
+
+func (q *Queries) DeleteSleepByDate(ctx context.Context, date pgtype.Date) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteSleepByDate, date)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteSymptomsByDate = `-- name: DeleteSymptomsByDate :execrows
+delete from symptoms where date = $1 and deleted_at is null
+`
+
+func (q *Queries) DeleteSymptomsByDate(ctx context.Context, date pgtype.Date) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteSymptomsByDate, date)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const dismissInsight = `-- name: DismissInsight :one
+update insights set dismissed_at = coalesce(dismissed_at, now())
+where id = $1
+returning id, kind, fingerprint, message, data, generated_at, dismissed_at
+`
+
+func (q *Queries) DismissInsight(ctx context.Context, id int32) (Insight, error) {
+	row := q.db.QueryRow(ctx, dismissInsight, id)
+	var i Insight
+	err := row.Scan(
+		&i.ID,
+		&i.Kind,
+		&i.Fingerprint,
+		&i.Message,
+		&i.Data,
+		&i.GeneratedAt,
+		&i.DismissedAt,
+	)
+	return i, err
+}
+
+const getActiveShare = `-- name: GetActiveShare :one
+select token, data, created_at, expires_at, revoked_at from shares
+where token = $1 and revoked_at is null and expires_at > now()
+`
+
+func (q *Queries) GetActiveShare(ctx context.Context, token string) (Share, error) {
+	row := q.db.QueryRow(ctx, getActiveShare, token)
+	var i Share
+	err := row.Scan(
+		&i.Token,
+		&i.Data,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getAllCustomFactors = `-- name: GetAllCustomFactors :many
+select id, factor_name, date, present from custom_factors order by date, factor_name
+`
+
+func (q *Queries) GetAllCustomFactors(ctx context.Context) ([]CustomFactor, error) {
+	rows, err := q.db.Query(ctx, getAllCustomFactors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CustomFactor
+	for rows.Next() {
+		var i CustomFactor
+		if err := rows.Scan(
+			&i.ID,
+			&i.FactorName,
+			&i.Date,
+			&i.Present,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAllDiet = `-- name: GetAllDiet :many
-select id, meal, date, items, notes from diet
+select id, meal, date, items, notes, contains_caffeine, contains_alcohol, deleted_at, item_details, source, version from diet where deleted_at is null
 `
 
 func (q *Queries) GetAllDiet(ctx context.Context) ([]Diet, error) {
@@ -30,6 +187,12 @@ func (q *Queries) GetAllDiet(ctx context.Context) ([]Diet, error) {
 			&i.Date,
 			&i.Items,
 			&i.Notes,
+			&i.ContainsCaffeine,
+			&i.ContainsAlcohol,
+			&i.DeletedAt,
+			&i.ItemDetails,
+			&i.Source,
+			&i.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -41,8 +204,32 @@ func (q *Queries) GetAllDiet(ctx context.Context) ([]Diet, error) {
 	return items, nil
 }
 
+const getAllJournal = `-- name: GetAllJournal :many
+select id, date, text from journal order by date, id
+`
+
+func (q *Queries) GetAllJournal(ctx context.Context) ([]Journal, error) {
+	rows, err := q.db.Query(ctx, getAllJournal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Journal
+	for rows.Next() {
+		var i Journal
+		if err := rows.Scan(&i.ID, &i.Date, &i.Text); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getAllMenstrual = `-- name: GetAllMenstrual :many
-select id, period_event, date, flow_level, notes from menstrual
+select id, period_event, date, flow_level, notes, deleted_at, source from menstrual where deleted_at is null
 `
 
 func (q *Queries) GetAllMenstrual(ctx context.Context) ([]Menstrual, error) {
@@ -60,6 +247,290 @@ func (q *Queries) GetAllMenstrual(ctx context.Context) ([]Menstrual, error) {
 			&i.Date,
 			&i.FlowLevel,
 			&i.Notes,
+			&i.DeletedAt,
+			&i.Source,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllSettings = `-- name: GetAllSettings :many
+select key, value, updated_at from settings order by key
+`
+
+func (q *Queries) GetAllSettings(ctx context.Context) ([]Setting, error) {
+	rows, err := q.db.Query(ctx, getAllSettings)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Setting
+	for rows.Next() {
+		var i Setting
+		if err := rows.Scan(&i.Key, &i.Value, &i.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllSleep = `-- name: GetAllSleep :many
+select id, date, duration, quality, disruptions, notes, deleted_at, source from sleep where deleted_at is null
+`
+
+func (q *Queries) GetAllSleep(ctx context.Context) ([]Sleep, error) {
+	rows, err := q.db.Query(ctx, getAllSleep)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Sleep
+	for rows.Next() {
+		var i Sleep
+		if err := rows.Scan(
+			&i.ID,
+			&i.Date,
+			&i.Duration,
+			&i.Quality,
+			&i.Disruptions,
+			&i.Notes,
+			&i.DeletedAt,
+			&i.Source,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllSymptoms = `-- name: GetAllSymptoms :many
+select id, date, nausea, fatigue, pain, notes, deleted_at, source from symptoms where deleted_at is null
+`
+
+func (q *Queries) GetAllSymptoms(ctx context.Context) ([]Symptom, error) {
+	rows, err := q.db.Query(ctx, getAllSymptoms)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Symptom
+	for rows.Next() {
+		var i Symptom
+		if err := rows.Scan(
+			&i.ID,
+			&i.Date,
+			&i.Nausea,
+			&i.Fatigue,
+			&i.Pain,
+			&i.Notes,
+			&i.DeletedAt,
+			&i.Source,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllWeather = `-- name: GetAllWeather :many
+select date, pressure_hpa, humidity_pct, fetched_at from weather order by date
+`
+
+func (q *Queries) GetAllWeather(ctx context.Context) ([]Weather, error) {
+	rows, err := q.db.Query(ctx, getAllWeather)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Weather
+	for rows.Next() {
+		var i Weather
+		if err := rows.Scan(
+			&i.Date,
+			&i.PressureHpa,
+			&i.HumidityPct,
+			&i.FetchedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAnalysisSnapshot = `-- name: GetAnalysisSnapshot :one
+select id, data, data_version, created_at from analysis_snapshot where id = 1
+`
+
+func (q *Queries) GetAnalysisSnapshot(ctx context.Context) (AnalysisSnapshot, error) {
+	row := q.db.QueryRow(ctx, getAnalysisSnapshot)
+	var i AnalysisSnapshot
+	err := row.Scan(
+		&i.ID,
+		&i.Data,
+		&i.DataVersion,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getDailySymptomAverages = `-- name: GetDailySymptomAverages :many
+select date,
+    avg((coalesce(nausea, 0) + coalesce(fatigue, 0) + coalesce(pain, 0))::float8 / num_nonnulls(nausea, fatigue, pain))::float8 as mean_score,
+    max(greatest(nausea, fatigue, pain))::float8 as max_score,
+    count(*)::int as entries
+from symptoms
+-- Components left out of a partial entry are null and don't count
+where deleted_at is null and num_nonnulls(nausea, fatigue, pain) > 0
+    and ($1::text[] is null or source = any($1::text[]))
+group by date
+order by date
+`
+
+type GetDailySymptomAveragesRow struct {
+	Date      pgtype.Date
+	MeanScore float64
+	MaxScore  float64
+	Entries   int32
+}
+
+func (q *Queries) GetDailySymptomAverages(ctx context.Context, sources []string) ([]GetDailySymptomAveragesRow, error) {
+	rows, err := q.db.Query(ctx, getDailySymptomAverages, sources)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDailySymptomAveragesRow
+	for rows.Next() {
+		var i GetDailySymptomAveragesRow
+		if err := rows.Scan(
+			&i.Date,
+			&i.MeanScore,
+			&i.MaxScore,
+			&i.Entries,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDietVersion = `-- name: GetDietVersion :one
+select version from diet where id = $1 and deleted_at is null
+`
+
+func (q *Queries) GetDietVersion(ctx context.Context, id int32) (int32, error) {
+	row := q.db.QueryRow(ctx, getDietVersion, id)
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
+const getFlowLevelCounts = `-- name: GetFlowLevelCounts :many
+select flow_level, count(*)::int as count
+from menstrual
+where deleted_at is null
+group by flow_level
+order by count desc, flow_level
+`
+
+type GetFlowLevelCountsRow struct {
+	FlowLevel pgtype.Text
+	Count     int32
+}
+
+func (q *Queries) GetFlowLevelCounts(ctx context.Context) ([]GetFlowLevelCountsRow, error) {
+	rows, err := q.db.Query(ctx, getFlowLevelCounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFlowLevelCountsRow
+	for rows.Next() {
+		var i GetFlowLevelCountsRow
+		if err := rows.Scan(&i.FlowLevel, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFoodCategories = `-- name: GetFoodCategories :many
+select item, category from food_categories order by item
+`
+
+func (q *Queries) GetFoodCategories(ctx context.Context) ([]FoodCategory, error) {
+	rows, err := q.db.Query(ctx, getFoodCategories)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FoodCategory
+	for rows.Next() {
+		var i FoodCategory
+		if err := rows.Scan(&i.Item, &i.Category); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getInsights = `-- name: GetInsights :many
+select id, kind, fingerprint, message, data, generated_at, dismissed_at from insights
+where dismissed_at is null or $1::bool
+order by generated_at desc, id desc
+`
+
+func (q *Queries) GetInsights(ctx context.Context, includeDismissed bool) ([]Insight, error) {
+	rows, err := q.db.Query(ctx, getInsights, includeDismissed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Insight
+	for rows.Next() {
+		var i Insight
+		if err := rows.Scan(
+			&i.ID,
+			&i.Kind,
+			&i.Fingerprint,
+			&i.Message,
+			&i.Data,
+			&i.GeneratedAt,
+			&i.DismissedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -71,30 +542,118 @@ func (q *Queries) GetAllMenstrual(ctx context.Context) ([]Menstrual, error) {
 	return items, nil
 }
 
-const getAllSleep = `-- name: GetAllSleep :many
-select id, date, duration, quality, disruptions, notes from sleep
+const getLastDataChange = `-- name: GetLastDataChange :one
+select changed_at from data_changes where id = 1
+`
+
+func (q *Queries) GetLastDataChange(ctx context.Context) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, getLastDataChange)
+	var changed_at pgtype.Timestamptz
+	err := row.Scan(&changed_at)
+	return changed_at, err
+}
+
+const getPeriodEventCounts = `-- name: GetPeriodEventCounts :many
+select period_event, count(*)::int as count
+from menstrual
+where deleted_at is null
+group by period_event
+order by count desc, period_event
+`
+
+type GetPeriodEventCountsRow struct {
+	PeriodEvent pgtype.Text
+	Count       int32
+}
+
+func (q *Queries) GetPeriodEventCounts(ctx context.Context) ([]GetPeriodEventCountsRow, error) {
+	rows, err := q.db.Query(ctx, getPeriodEventCounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPeriodEventCountsRow
+	for rows.Next() {
+		var i GetPeriodEventCountsRow
+		if err := rows.Scan(&i.PeriodEvent, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecordHistory = `-- name: GetRecordHistory :many
+select id, record_type, record_id, data, changed_fields, changed_at from record_versions
+where record_type = $1 and record_id = $2
+order by changed_at, id
+`
+
+type GetRecordHistoryParams struct {
+	RecordType string
+	RecordID   int32
+}
+
+func (q *Queries) GetRecordHistory(ctx context.Context, arg GetRecordHistoryParams) ([]RecordVersion, error) {
+	rows, err := q.db.Query(ctx, getRecordHistory, arg.RecordType, arg.RecordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RecordVersion
+	for rows.Next() {
+		var i RecordVersion
+		if err := rows.Scan(
+			&i.ID,
+			&i.RecordType,
+			&i.RecordID,
+			&i.Data,
+			&i.ChangedFields,
+			&i.ChangedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSetting = `-- name: GetSetting :one
+select key, value, updated_at from settings where key = $1
+`
+
+func (q *Queries) GetSetting(ctx context.Context, key string) (Setting, error) {
+	row := q.db.QueryRow(ctx, getSetting, key)
+	var i Setting
+	err := row.Scan(&i.Key, &i.Value, &i.UpdatedAt)
+	return i, err
+}
+
+const getTableNames = `-- name: GetTableNames :many
+select table_name::text from information_schema.tables
+where table_schema = current_schema()
+order by table_name
 `
 
-func (q *Queries) GetAllSleep(ctx context.Context) ([]Sleep, error) {
-	rows, err := q.db.Query(ctx, getAllSleep)
+func (q *Queries) GetTableNames(ctx context.Context) ([]string, error) {
+	rows, err := q.db.Query(ctx, getTableNames)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Sleep
+	var items []string
 	for rows.Next() {
-		var i Sleep
-		if err := rows.Scan(
-			&i.ID,
-			&i.Date,
-			&i.Duration,
-			&i.Quality,
-			&i.Disruptions,
-			&i.Notes,
-		); err != nil {
+		var table_name string
+		if err := rows.Scan(&table_name); err != nil {
 			return nil, err
 		}
-		items = append(items, i)
+		items = append(items, table_name)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -102,26 +661,115 @@ func (q *Queries) GetAllSleep(ctx context.Context) ([]Sleep, error) {
 	return items, nil
 }
 
-const getAllSymptoms = `-- name: GetAllSymptoms :many
-select id, date, nausea, fatigue, pain, notes from symptoms
+const getUsageStats = `-- name: GetUsageStats :one
+with logged as (
+    select date from sleep where deleted_at is null
+    union select date from diet where deleted_at is null
+    union select date from menstrual where deleted_at is null
+    union select date from symptoms where deleted_at is null
+)
+select
+    (select count(*) from sleep where deleted_at is null)::int as sleep_records,
+    (select count(*) from diet where deleted_at is null)::int as diet_records,
+    (select count(*) from menstrual where deleted_at is null)::int as menstrual_records,
+    (select count(*) from symptoms where deleted_at is null)::int as symptom_records,
+    (select count(*) from journal)::int as journal_records,
+    (select count(*) from logged where date > current_date - 7)::int as active_days_7,
+    (select count(*) from logged where date > current_date - 30)::int as active_days_30
 `
 
-func (q *Queries) GetAllSymptoms(ctx context.Context) ([]Symptom, error) {
-	rows, err := q.db.Query(ctx, getAllSymptoms)
+type GetUsageStatsRow struct {
+	SleepRecords     int32
+	DietRecords      int32
+	MenstrualRecords int32
+	SymptomRecords   int32
+	JournalRecords   int32
+	ActiveDays7      int32
+	ActiveDays30     int32
+}
+
+func (q *Queries) GetUsageStats(ctx context.Context) (GetUsageStatsRow, error) {
+	row := q.db.QueryRow(ctx, getUsageStats)
+	var i GetUsageStatsRow
+	err := row.Scan(
+		&i.SleepRecords,
+		&i.DietRecords,
+		&i.MenstrualRecords,
+		&i.SymptomRecords,
+		&i.JournalRecords,
+		&i.ActiveDays7,
+		&i.ActiveDays30,
+	)
+	return i, err
+}
+
+const getWeeklySymptomAverages = `-- name: GetWeeklySymptomAverages :many
+with days as (
+    select date,
+        avg(nausea)::float8 as nausea,
+        avg(fatigue)::float8 as fatigue,
+        avg(pain)::float8 as pain,
+        avg((coalesce(nausea, 0) + coalesce(fatigue, 0) + coalesce(pain, 0))::float8 / num_nonnulls(nausea, fatigue, pain))::float8 as mean_score,
+        max(greatest(nausea, fatigue, pain))::float8 as max_score,
+        count(*)::int as entries
+    from symptoms
+    where deleted_at is null and num_nonnulls(nausea, fatigue, pain) > 0
+        and ($1::date is null or date >= $1)
+        and ($2::date is null or date < $2)
+        and ($3::text[] is null or source = any($3::text[]))
+    group by date
+)
+select date_trunc('week', date)::date as week_start,
+    avg(nausea)::float8 as nausea,
+    avg(fatigue)::float8 as fatigue,
+    avg(pain)::float8 as pain,
+    avg(mean_score)::float8 as mean_score,
+    avg(max_score)::float8 as max_score,
+    sum(entries)::int as entries,
+    count(*)::int as days_logged
+from days
+group by week_start
+order by week_start
+`
+
+type GetWeeklySymptomAveragesParams struct {
+	FromDate pgtype.Date
+	ToDate   pgtype.Date
+	Sources  []string
+}
+
+type GetWeeklySymptomAveragesRow struct {
+	WeekStart  pgtype.Date
+	Nausea     pgtype.Float8
+	Fatigue    pgtype.Float8
+	Pain       pgtype.Float8
+	MeanScore  float64
+	MaxScore   float64
+	Entries    int32
+	DaysLogged int32
+}
+
+// Weeks start on Monday. Each day is scored as in GetDailySymptomAverages
+// and the week averages its days, so days with several entries don't weigh
+// more. A component never logged in the week is null.
+func (q *Queries) GetWeeklySymptomAverages(ctx context.Context, arg GetWeeklySymptomAveragesParams) ([]GetWeeklySymptomAveragesRow, error) {
+	rows, err := q.db.Query(ctx, getWeeklySymptomAverages, arg.FromDate, arg.ToDate, arg.Sources)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Symptom
+	var items []GetWeeklySymptomAveragesRow
 	for rows.Next() {
-		var i Symptom
+		var i GetWeeklySymptomAveragesRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.Date,
+			&i.WeekStart,
 			&i.Nausea,
 			&i.Fatigue,
 			&i.Pain,
-			&i.Notes,
+			&i.MeanScore,
+			&i.MaxScore,
+			&i.Entries,
+			&i.DaysLogged,
 		); err != nil {
 			return nil, err
 		}
@@ -134,16 +782,20 @@ func (q *Queries) GetAllSymptoms(ctx context.Context) ([]Symptom, error) {
 }
 
 const insertDiet = `-- name: InsertDiet :one
-insert into diet (meal, date, items, notes)
-values ($1, $2, $3, $4)
-returning id, meal, date, items, notes
+insert into diet (meal, date, items, notes, contains_caffeine, contains_alcohol, item_details, source)
+values ($1, $2, $3, $4, $5, $6, $7, coalesce($8, 'manual'))
+returning id, meal, date, items, notes, contains_caffeine, contains_alcohol, deleted_at, item_details, source, version
 `
 
 type InsertDietParams struct {
-	Meal  pgtype.Text
-	Date  pgtype.Date
-	Items []string
-	Notes pgtype.Text
+	Meal             pgtype.Text
+	Date             pgtype.Date
+	Items            []string
+	Notes            pgtype.Text
+	ContainsCaffeine bool
+	ContainsAlcohol  bool
+	ItemDetails      json.RawMessage
+	Source           pgtype.Text
 }
 
 func (q *Queries) InsertDiet(ctx context.Context, arg InsertDietParams) (Diet, error) {
@@ -152,6 +804,10 @@ func (q *Queries) InsertDiet(ctx context.Context, arg InsertDietParams) (Diet, e
 		arg.Date,
 		arg.Items,
 		arg.Notes,
+		arg.ContainsCaffeine,
+		arg.ContainsAlcohol,
+		arg.ItemDetails,
+		arg.Source,
 	)
 	var i Diet
 	err := row.Scan(
@@ -160,14 +816,64 @@ func (q *Queries) InsertDiet(ctx context.Context, arg InsertDietParams) (Diet, e
 		&i.Date,
 		&i.Items,
 		&i.Notes,
+		&i.ContainsCaffeine,
+		&i.ContainsAlcohol,
+		&i.DeletedAt,
+		&i.ItemDetails,
+		&i.Source,
+		&i.Version,
 	)
 	return i, err
 }
 
-const insertMenstrual = `-- name: InsertMenstrual :one
-insert into menstrual (period_event, date, flow_level, notes)
+const insertInsight = `-- name: InsertInsight :execrows
+insert into insights (kind, fingerprint, message, data)
 values ($1, $2, $3, $4)
-returning id, period_event, date, flow_level, notes
+on conflict (fingerprint) do nothing
+`
+
+type InsertInsightParams struct {
+	Kind        string
+	Fingerprint string
+	Message     string
+	Data        []byte
+}
+
+func (q *Queries) InsertInsight(ctx context.Context, arg InsertInsightParams) (int64, error) {
+	result, err := q.db.Exec(ctx, insertInsight,
+		arg.Kind,
+		arg.Fingerprint,
+		arg.Message,
+		arg.Data,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const insertJournal = `-- name: InsertJournal :one
+insert into journal (date, text)
+values ($1, $2)
+returning id, date, text
+`
+
+type InsertJournalParams struct {
+	Date pgtype.Date
+	Text string
+}
+
+func (q *Queries) InsertJournal(ctx context.Context, arg InsertJournalParams) (Journal, error) {
+	row := q.db.QueryRow(ctx, insertJournal, arg.Date, arg.Text)
+	var i Journal
+	err := row.Scan(&i.ID, &i.Date, &i.Text)
+	return i, err
+}
+
+const insertMenstrual = `-- name: InsertMenstrual :one
+insert into menstrual (period_event, date, flow_level, notes, source)
+values ($1, $2, $3, $4, coalesce($5, 'manual'))
+returning id, period_event, date, flow_level, notes, deleted_at, source
 `
 
 type InsertMenstrualParams struct {
@@ -175,6 +881,7 @@ type InsertMenstrualParams struct {
 	Date        pgtype.Date
 	FlowLevel   pgtype.Text
 	Notes       pgtype.Text
+	Source      pgtype.Text
 }
 
 func (q *Queries) InsertMenstrual(ctx context.Context, arg InsertMenstrualParams) (Menstrual, error) {
@@ -183,6 +890,7 @@ func (q *Queries) InsertMenstrual(ctx context.Context, arg InsertMenstrualParams
 		arg.Date,
 		arg.FlowLevel,
 		arg.Notes,
+		arg.Source,
 	)
 	var i Menstrual
 	err := row.Scan(
@@ -191,14 +899,41 @@ func (q *Queries) InsertMenstrual(ctx context.Context, arg InsertMenstrualParams
 		&i.Date,
 		&i.FlowLevel,
 		&i.Notes,
+		&i.DeletedAt,
+		&i.Source,
+	)
+	return i, err
+}
+
+const insertShare = `-- name: InsertShare :one
+insert into shares (token, data, expires_at)
+values ($1, $2, $3)
+returning token, data, created_at, expires_at, revoked_at
+`
+
+type InsertShareParams struct {
+	Token     string
+	Data      []byte
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) InsertShare(ctx context.Context, arg InsertShareParams) (Share, error) {
+	row := q.db.QueryRow(ctx, insertShare, arg.Token, arg.Data, arg.ExpiresAt)
+	var i Share
+	err := row.Scan(
+		&i.Token,
+		&i.Data,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
 	)
 	return i, err
 }
 
 const insertSleep = `-- name: InsertSleep :one
-insert into sleep (date, duration, quality, disruptions, notes)
-values ($1, $2, $3, $4, $5)
-returning id, date, duration, quality, disruptions, notes
+insert into sleep (date, duration, quality, disruptions, notes, source)
+values ($1, $2, $3, $4, $5, coalesce($6, 'manual'))
+returning id, date, duration, quality, disruptions, notes, deleted_at, source
 `
 
 type InsertSleepParams struct {
@@ -207,6 +942,7 @@ type InsertSleepParams struct {
 	Quality     pgtype.Int4
 	Disruptions pgtype.Text
 	Notes       pgtype.Text
+	Source      pgtype.Text
 }
 
 func (q *Queries) InsertSleep(ctx context.Context, arg InsertSleepParams) (Sleep, error) {
@@ -216,6 +952,7 @@ func (q *Queries) InsertSleep(ctx context.Context, arg InsertSleepParams) (Sleep
 		arg.Quality,
 		arg.Disruptions,
 		arg.Notes,
+		arg.Source,
 	)
 	var i Sleep
 	err := row.Scan(
@@ -225,14 +962,16 @@ func (q *Queries) InsertSleep(ctx context.Context, arg InsertSleepParams) (Sleep
 		&i.Quality,
 		&i.Disruptions,
 		&i.Notes,
+		&i.DeletedAt,
+		&i.Source,
 	)
 	return i, err
 }
 
 const insertSymptoms = `-- name: InsertSymptoms :one
-insert into symptoms (date, nausea, fatigue, pain, notes)
-values ($1, $2, $3, $4, $5)
-returning id, date, nausea, fatigue, pain, notes
+insert into symptoms (date, nausea, fatigue, pain, notes, source)
+values ($1, $2, $3, $4, $5, coalesce($6, 'manual'))
+returning id, date, nausea, fatigue, pain, notes, deleted_at, source
 `
 
 type InsertSymptomsParams struct {
@@ -241,6 +980,7 @@ type InsertSymptomsParams struct {
 	Fatigue pgtype.Int4
 	Pain    pgtype.Int4
 	Notes   pgtype.Text
+	Source  pgtype.Text
 }
 
 func (q *Queries) InsertSymptoms(ctx context.Context, arg InsertSymptomsParams) (Symptom, error) {
@@ -250,6 +990,7 @@ func (q *Queries) InsertSymptoms(ctx context.Context, arg InsertSymptomsParams)
 		arg.Fatigue,
 		arg.Pain,
 		arg.Notes,
+		arg.Source,
 	)
 	var i Symptom
 	err := row.Scan(
@@ -259,6 +1000,413 @@ func (q *Queries) InsertSymptoms(ctx context.Context, arg InsertSymptomsParams)
 		&i.Fatigue,
 		&i.Pain,
 		&i.Notes,
+		&i.DeletedAt,
+		&i.Source,
+	)
+	return i, err
+}
+
+const lockImports = `-- name: LockImports :exec
+select pg_advisory_xact_lock(hashtext('import'))
+`
+
+// Held until the end of the importing transaction
+func (q *Queries) LockImports(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, lockImports)
+	return err
+}
+
+const purgeCustomFactorsBefore = `-- name: PurgeCustomFactorsBefore :execrows
+delete from custom_factors where date < $1
+`
+
+func (q *Queries) PurgeCustomFactorsBefore(ctx context.Context, date pgtype.Date) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeCustomFactorsBefore, date)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeDietBefore = `-- name: PurgeDietBefore :execrows
+delete from diet where date < $1
+`
+
+func (q *Queries) PurgeDietBefore(ctx context.Context, date pgtype.Date) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeDietBefore, date)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeJournalBefore = `-- name: PurgeJournalBefore :execrows
+delete from journal where date < $1
+`
+
+func (q *Queries) PurgeJournalBefore(ctx context.Context, date pgtype.Date) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeJournalBefore, date)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeMenstrualBefore = `-- name: PurgeMenstrualBefore :execrows
+delete from menstrual where date < $1
+`
+
+func (q *Queries) PurgeMenstrualBefore(ctx context.Context, date pgtype.Date) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeMenstrualBefore, date)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeOrphanedRecordVersions = `-- name: PurgeOrphanedRecordVersions :execrows
+delete from record_versions v
+where not exists (select 1 from sleep s where v.record_type = 'sleep' and s.id = v.record_id)
+    and not exists (select 1 from diet d where v.record_type = 'diet' and d.id = v.record_id)
+    and not exists (select 1 from menstrual m where v.record_type = 'menstrual' and m.id = v.record_id)
+    and not exists (select 1 from symptoms s where v.record_type = 'symptoms' and s.id = v.record_id)
+`
+
+// Prior versions of records that no longer exist
+func (q *Queries) PurgeOrphanedRecordVersions(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeOrphanedRecordVersions)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeSleepBefore = `-- name: PurgeSleepBefore :execrows
+delete from sleep where date < $1
+`
+
+// Soft-deleted rows are purged too, retention covers them as well
+func (q *Queries) PurgeSleepBefore(ctx context.Context, date pgtype.Date) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeSleepBefore, date)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeSymptomsBefore = `-- name: PurgeSymptomsBefore :execrows
+delete from symptoms where date < $1
+`
+
+func (q *Queries) PurgeSymptomsBefore(ctx context.Context, date pgtype.Date) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeSymptomsBefore, date)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const removeDietItem = `-- name: RemoveDietItem :one
+update diet set items = array_remove(items, $1::text),
+    item_details = (
+        select jsonb_agg(e) from jsonb_array_elements(item_details) e
+        where e ->> 'name' <> $1::text
+    ),
+    version = version + 1
+where id = $2 and deleted_at is null
+    and ($3::int is null or version = $3)
+returning id, meal, date, items, notes, contains_caffeine, contains_alcohol, deleted_at, item_details, source, version
+`
+
+type RemoveDietItemParams struct {
+	Item            string
+	ID              int32
+	ExpectedVersion pgtype.Int4
+}
+
+// A null expected_version skips the version check
+func (q *Queries) RemoveDietItem(ctx context.Context, arg RemoveDietItemParams) (Diet, error) {
+	row := q.db.QueryRow(ctx, removeDietItem, arg.Item, arg.ID, arg.ExpectedVersion)
+	var i Diet
+	err := row.Scan(
+		&i.ID,
+		&i.Meal,
+		&i.Date,
+		&i.Items,
+		&i.Notes,
+		&i.ContainsCaffeine,
+		&i.ContainsAlcohol,
+		&i.DeletedAt,
+		&i.ItemDetails,
+		&i.Source,
+		&i.Version,
+	)
+	return i, err
+}
+
+const revokeShare = `-- name: RevokeShare :execrows
+update shares set revoked_at = now()
+where token = $1 and revoked_at is null
+`
+
+func (q *Queries) RevokeShare(ctx context.Context, token string) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeShare, token)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const softDeleteDiet = `-- name: SoftDeleteDiet :many
+update diet set deleted_at = now()
+where id = any($1::int[]) and deleted_at is null
+returning id
+`
+
+func (q *Queries) SoftDeleteDiet(ctx context.Context, ids []int32) ([]int32, error) {
+	rows, err := q.db.Query(ctx, softDeleteDiet, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteMenstrual = `-- name: SoftDeleteMenstrual :many
+update menstrual set deleted_at = now()
+where id = any($1::int[]) and deleted_at is null
+returning id
+`
+
+func (q *Queries) SoftDeleteMenstrual(ctx context.Context, ids []int32) ([]int32, error) {
+	rows, err := q.db.Query(ctx, softDeleteMenstrual, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteSleep = `-- name: SoftDeleteSleep :many
+update sleep set deleted_at = now()
+where id = any($1::int[]) and deleted_at is null
+returning id
+`
+
+func (q *Queries) SoftDeleteSleep(ctx context.Context, ids []int32) ([]int32, error) {
+	rows, err := q.db.Query(ctx, softDeleteSleep, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteSymptoms = `-- name: SoftDeleteSymptoms :many
+update symptoms set deleted_at = now()
+where id = any($1::int[]) and deleted_at is null
+returning id
+`
+
+func (q *Queries) SoftDeleteSymptoms(ctx context.Context, ids []int32) ([]int32, error) {
+	rows, err := q.db.Query(ctx, softDeleteSymptoms, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateDietFlags = `-- name: UpdateDietFlags :execrows
+update diet set contains_caffeine = $2, contains_alcohol = $3
+where id = $1 and (contains_caffeine <> $2 or contains_alcohol <> $3)
+`
+
+type UpdateDietFlagsParams struct {
+	ID               int32
+	ContainsCaffeine bool
+	ContainsAlcohol  bool
+}
+
+func (q *Queries) UpdateDietFlags(ctx context.Context, arg UpdateDietFlagsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateDietFlags, arg.ID, arg.ContainsCaffeine, arg.ContainsAlcohol)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateDietItems = `-- name: UpdateDietItems :execrows
+update diet set items = $2, item_details = $3, contains_caffeine = $4, contains_alcohol = $5, version = version + 1
+where id = $1 and deleted_at is null
+`
+
+type UpdateDietItemsParams struct {
+	ID               int32
+	Items            []string
+	ItemDetails      json.RawMessage
+	ContainsCaffeine bool
+	ContainsAlcohol  bool
+}
+
+func (q *Queries) UpdateDietItems(ctx context.Context, arg UpdateDietItemsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateDietItems,
+		arg.ID,
+		arg.Items,
+		arg.ItemDetails,
+		arg.ContainsCaffeine,
+		arg.ContainsAlcohol,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const upsertAnalysisSnapshot = `-- name: UpsertAnalysisSnapshot :one
+insert into analysis_snapshot (id, data, data_version, created_at)
+values (1, $1, $2, now())
+on conflict (id) do update set data = excluded.data, data_version = excluded.data_version, created_at = now()
+returning id, data, data_version, created_at
+`
+
+type UpsertAnalysisSnapshotParams struct {
+	Data        []byte
+	DataVersion string
+}
+
+func (q *Queries) UpsertAnalysisSnapshot(ctx context.Context, arg UpsertAnalysisSnapshotParams) (AnalysisSnapshot, error) {
+	row := q.db.QueryRow(ctx, upsertAnalysisSnapshot, arg.Data, arg.DataVersion)
+	var i AnalysisSnapshot
+	err := row.Scan(
+		&i.ID,
+		&i.Data,
+		&i.DataVersion,
+		&i.CreatedAt,
 	)
 	return i, err
 }
+
+const upsertCustomFactor = `-- name: UpsertCustomFactor :one
+insert into custom_factors (factor_name, date, present)
+values ($1, $2, $3)
+on conflict (factor_name, date) do update set present = excluded.present
+returning id, factor_name, date, present
+`
+
+type UpsertCustomFactorParams struct {
+	FactorName string
+	Date       pgtype.Date
+	Present    bool
+}
+
+func (q *Queries) UpsertCustomFactor(ctx context.Context, arg UpsertCustomFactorParams) (CustomFactor, error) {
+	row := q.db.QueryRow(ctx, upsertCustomFactor, arg.FactorName, arg.Date, arg.Present)
+	var i CustomFactor
+	err := row.Scan(
+		&i.ID,
+		&i.FactorName,
+		&i.Date,
+		&i.Present,
+	)
+	return i, err
+}
+
+const upsertFoodCategory = `-- name: UpsertFoodCategory :one
+insert into food_categories (item, category)
+values ($1, $2)
+on conflict (item) do update set category = excluded.category
+returning item, category
+`
+
+type UpsertFoodCategoryParams struct {
+	Item     string
+	Category string
+}
+
+func (q *Queries) UpsertFoodCategory(ctx context.Context, arg UpsertFoodCategoryParams) (FoodCategory, error) {
+	row := q.db.QueryRow(ctx, upsertFoodCategory, arg.Item, arg.Category)
+	var i FoodCategory
+	err := row.Scan(&i.Item, &i.Category)
+	return i, err
+}
+
+const upsertSetting = `-- name: UpsertSetting :one
+insert into settings (key, value, updated_at)
+values ($1, $2, now())
+on conflict (key) do update set value = excluded.value, updated_at = now()
+returning key, value, updated_at
+`
+
+type UpsertSettingParams struct {
+	Key   string
+	Value []byte
+}
+
+func (q *Queries) UpsertSetting(ctx context.Context, arg UpsertSettingParams) (Setting, error) {
+	row := q.db.QueryRow(ctx, upsertSetting, arg.Key, arg.Value)
+	var i Setting
+	err := row.Scan(&i.Key, &i.Value, &i.UpdatedAt)
+	return i, err
+}
+
+const upsertWeather = `-- name: UpsertWeather :exec
+insert into weather (date, pressure_hpa, humidity_pct, fetched_at)
+values ($1, $2, $3, now())
+on conflict (date) do update set pressure_hpa = excluded.pressure_hpa, humidity_pct = excluded.humidity_pct, fetched_at = now()
+`
+
+type UpsertWeatherParams struct {
+	Date        pgtype.Date
+	PressureHpa pgtype.Float8
+	HumidityPct pgtype.Float8
+}
+
+func (q *Queries) UpsertWeather(ctx context.Context, arg UpsertWeatherParams) error {
+	_, err := q.db.Exec(ctx, upsertWeather, arg.Date, arg.PressureHpa, arg.HumidityPct)
+	return err
+}
@@ -0,0 +1,9 @@
+package database
+
+import _ "embed"
+
+// Schema is schema.sql. Every statement in it is idempotent, so it can be
+// applied to a database that is already up to date.
+//
+//go:embed schema.sql
+var Schema string
@@ -22,6 +22,9 @@ create table if not exists diet (
     notes text
 );
 
+alter table diet add column if not exists contains_caffeine boolean not null default false;
+alter table diet add column if not exists contains_alcohol boolean not null default false;
+
 create table if not exists menstrual (
     id serial primary key,
     period_event text, -- start, end, ovulation, etc.
@@ -38,4 +41,175 @@ create table if not exists symptoms (
     fatigue integer, -- 1 to 10 scale
     pain integer, -- 1 to 10 scale
     notes text
-);
\ No newline at end of file
+);
+
+create table if not exists record_versions (
+    id serial primary key,
+    record_type text not null, -- sleep, diet, menstrual, symptoms
+    record_id integer not null,
+    data jsonb not null, -- full row as it was before the update
+    changed_fields text[] not null,
+    changed_at timestamptz not null default now()
+);
+
+-- Snapshot the prior row whenever a tracked record is updated
+create or replace function record_version() returns trigger as $$
+begin
+    insert into record_versions (record_type, record_id, data, changed_fields)
+    select tg_table_name, old.id, to_jsonb(old), coalesce(array_agg(n.key), '{}')
+    from jsonb_each(to_jsonb(new)) n
+    where n.value is distinct from to_jsonb(old) -> n.key;
+    return new;
+end;
+$$ language plpgsql;
+
+create or replace trigger sleep_versions before update on sleep
+    for each row execute function record_version();
+create or replace trigger diet_versions before update on diet
+    for each row execute function record_version();
+create or replace trigger menstrual_versions before update on menstrual
+    for each row execute function record_version();
+create or replace trigger symptoms_versions before update on symptoms
+    for each row execute function record_version();
+
+create table if not exists settings (
+    key text primary key,
+    value jsonb not null,
+    updated_at timestamptz not null default now()
+);
+
+create table if not exists food_categories (
+    item text primary key, -- normalized diet item, e.g. salmon
+    category text not null -- e.g. fish
+);
+
+-- Common items; user additions and overrides go through the API
+insert into food_categories (item, category) values
+    ('salmon', 'fish'), ('tuna', 'fish'), ('cod', 'fish'), ('sardines', 'fish'), ('mackerel', 'fish'),
+    ('shrimp', 'shellfish'), ('prawns', 'shellfish'), ('crab', 'shellfish'), ('lobster', 'shellfish'),
+    ('chicken', 'poultry'), ('turkey', 'poultry'),
+    ('beef', 'red meat'), ('pork', 'red meat'), ('lamb', 'red meat'), ('bacon', 'red meat'), ('sausage', 'red meat'),
+    ('milk', 'dairy'), ('cheese', 'dairy'), ('yogurt', 'dairy'), ('butter', 'dairy'), ('ice cream', 'dairy'), ('cream', 'dairy'),
+    ('bread', 'gluten'), ('pasta', 'gluten'), ('pizza', 'gluten'), ('cereal', 'gluten'), ('bagel', 'gluten'), ('toast', 'gluten'),
+    ('rice', 'grains'), ('oats', 'grains'), ('quinoa', 'grains'),
+    ('eggs', 'eggs'), ('egg', 'eggs'),
+    ('beans', 'legumes'), ('lentils', 'legumes'), ('chickpeas', 'legumes'), ('tofu', 'legumes'),
+    ('apple', 'fruit'), ('banana', 'fruit'), ('orange', 'fruit'), ('berries', 'fruit'), ('grapes', 'fruit'),
+    ('broccoli', 'vegetables'), ('spinach', 'vegetables'), ('salad', 'vegetables'), ('carrots', 'vegetables'), ('onion', 'vegetables'), ('garlic', 'vegetables'),
+    ('chocolate', 'sweets'), ('cake', 'sweets'), ('cookies', 'sweets'), ('candy', 'sweets'),
+    ('coffee', 'caffeine'), ('tea', 'caffeine'), ('energy drink', 'caffeine'), ('cola', 'caffeine'),
+    ('wine', 'alcohol'), ('beer', 'alcohol'), ('vodka', 'alcohol'), ('whisky', 'alcohol'),
+    ('chili', 'spicy'), ('curry', 'spicy'), ('hot sauce', 'spicy'),
+    ('fries', 'fried'), ('chips', 'fried'), ('fried chicken', 'fried')
+on conflict (item) do nothing;
+
+-- Rows removed through the API are soft-deleted and hidden from reads
+alter table sleep add column if not exists deleted_at timestamptz;
+alter table diet add column if not exists deleted_at timestamptz;
+alter table menstrual add column if not exists deleted_at timestamptz;
+alter table symptoms add column if not exists deleted_at timestamptz;
+
+create table if not exists insights (
+    id serial primary key,
+    kind text not null, -- new_trigger, worsening_trend, logging_streak
+    fingerprint text not null unique, -- identifies the same finding so it isn't stored twice
+    message text not null,
+    data jsonb not null default '{}',
+    generated_at timestamptz not null default now(),
+    dismissed_at timestamptz
+);
+
+-- Latest dashboard analysis, a single row replaced on every refresh
+create table if not exists analysis_snapshot (
+    id integer primary key default 1 check (id = 1),
+    data jsonb not null,
+    data_version text not null, -- data_changes.changed_at at the time of the refresh
+    created_at timestamptz not null default now()
+);
+
+-- Free-text notes about a day that don't belong to a single domain
+create table if not exists journal (
+    id serial primary key,
+    date date not null,
+    text text not null
+);
+
+-- Optional rich form of diet items, [{"name": "coffee", "quantity": 2, "unit": "cups"}].
+-- items always holds the plain names, which is what analysis reads.
+alter table diet add column if not exists item_details jsonb;
+
+-- How a record was logged: manual through the API, import from a bulk
+-- import, or nlp when parsed from free text and so less certain
+alter table sleep add column if not exists source text not null default 'manual' check (source in ('manual', 'import', 'nlp'));
+alter table diet add column if not exists source text not null default 'manual' check (source in ('manual', 'import', 'nlp'));
+alter table menstrual add column if not exists source text not null default 'manual' check (source in ('manual', 'import', 'nlp'));
+alter table symptoms add column if not exists source text not null default 'manual' check (source in ('manual', 'import', 'nlp'));
+
+-- When any data the analysis reads last changed, a single row bumped by
+-- statement triggers so hard deletes count too. Backs Last-Modified.
+create table if not exists data_changes (
+    id integer primary key default 1 check (id = 1),
+    changed_at timestamptz not null default now()
+);
+
+insert into data_changes (id) values (1) on conflict (id) do nothing;
+
+create or replace function touch_data_changes() returns trigger as $$
+begin
+    update data_changes set changed_at = now() where id = 1;
+    return null;
+end;
+$$ language plpgsql;
+
+create or replace trigger sleep_changed after insert or update or delete or truncate on sleep
+    for each statement execute function touch_data_changes();
+create or replace trigger diet_changed after insert or update or delete or truncate on diet
+    for each statement execute function touch_data_changes();
+create or replace trigger menstrual_changed after insert or update or delete or truncate on menstrual
+    for each statement execute function touch_data_changes();
+create or replace trigger symptoms_changed after insert or update or delete or truncate on symptoms
+    for each statement execute function touch_data_changes();
+create or replace trigger journal_changed after insert or update or delete or truncate on journal
+    for each statement execute function touch_data_changes();
+create or replace trigger settings_changed after insert or update or delete or truncate on settings
+    for each statement execute function touch_data_changes();
+create or replace trigger food_categories_changed after insert or update or delete or truncate on food_categories
+    for each statement execute function touch_data_changes();
+
+-- Read-only links to a snapshot of the computed analysis, see POST /share
+create table if not exists shares (
+    token text primary key, -- opaque random token in the link
+    data jsonb not null, -- aggregates only, never raw notes
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    revoked_at timestamptz
+);
+
+-- User-defined yes/no factors per day, e.g. "screen time > 4h", analyzed
+-- as triggers alongside the built-in ones
+create table if not exists custom_factors (
+    id serial primary key,
+    factor_name text not null, -- normalized like diet items
+    date date not null,
+    present boolean not null default true,
+    unique (factor_name, date)
+);
+
+create or replace trigger custom_factors_changed after insert or update or delete or truncate on custom_factors
+    for each statement execute function touch_data_changes();
+
+-- Daily weather for the configured location, fetched on demand through
+-- POST /weather/refresh when the "weather" setting is present
+create table if not exists weather (
+    date date primary key,
+    pressure_hpa double precision, -- mean sea-level pressure
+    humidity_pct double precision, -- mean relative humidity
+    fetched_at timestamptz not null default now()
+);
+
+create or replace trigger weather_changed after insert or update or delete or truncate on weather
+    for each statement execute function touch_data_changes();
+
+-- Bumped by every edit of a diet entry, so clients can send it back in
+-- If-Match and have a stale edit rejected instead of overwriting another
+alter table diet add column if not exists version integer not null default 1;
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"terrahack2025-backend/database"
+)
+
+// dateRange is the half-open range [From, To) of UTC-midnight dates. A zero
+// bound leaves that side open.
+type dateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+func (r dateRange) bounded() bool {
+	return !r.From.IsZero() || !r.To.IsZero()
+}
+
+func (r dateRange) contains(date time.Time) bool {
+	return (r.From.IsZero() || !date.Before(r.From)) && (r.To.IsZero() || date.Before(r.To))
+}
+
+var lastPattern = regexp.MustCompile(`^(\d+)([dwmy])$`)
+
+// parseLast parses shorthand like "30d", "2w", "3m" or "1y" into the
+// years, months and days it spans
+func parseLast(last string) (years, months, days int, err error) {
+	m := lastPattern.FindStringSubmatch(last)
+	if m == nil {
+		return 0, 0, 0, fmt.Errorf("invalid last %q, expected a count and unit like 7d, 2w, 3m or 1y", last)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n < 1 || n > 3650 {
+		return 0, 0, 0, fmt.Errorf("invalid last %q, the count must be between 1 and 3650", last)
+	}
+	switch m[2] {
+	case "w":
+		return 0, 0, 7 * n, nil
+	case "m":
+		return 0, n, 0, nil
+	case "y":
+		return n, 0, 0, nil
+	}
+	return 0, 0, n, nil
+}
+
+// parseDateRange reads the range a list endpoint is limited to: either
+// from and/or to as YYYY-MM-DD (to is exclusive), or last as shorthand
+// resolved against the user's today. It responds itself and returns false
+// on invalid input.
+func parseDateRange(c *gin.Context, queries *database.Queries) (dateRange, bool) {
+	var r dateRange
+	last := c.Query("last")
+	if last != "" {
+		if c.Query("from") != "" || c.Query("to") != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "last can't be combined with from or to"})
+			return r, false
+		}
+		years, months, days, err := parseLast(last)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return r, false
+		}
+		today, ok := userToday(c, queries)
+		if !ok {
+			return r, false
+		}
+		// The range ends with today, inclusive
+		r.To = today.AddDate(0, 0, 1)
+		r.From = today.AddDate(-years, -months, -days).AddDate(0, 0, 1)
+		return r, true
+	}
+
+	for _, bound := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &r.From}, {"to", &r.To}} {
+		v := c.Query(bound.name)
+		if v == "" {
+			continue
+		}
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s, expected YYYY-MM-DD", bound.name)})
+			return r, false
+		}
+		*bound.dst = d
+	}
+	if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return r, false
+	}
+	return r, true
+}
+
+// filterByDate keeps the rows whose date falls in r
+func filterByDate[T any](rows []T, date func(T) pgtype.Date, r dateRange) []T {
+	if !r.bounded() {
+		return rows
+	}
+	res := []T{}
+	for _, row := range rows {
+		if r.contains(date(row).Time) {
+			res = append(res, row)
+		}
+	}
+	return res
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"terrahack2025-backend/database"
+)
+
+// dayDetail is everything known about one calendar day, raw and derived.
+// Derived fields are null when the data to compute them is missing.
+type dayDetail struct {
+	Date      string               `json:"date"`
+	Sleep     []database.Sleep     `json:"sleep"`
+	Diet      []database.Diet      `json:"diet"`
+	Menstrual []database.Menstrual `json:"menstrual"`
+	Symptoms  []database.Symptom   `json:"symptoms"`
+	Journal   []database.Journal   `json:"journal"`
+
+	SymptomScore *float64 `json:"symptom_score"`
+	ZScore       *float64 `json:"z_score"`
+	Unusual      bool     `json:"unusual"`
+	Spike        bool     `json:"spike"`
+	CycleDay     *int     `json:"cycle_day"`
+	CyclePhase   *string  `json:"cycle_phase"`
+	// Factors logged the day before, when this day was a spike, in the same
+	// "low_sleep", "food:x" form the trigger analysis counts
+	Triggers []string `json:"triggers"`
+}
+
+// buildDayDetail reads the derived flags from analysis so they match what
+// /find_triggers and /symptom_zscores report for the same day
+func buildDayDetail(data analysisData, analysis triggerAnalysis, date time.Time) dayDetail {
+	key := date.Format("2006-01-02")
+	d := dayDetail{
+		Date:      key,
+		Sleep:     []database.Sleep{},
+		Diet:      []database.Diet{},
+		Menstrual: []database.Menstrual{},
+		Symptoms:  []database.Symptom{},
+		Journal:   []database.Journal{},
+		Triggers:  []string{},
+	}
+	for _, s := range data.Sleep {
+		if s.Date.Time.Equal(date) {
+			d.Sleep = append(d.Sleep, s)
+		}
+	}
+	for _, diet := range data.Diet {
+		if diet.Date.Time.Equal(date) {
+			d.Diet = append(d.Diet, diet)
+		}
+	}
+	for _, m := range data.Menstrual {
+		if m.Date.Time.Equal(date) {
+			d.Menstrual = append(d.Menstrual, m)
+		}
+	}
+	for _, s := range data.Symptoms {
+		if s.Date.Time.Equal(date) {
+			d.Symptoms = append(d.Symptoms, s)
+		}
+	}
+	for _, j := range data.Journal {
+		if j.Date.Time.Equal(date) {
+			d.Journal = append(d.Journal, j)
+		}
+	}
+
+	for _, sd := range analysis.ScoredDays {
+		if !sd.Date.Equal(date) {
+			continue
+		}
+		score := sd.Score
+		d.SymptomScore = &score
+		if analysis.StdDev > 0 {
+			z := (score - analysis.Mean) / analysis.StdDev
+			d.ZScore = &z
+			d.Unusual = z > 2 || z < -2
+		}
+	}
+
+	if _, ok := analysis.SpikeDays[key]; ok {
+		d.Spike = true
+		for factor := range analysis.ByDate.factors(date.AddDate(0, 0, -1).Format("2006-01-02")) {
+			d.Triggers = append(d.Triggers, factor)
+		}
+		sort.Strings(d.Triggers)
+	}
+
+	if day, ok := cycleDay(date, periodStarts(data.Menstrual)); ok {
+		phase := cyclePhase(day)
+		d.CycleDay = &day
+		d.CyclePhase = &phase
+	}
+	return d
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// respondDBError answers 404 with notFound when a single-row query found
+// nothing and 500 for any other database error. It returns whether it
+// responded, so handlers can write
+//
+//	if respondDBError(c, err, "insight not found") {
+//		return
+//	}
+func respondDBError(c *gin.Context, err error, notFound string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestRespondDBError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		responded bool
+		status    int
+		message   string
+	}{
+		{"no error", nil, false, http.StatusOK, ""},
+		{"no rows", pgx.ErrNoRows, true, http.StatusNotFound, "insight not found"},
+		{"wrapped no rows", fmt.Errorf("get insight: %w", pgx.ErrNoRows), true, http.StatusNotFound, "insight not found"},
+		{"other error", errors.New("connection refused"), true, http.StatusInternalServerError, "connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			if got := respondDBError(c, tt.err, "insight not found"); got != tt.responded {
+				t.Fatalf("respondDBError() = %v, want %v", got, tt.responded)
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if !tt.responded {
+				if w.Body.Len() != 0 {
+					t.Errorf("wrote %q without an error", w.Body.String())
+				}
+				return
+			}
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != tt.message {
+				t.Errorf("error = %q, want %q", body.Error, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"terrahack2025-backend/database"
+)
+
+const (
+	defaultDietClusters = 3
+	maxDietClusters     = 6
+	// Diet-logged days needed per cluster before clustering is attempted
+	dietDaysPerCluster = 5
+	// Items logged on fewer days only add noise to the distances
+	minClusterItemDays = 2
+	// Representative items reported per cluster
+	clusterTopItems      = 5
+	maxClusterIterations = 50
+)
+
+type clusterItem struct {
+	Item string `json:"item"`
+	// Share of the cluster's days the item was logged on
+	Share float64 `json:"share"`
+}
+
+type dietCluster struct {
+	Label string   `json:"label"`
+	Days  int      `json:"days"`
+	Dates []string `json:"dates"`
+	// Most common items first
+	Items []clusterItem `json:"representative_items"`
+	// Mean symptom score on the cluster's days and on the day after, null
+	// when none of those days were scored
+	AverageSeverity        *float64 `json:"average_severity"`
+	NextDayAverageSeverity *float64 `json:"next_day_average_severity"`
+}
+
+// dietClusters groups the diet-logged days into k clusters by which items
+// were eaten, using k-means on item presence vectors. Centres start from
+// the first day and then the day farthest from every centre so far, which
+// keeps the result the same between calls. Clusters are labelled A, B, ...
+// from the worst average severity down.
+func dietClusters(diet map[string][]string, scores map[string]float64, k int) []dietCluster {
+	itemDays := map[string]int{}
+	for _, items := range diet {
+		for _, item := range items {
+			itemDays[item]++
+		}
+	}
+	var vocab []string
+	for item, n := range itemDays {
+		if n >= minClusterItemDays {
+			vocab = append(vocab, item)
+		}
+	}
+	sort.Strings(vocab)
+	index := map[string]int{}
+	for i, item := range vocab {
+		index[item] = i
+	}
+
+	var dates []string
+	for date := range diet {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	vectors := make([][]float64, len(dates))
+	for i, date := range dates {
+		vectors[i] = make([]float64, len(vocab))
+		for _, item := range diet[date] {
+			if j, ok := index[item]; ok {
+				vectors[i][j] = 1
+			}
+		}
+	}
+
+	distance := func(a, b []float64) float64 {
+		var d float64
+		for i := range a {
+			d += (a[i] - b[i]) * (a[i] - b[i])
+		}
+		return d
+	}
+	nearest := func(v []float64, centres [][]float64) (int, float64) {
+		best, bestDist := 0, distance(v, centres[0])
+		for c := 1; c < len(centres); c++ {
+			if d := distance(v, centres[c]); d < bestDist {
+				best, bestDist = c, d
+			}
+		}
+		return best, bestDist
+	}
+
+	centres := [][]float64{append([]float64(nil), vectors[0]...)}
+	for len(centres) < k {
+		far, farDist := 0, -1.0
+		for i, v := range vectors {
+			if _, d := nearest(v, centres); d > farDist {
+				far, farDist = i, d
+			}
+		}
+		centres = append(centres, append([]float64(nil), vectors[far]...))
+	}
+
+	assignment := make([]int, len(vectors))
+	for iter := 0; iter < maxClusterIterations; iter++ {
+		changed := iter == 0
+		for i, v := range vectors {
+			if c, _ := nearest(v, centres); c != assignment[i] {
+				assignment[i] = c
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		for c := range centres {
+			sum := make([]float64, len(vocab))
+			n := 0
+			for i, v := range vectors {
+				if assignment[i] != c {
+					continue
+				}
+				n++
+				for j := range v {
+					sum[j] += v[j]
+				}
+			}
+			// An emptied cluster keeps its old centre
+			if n == 0 {
+				continue
+			}
+			for j := range sum {
+				sum[j] /= float64(n)
+			}
+			centres[c] = sum
+		}
+	}
+
+	type clusterSums struct {
+		items                  map[string]int
+		severity, nextSeverity float64
+		scored, nextScored     int
+	}
+	clusters := make([]dietCluster, k)
+	sums := make([]clusterSums, k)
+	for c := range clusters {
+		clusters[c].Dates = []string{}
+		sums[c].items = map[string]int{}
+	}
+	for i, date := range dates {
+		c, s := &clusters[assignment[i]], &sums[assignment[i]]
+		c.Days++
+		c.Dates = append(c.Dates, date)
+		for _, item := range diet[date] {
+			s.items[item]++
+		}
+		if score, ok := scores[date]; ok {
+			s.severity += score
+			s.scored++
+		}
+		t, _ := time.Parse("2006-01-02", date)
+		if score, ok := scores[t.AddDate(0, 0, 1).Format("2006-01-02")]; ok {
+			s.nextSeverity += score
+			s.nextScored++
+		}
+	}
+
+	var res []dietCluster
+	for i, c := range clusters {
+		if c.Days == 0 {
+			continue
+		}
+		s := sums[i]
+		if s.scored > 0 {
+			avg := s.severity / float64(s.scored)
+			c.AverageSeverity = &avg
+		}
+		if s.nextScored > 0 {
+			avg := s.nextSeverity / float64(s.nextScored)
+			c.NextDayAverageSeverity = &avg
+		}
+		c.Items = []clusterItem{}
+		for item, n := range s.items {
+			c.Items = append(c.Items, clusterItem{Item: item, Share: float64(n) / float64(c.Days)})
+		}
+		sort.Slice(c.Items, func(a, b int) bool {
+			if c.Items[a].Share != c.Items[b].Share {
+				return c.Items[a].Share > c.Items[b].Share
+			}
+			return c.Items[a].Item < c.Items[b].Item
+		})
+		if len(c.Items) > clusterTopItems {
+			c.Items = c.Items[:clusterTopItems]
+		}
+		res = append(res, c)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		a, b := res[i].AverageSeverity, res[j].AverageSeverity
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return *a > *b
+	})
+	for i := range res {
+		res[i].Label = string(rune('A' + i))
+	}
+	return res
+}
+
+// dietDays collects the distinct items logged each day, leaving out days
+// with no items
+func dietDays(diet []database.Diet) map[string][]string {
+	days := map[string][]string{}
+	for _, d := range diet {
+		date := d.Date.Time.Format("2006-01-02")
+		for _, item := range d.Items {
+			if !slices.Contains(days[date], item) {
+				days[date] = append(days[date], item)
+			}
+		}
+	}
+	return days
+}
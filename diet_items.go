@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"terrahack2025-backend/database"
+)
+
+// dietItem is one food in a diet entry. /insert_diet accepts items either
+// as plain strings or as objects with a quantity, and both may be mixed:
+//
+//	"items": ["toast", {"name": "coffee", "quantity": 2, "unit": "cups"}]
+//
+// The names always go into diet.items, which is what trigger analysis
+// reads. When any item has a quantity or unit, the full list is also kept
+// in diet.item_details.
+type dietItem struct {
+	Name     string   `json:"name"`
+	Quantity *float64 `json:"quantity,omitempty"`
+	Unit     string   `json:"unit,omitempty"`
+}
+
+func (d *dietItem) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*d = dietItem{Name: name}
+		return nil
+	}
+	type rich dietItem
+	var r rich
+	if err := json.Unmarshal(b, &r); err != nil {
+		return errors.New("each item must be a string or an object with a name")
+	}
+	*d = dietItem(r)
+	return nil
+}
+
+// splitDietItems normalizes the item names, dropping empty ones, and
+// returns the item_details JSON, which is nil when every item is plain
+func splitDietItems(items []dietItem) ([]string, json.RawMessage, error) {
+	names := []string{}
+	var kept []dietItem
+	rich := false
+	for _, item := range items {
+		item.Name = normalizeItem(item.Name)
+		if item.Name == "" {
+			continue
+		}
+		if item.Quantity != nil && *item.Quantity < 0 {
+			return nil, nil, errors.New("item quantity must not be negative")
+		}
+		if item.Quantity != nil || item.Unit != "" {
+			rich = true
+		}
+		names = append(names, item.Name)
+		kept = append(kept, item)
+	}
+	if !rich {
+		return names, nil, nil
+	}
+	details, err := json.Marshal(kept)
+	return names, details, err
+}
+
+// mergeDietItems renames the items of d whose normalized name is in from to
+// to, in both items and item_details, keeping only the first to when the
+// entry ends up with several. changed is false when d has nothing to rename,
+// so merging again is a no-op.
+func mergeDietItems(d database.Diet, from map[string]bool, to string) (items []string, details json.RawMessage, changed bool, err error) {
+	rename := func(name string) string {
+		if name != to && from[normalizeItem(name)] {
+			changed = true
+			return to
+		}
+		return name
+	}
+	hasTo := false
+	for _, item := range d.Items {
+		item = rename(item)
+		if item == to {
+			if hasTo {
+				continue
+			}
+			hasTo = true
+		}
+		items = append(items, item)
+	}
+
+	details = d.ItemDetails
+	if len(d.ItemDetails) > 0 && string(d.ItemDetails) != "null" {
+		var rich []dietItem
+		if err := json.Unmarshal(d.ItemDetails, &rich); err != nil {
+			return nil, nil, false, err
+		}
+		var merged []dietItem
+		hasTo := false
+		for _, item := range rich {
+			item.Name = rename(item.Name)
+			if item.Name == to {
+				if hasTo {
+					continue
+				}
+				hasTo = true
+			}
+			merged = append(merged, item)
+		}
+		if details, err = json.Marshal(merged); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	return items, details, changed, nil
+}
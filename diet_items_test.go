@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"terrahack2025-backend/database"
+)
+
+func TestMergeDietItems(t *testing.T) {
+	from := map[string]bool{"dairy": true, "milk": true}
+	d := database.Diet{
+		Items:       []string{"Dairy", "toast", "dairy ", "milk"},
+		ItemDetails: json.RawMessage(`[{"name":"Dairy","quantity":1,"unit":"cup"},{"name":"toast"},{"name":"dairy "}]`),
+	}
+	items, details, changed, err := mergeDietItems(d, from, "dairy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("changed = false, want true")
+	}
+	if want := []string{"dairy", "toast"}; !reflect.DeepEqual(items, want) {
+		t.Errorf("items = %v, want %v", items, want)
+	}
+	var rich []dietItem
+	if err := json.Unmarshal(details, &rich); err != nil {
+		t.Fatal(err)
+	}
+	if len(rich) != 2 || rich[0].Name != "dairy" || rich[0].Quantity == nil || *rich[0].Quantity != 1 || rich[1].Name != "toast" {
+		t.Errorf("item_details = %s, want dairy with its quantity then toast", details)
+	}
+
+	// Merging again finds nothing to rename
+	again := database.Diet{Items: items, ItemDetails: details}
+	if _, _, changed, _ := mergeDietItems(again, from, "dairy"); changed {
+		t.Error("merging again changed the entry")
+	}
+}
+
+func TestSplitDietItems(t *testing.T) {
+	tests := []struct {
+		name        string
+		items       string
+		wantNames   []string
+		wantDetails string
+		wantErr     string
+	}{
+		{
+			name:      "plain strings",
+			items:     `["Toast", " coffee "]`,
+			wantNames: []string{"toast", "coffee"},
+		},
+		{
+			name:        "mixed strings and objects",
+			items:       `["toast", {"name": "Coffee", "quantity": 2, "unit": "cups"}]`,
+			wantNames:   []string{"toast", "coffee"},
+			wantDetails: `[{"name":"toast"},{"name":"coffee","quantity":2,"unit":"cups"}]`,
+		},
+		{
+			name:        "unit without quantity",
+			items:       `[{"name": "rice", "unit": "bowl"}]`,
+			wantNames:   []string{"rice"},
+			wantDetails: `[{"name":"rice","unit":"bowl"}]`,
+		},
+		{
+			name:        "blank names dropped",
+			items:       `["", "  ", {"name": " "}, {"name": "", "quantity": 1}, {"name": "egg", "quantity": 0}]`,
+			wantNames:   []string{"egg"},
+			wantDetails: `[{"name":"egg","quantity":0}]`,
+		},
+		{
+			name:      "nothing left",
+			items:     `[" "]`,
+			wantNames: []string{},
+		},
+		{
+			name:    "negative quantity",
+			items:   `["toast", {"name": "coffee", "quantity": -1}]`,
+			wantErr: "item quantity must not be negative",
+		},
+		{
+			name:    "quantity not a number",
+			items:   `[{"name": "coffee", "quantity": "two"}]`,
+			wantErr: "each item must be a string or an object with a name",
+		},
+		{
+			name:    "neither string nor object",
+			items:   `["toast", 3]`,
+			wantErr: "each item must be a string or an object with a name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var items []dietItem
+			err := json.Unmarshal([]byte(tt.items), &items)
+			var names []string
+			var details json.RawMessage
+			if err == nil {
+				names, details, err = splitDietItems(items)
+			}
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("names = %q, want %q", names, tt.wantNames)
+			}
+			if string(details) != tt.wantDetails {
+				t.Errorf("details = %s, want %s", details, tt.wantDetails)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"terrahack2025-backend/database"
+)
+
+// respondDietVolumeImpact answers /diet_volume_impact: how the number of
+// items eaten on a day correlates with that day's and the next day's
+// symptom score
+func respondDietVolumeImpact(c *gin.Context, scoredDays []scoredDay, dietData []database.Diet) {
+	if len(scoredDays) == 0 {
+		respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+		return
+	}
+	if len(dietData) == 0 {
+		respondInsufficientData(c, "No diet data found.", requireDietEntry, nil)
+		return
+	}
+
+	itemCounts := map[string]int{}
+	for _, d := range dietData {
+		itemCounts[d.Date.Time.Format("2006-01-02")] += len(d.Items)
+	}
+	severity := dailySeverity(scoredDays)
+
+	// Days missing either side are skipped rather than counted as zero
+	var sameX, sameY, nextX, nextY []float64
+	for date, count := range itemCounts {
+		if s, ok := severity[date]; ok {
+			sameX = append(sameX, float64(count))
+			sameY = append(sameY, s)
+		}
+		d, _ := time.Parse("2006-01-02", date)
+		if s, ok := severity[d.AddDate(0, 0, 1).Format("2006-01-02")]; ok {
+			nextX = append(nextX, float64(count))
+			nextY = append(nextY, s)
+		}
+	}
+	if len(sameX) < 2 && len(nextX) < 2 {
+		respondInsufficientData(c, "Not enough days with both diet and symptoms logged.", requireDietSymptomDays, nil)
+		return
+	}
+
+	correlation := func(xs, ys []float64) gin.H {
+		r, ok := pearson(xs, ys)
+		res := gin.H{"correlation": nil, "sample_size": len(xs)}
+		if ok {
+			res["correlation"] = r
+		}
+		return res
+	}
+
+	respondRounded(c, gin.H{
+		"same_day": correlation(sameX, sameY),
+		"next_day": correlation(nextX, nextY),
+	})
+}
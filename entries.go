@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"terrahack2025-backend/database"
+)
+
+// Insert request bodies. Each is validated in four steps, shared by the
+// insert routes and POST /validate: the route's JSON schema, the binding
+// tags, check for whatever the tags can't express, then checkRequestDate.
+
+type sleepRequest struct {
+	Date        string  `json:"date" binding:"required,rfc3339"`
+	Duration    float64 `json:"duration" binding:"min=0,max=24"`
+	Quality     int32   `json:"quality" binding:"min=0,max=10"`
+	Disruptions string  `json:"disruptions"`
+	Notes       string  `json:"notes"`
+	Source      string  `json:"source" binding:"omitempty,oneof=manual import nlp"`
+}
+
+func (r *sleepRequest) check() []fieldError { return nil }
+
+type dietRequest struct {
+	Meal   string     `json:"meal" binding:"meal"`
+	Date   string     `json:"date" binding:"required,rfc3339"`
+	Items  []dietItem `json:"items"`
+	Notes  string     `json:"notes"`
+	Source string     `json:"source" binding:"omitempty,oneof=manual import nlp"`
+}
+
+func (r *dietRequest) check() []fieldError {
+	if _, _, err := splitDietItems(r.Items); err != nil {
+		return []fieldError{{Field: "items", Message: err.Error()}}
+	}
+	return nil
+}
+
+type menstrualRequest struct {
+	PeriodEvent string `json:"period_event"`
+	Date        string `json:"date" binding:"required,rfc3339"`
+	FlowLevel   string `json:"flow_level"`
+	Notes       string `json:"notes"`
+	Source      string `json:"source" binding:"omitempty,oneof=manual import nlp"`
+}
+
+func (r *menstrualRequest) check() []fieldError { return nil }
+
+// Components left out are stored as null, not 0, so they don't drag the
+// day's score down
+type symptomsRequest struct {
+	Date    string `json:"date" binding:"required,rfc3339"`
+	Nausea  *int32 `json:"nausea" binding:"omitempty,min=0,max=10"`
+	Fatigue *int32 `json:"fatigue" binding:"omitempty,min=0,max=10"`
+	Pain    *int32 `json:"pain" binding:"omitempty,min=0,max=10"`
+	Notes   string `json:"notes"`
+	Source  string `json:"source" binding:"omitempty,oneof=manual import nlp"`
+}
+
+func (r *symptomsRequest) check() []fieldError {
+	return checkSymptomValues(r.Nausea, r.Fatigue, r.Pain)
+}
+
+// checkSymptomValues rejects a symptom entry with nothing above 0, which
+// would only inflate logged-day counts
+func checkSymptomValues(values ...*int32) []fieldError {
+	for _, v := range values {
+		if v != nil && *v > 0 {
+			return nil
+		}
+	}
+	return []fieldError{{Message: "log at least one symptom value"}}
+}
+
+type customFactorRequest struct {
+	FactorName string `json:"factor_name" binding:"required,max=100"`
+	Date       string `json:"date" binding:"required,rfc3339"`
+	Present    *bool  `json:"present"`
+}
+
+func (r *customFactorRequest) check() []fieldError {
+	if normalizeItem(r.FactorName) == "" {
+		return []fieldError{{Field: "factor_name", Message: "must not be empty"}}
+	}
+	return nil
+}
+
+type journalRequest struct {
+	Date string `json:"date" binding:"required,rfc3339"`
+	Text string `json:"text" binding:"required,max=2000"`
+}
+
+func (r *journalRequest) check() []fieldError {
+	if strings.TrimSpace(r.Text) == "" {
+		return []fieldError{{Field: "text", Message: "must not be empty"}}
+	}
+	return nil
+}
+
+type entryRequest interface {
+	check() []fieldError
+}
+
+// entryTypes are the types POST /validate accepts, each with its insert
+// route and a new request to validate into
+var entryTypes = map[string]struct {
+	route      string
+	newRequest func() entryRequest
+}{
+	"sleep":         {"/insert_sleep", func() entryRequest { return &sleepRequest{} }},
+	"diet":          {"/insert_diet", func() entryRequest { return &dietRequest{} }},
+	"menstrual":     {"/insert_menstrual", func() entryRequest { return &menstrualRequest{} }},
+	"symptoms":      {"/insert_symptoms", func() entryRequest { return &symptomsRequest{} }},
+	"custom_factor": {"/insert_custom_factor", func() entryRequest { return &customFactorRequest{} }},
+	"journal":       {"/insert_journal", func() entryRequest { return &journalRequest{} }},
+}
+
+// validateEntry runs every check the insert route would on body, binding
+// it into req, and returns the problems found. Each step only runs when
+// the one before passed, as on the insert route. Like checkRequestDate it
+// responds itself and returns false when the user's timezone can't be
+// resolved.
+func validateEntry(c *gin.Context, queries *database.Queries, route string, body []byte, req entryRequest) ([]fieldError, bool) {
+	if schema, ok := requestSchemas[route]; ok {
+		if errs := schema.validateBody(body); len(errs) > 0 {
+			return errs, true
+		}
+	}
+	if err := binding.JSON.BindBody(body, req); err != nil {
+		return fieldErrors(err), true
+	}
+	if errs := req.check(); len(errs) > 0 {
+		return errs, true
+	}
+	// Every entry type has the required date the insert routes store it under
+	var dated struct {
+		Date string `json:"date"`
+	}
+	if err := json.Unmarshal(body, &dated); err != nil {
+		return fieldErrors(err), true
+	}
+	_, errs, ok := checkRequestDate(c, queries, "date", dated.Date)
+	return errs, ok
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"terrahack2025-backend/database"
+)
+
+func TestSymptomsRequestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{"all zero", `{"nausea": 0, "fatigue": 0, "pain": 0}`, false},
+		{"all null", `{"nausea": null, "fatigue": null, "pain": null}`, false},
+		{"all missing", `{"notes": "fine today"}`, false},
+		{"zero and null", `{"nausea": 0, "pain": null}`, false},
+		{"one above zero", `{"nausea": 0, "fatigue": 0, "pain": 1}`, true},
+		{"partial entry", `{"fatigue": 4}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req symptomsRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			errs := req.check()
+			if (len(errs) == 0) != tt.ok {
+				t.Errorf("check() = %+v, want ok %v", errs, tt.ok)
+			}
+			if !tt.ok && errs[0].Message != "log at least one symptom value" {
+				t.Errorf("message = %q", errs[0].Message)
+			}
+		})
+	}
+}
+
+func TestCheckRequestRejectsEmptySymptoms(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	zero := int32(0)
+	if checkRequest(c, &symptomsRequest{Nausea: &zero, Fatigue: &zero, Pain: &zero}) {
+		t.Fatal("checkRequest accepted an all-zero entry")
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var body struct {
+		Error  string       `json:"error"`
+		Errors []fieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != "invalid request body" || len(body.Errors) != 1 {
+		t.Errorf("unexpected response %s", w.Body)
+	}
+}
+
+func TestValidateEntryDates(t *testing.T) {
+	queries := database.New(settingsDB{})
+	today := time.Now().UTC()
+	future := today.AddDate(0, 0, 2).Format("2006-01-02") + "T00:00:00Z"
+	tests := []struct {
+		name    string
+		date    string
+		message string
+	}{
+		{"valid", "2025-07-19T08:00:00Z", ""},
+		{"malformed", "2025-07-19", "is missing the time, expected a full timestamp, e.g. " + exampleTimestamp},
+		{"future", future, "is in the future, expected " + today.Format("2006-01-02") + " or earlier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(`{"date": "` + tt.date + `", "pain": 4}`)
+			errs, ok := validateEntry(testContext("/validate"), queries, "/insert_symptoms", body, &symptomsRequest{})
+			if !ok {
+				t.Fatal("validateEntry responded itself")
+			}
+			if tt.message == "" {
+				if len(errs) > 0 {
+					t.Fatalf("unexpected errors: %+v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Field != "date" || errs[0].Message != tt.message {
+				t.Errorf("errors = %+v, want date: %q", errs, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseRequestDateRejectsFuture(t *testing.T) {
+	c := testContext("/insert_symptoms")
+	future := time.Now().UTC().AddDate(0, 0, 2).Format(time.RFC3339)
+	if _, ok := parseRequestDate(c, database.New(settingsDB{}), "date", future); ok {
+		t.Fatal("parseRequestDate accepted a future date")
+	}
+	if c.Writer.Status() != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", c.Writer.Status())
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import "time"
+
+const (
+	defaultEventWindowDays = 3
+	maxEventWindowDays     = 30
+)
+
+type eventOccurrence struct {
+	Date          string  `json:"date"`
+	BeforeAverage float64 `json:"before_average"`
+	AfterAverage  float64 `json:"after_average"`
+	Delta         float64 `json:"delta"`
+}
+
+type eventImpactResult struct {
+	Occurrences []eventOccurrence `json:"occurrences"`
+	// Mean of the per-occurrence averages and deltas
+	MeanBefore float64 `json:"mean_before"`
+	MeanAfter  float64 `json:"mean_after"`
+	MeanDelta  float64 `json:"mean_delta"`
+	// Occurrences left out because a window had no scored days
+	Skipped int `json:"skipped"`
+}
+
+// eventImpact compares symptom severity around each event date. The before
+// window is the before days leading up to the event, the after window is
+// the event day and the after-1 days following it, so a positive delta
+// means symptoms were worse from the event on.
+func eventImpact(dates []time.Time, days []scoredDay, before, after int) eventImpactResult {
+	severity := dailySeverity(days)
+	windowAverage := func(from time.Time, n int) (float64, bool) {
+		var scores []float64
+		for i := 0; i < n; i++ {
+			if score, ok := severity[from.AddDate(0, 0, i).Format("2006-01-02")]; ok {
+				scores = append(scores, score)
+			}
+		}
+		if len(scores) == 0 {
+			return 0, false
+		}
+		mean, _ := meanStdDev(scores)
+		return mean, true
+	}
+
+	res := eventImpactResult{Occurrences: []eventOccurrence{}}
+	var befores, afters, deltas []float64
+	for _, date := range dates {
+		beforeAvg, okBefore := windowAverage(date.AddDate(0, 0, -before), before)
+		afterAvg, okAfter := windowAverage(date, after)
+		if !okBefore || !okAfter {
+			res.Skipped++
+			continue
+		}
+		res.Occurrences = append(res.Occurrences, eventOccurrence{
+			Date:          date.Format("2006-01-02"),
+			BeforeAverage: beforeAvg,
+			AfterAverage:  afterAvg,
+			Delta:         afterAvg - beforeAvg,
+		})
+		befores = append(befores, beforeAvg)
+		afters = append(afters, afterAvg)
+		deltas = append(deltas, afterAvg-beforeAvg)
+	}
+	res.MeanBefore, _ = meanStdDev(befores)
+	res.MeanAfter, _ = meanStdDev(afters)
+	res.MeanDelta, _ = meanStdDev(deltas)
+	return res
+}
+
+// customFactorDates returns the sorted dates name was marked present
+func customFactorDates(data analysisData, name string) []time.Time {
+	var dates []time.Time
+	for _, f := range data.CustomFactors {
+		if f.FactorName == name && f.Present {
+			dates = append(dates, f.Date.Time)
+		}
+	}
+	return dates
+}
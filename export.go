@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"terrahack2025-backend/database"
+)
+
+// Bumped whenever the shape of exported records changes
+const exportSchemaVersion = 1
+
+// writeAccountSummary streams every record, the computed insights and the
+// settings as one JSON document, encoding records one at a time so large
+// datasets don't have to be marshalled in a single buffer
+func writeAccountSummary(w io.Writer, data analysisData, settings []database.Setting, generatedAt time.Time) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	writeField := func(name string, first bool) error {
+		if !first {
+			if _, err := bw.WriteString(","); err != nil {
+				return err
+			}
+		}
+		return enc.Encode(name)
+	}
+	writeColon := func() error {
+		_, err := bw.WriteString(":")
+		return err
+	}
+
+	if _, err := bw.WriteString("{"); err != nil {
+		return err
+	}
+
+	header := []struct {
+		name  string
+		value any
+	}{
+		{"generated_at", generatedAt},
+		{"schema_version", exportSchemaVersion},
+		{"settings", settingsMap(settings)},
+		{"insights", accountInsights(data)},
+	}
+	for i, h := range header {
+		if err := writeField(h.name, i == 0); err != nil {
+			return err
+		}
+		if err := writeColon(); err != nil {
+			return err
+		}
+		if err := enc.Encode(h.value); err != nil {
+			return err
+		}
+	}
+
+	sections := []struct {
+		name  string
+		write func() error
+	}{
+		{"sleep", func() error { return writeJSONArray(bw, enc, data.Sleep) }},
+		{"diet", func() error { return writeJSONArray(bw, enc, data.Diet) }},
+		{"menstrual", func() error { return writeJSONArray(bw, enc, data.Menstrual) }},
+		{"symptoms", func() error { return writeJSONArray(bw, enc, data.Symptoms) }},
+	}
+	for _, sec := range sections {
+		if err := writeField(sec.name, false); err != nil {
+			return err
+		}
+		if err := writeColon(); err != nil {
+			return err
+		}
+		if err := sec.write(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := bw.WriteString("}"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeJSONArray[T any](bw *bufio.Writer, enc *json.Encoder, items []T) error {
+	if _, err := bw.WriteString("["); err != nil {
+		return err
+	}
+	for i, item := range items {
+		if i > 0 {
+			if _, err := bw.WriteString(","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	_, err := bw.WriteString("]")
+	return err
+}
+
+func settingsMap(settings []database.Setting) map[string]json.RawMessage {
+	m := map[string]json.RawMessage{}
+	for _, s := range settings {
+		m[s.Key] = redactSetting(s.Key, s.Value)
+	}
+	return m
+}
+
+// redactSetting hides the secrets in a setting's value before it is
+// returned or exported
+func redactSetting(key string, value []byte) json.RawMessage {
+	if key == weatherSetting {
+		return redactWeatherSetting(value)
+	}
+	return value
+}
+
+// accountInsights summarizes the computed analysis included in the export
+func accountInsights(data analysisData) map[string]any {
+	if len(data.Symptoms) == 0 {
+		return map[string]any{}
+	}
+	analysis := analyzeTriggers(data, defaultAnalysisOptions())
+	return map[string]any{
+		"symptom_average":         analysis.Mean,
+		"standard_deviation":      analysis.StdDev,
+		"symptom_spike_threshold": analysis.Threshold,
+		"spike_days":              analysis.SpikeDays,
+		"low_sleep_hours":         analysis.Triggers.LowSleepHours,
+		"common_food_items":       analysis.Triggers.FoodItems,
+		"menstrual_events":        analysis.Triggers.MenstrualEvent,
+		"flow_levels":             analysis.Triggers.FlowLevel,
+		"custom_factors":          analysis.Triggers.CustomFactors,
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sort"
+
+	"terrahack2025-backend/database"
+)
+
+// Items with no row in food_categories are grouped under this category
+const uncategorized = "uncategorized"
+
+func categoryLookup(rows []database.FoodCategory) map[string]string {
+	categories := make(map[string]string, len(rows))
+	for _, row := range rows {
+		categories[row.Item] = row.Category
+	}
+	return categories
+}
+
+// categoryTriggers rolls per-item trigger counts and details up to their
+// food categories, along with the items that fell into each category
+func categoryTriggers(counts map[string]int, details map[string][]triggerDetail, categories map[string]string) (map[string]int, map[string][]triggerDetail, map[string][]string) {
+	categoryCounts := map[string]int{}
+	categoryDetails := map[string][]triggerDetail{}
+	categoryItems := map[string][]string{}
+	for item, count := range counts {
+		category, ok := categories[item]
+		if !ok {
+			category = uncategorized
+		}
+		categoryCounts[category] += count
+		categoryDetails[category] = append(categoryDetails[category], details[item]...)
+		categoryItems[category] = append(categoryItems[category], item)
+	}
+	for category := range categoryItems {
+		sort.Strings(categoryItems[category])
+		sort.Slice(categoryDetails[category], func(i, j int) bool {
+			return categoryDetails[category][i].Date < categoryDetails[category][j].Date
+		})
+	}
+	return categoryCounts, categoryDetails, categoryItems
+}
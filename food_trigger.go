@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// A food needs this many scored next days before its drill-down means
+// anything, unless the data_requirements setting overrides it
+const minFoodTriggerDays = 3
+
+type foodSpike struct {
+	Date     string  `json:"date"`
+	Severity float64 `json:"severity"`
+}
+
+// foodTrigger is everything the trigger analysis knows about one food
+type foodTrigger struct {
+	Item string `json:"item"`
+	// Days the food was logged and the following day was scored
+	DaysEaten int `json:"days_eaten"`
+	// Spikes the food was logged the day before, with the spike day's date
+	SpikesPreceded int                `json:"spikes_preceded"`
+	Spikes         []foodSpike        `json:"spikes"`
+	BaseSpikeRate  float64            `json:"base_spike_rate"`
+	SpikeRate      float64            `json:"spike_rate"`
+	Lift           float64            `json:"lift"`
+	Significance   significanceResult `json:"significance"`
+}
+
+// foodTrigger drills into one normalized food item. It reports false when
+// the item was eaten on fewer than minDays scored days.
+func (a triggerAnalysis) foodTrigger(item string, minDays int) (foodTrigger, bool) {
+	baseRate, lifts := a.lifts()
+	l := lifts["food:"+item]
+	res := foodTrigger{Item: item, DaysEaten: l.DaysPresent, Spikes: []foodSpike{}}
+	if l.DaysPresent < minDays {
+		return res, false
+	}
+
+	// A food eaten at several meals has one detail per meal, but preceded
+	// the spike once
+	seen := map[string]bool{}
+	for _, d := range a.FoodItemDetails[item] {
+		if seen[d.Date] {
+			continue
+		}
+		seen[d.Date] = true
+		eaten, _ := time.Parse("2006-01-02", d.Date)
+		res.Spikes = append(res.Spikes, foodSpike{Date: eaten.AddDate(0, 0, 1).Format("2006-01-02"), Severity: d.TriggerSeverity})
+	}
+	sort.Slice(res.Spikes, func(i, j int) bool { return res.Spikes[i].Date < res.Spikes[j].Date })
+	res.SpikesPreceded = len(res.Spikes)
+
+	res.BaseSpikeRate = baseRate
+	res.SpikeRate = float64(l.Spikes) / float64(l.DaysPresent)
+	res.Lift = l.Lift
+
+	res.Significance = a.significance(l)
+	return res, true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"terrahack2025-backend/database"
+)
+
+// Seconds clients may reuse an analytics response without revalidating,
+// overridable with ANALYTICS_CACHE_MAX_AGE
+const defaultAnalyticsCacheMaxAge = 60
+
+func analyticsCacheMaxAge() int {
+	v := os.Getenv("ANALYTICS_CACHE_MAX_AGE")
+	if v == "" {
+		return defaultAnalyticsCacheMaxAge
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid ANALYTICS_CACHE_MAX_AGE %q, expected a non-negative number of seconds", v)
+	}
+	return n
+}
+
+// cacheHeaderWriter drops the caching headers from anything but a 200, so
+// an error is never reused
+type cacheHeaderWriter struct {
+	gin.ResponseWriter
+}
+
+func (w cacheHeaderWriter) WriteHeader(code int) {
+	if code != http.StatusOK {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("Last-Modified")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// lastModified sets Cache-Control and Last-Modified on analytics responses
+// and answers 304 when If-Modified-Since shows the client is current.
+// Responses only change when data is logged, or when the user's day rolls
+// over for the ones that report data age, so Last-Modified is the later of
+// the last data change and the start of the user's day. Responses are
+// private because they describe one person's health.
+func lastModified(pool *pgxpool.Pool, maxAge int) gin.HandlerFunc {
+	cacheControl := fmt.Sprintf("private, max-age=%d", maxAge)
+	return func(c *gin.Context) {
+		queries := database.New(pool)
+		changed, err := queries.GetLastDataChange(c.Request.Context())
+		if err != nil {
+			// The handler reports the database error itself
+			slog.Warn("skipping cache headers", "path", c.FullPath(), "error", err)
+			c.Next()
+			return
+		}
+		loc, ok := userLocation(c, queries)
+		if !ok {
+			c.Abort()
+			return
+		}
+		now := time.Now().In(loc)
+		modified := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+		if changed.Time.After(modified) {
+			modified = changed.Time.Truncate(time.Second)
+		}
+
+		c.Header("Vary", "X-Timezone")
+		c.Header("Cache-Control", cacheControl)
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && !modified.After(since) {
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+		c.Writer = cacheHeaderWriter{c.Writer}
+		c.Next()
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"terrahack2025-backend/database"
+)
+
+// How /import.json treats a row whose date already has an entry in that
+// domain (for diet, the same date and meal)
+const (
+	conflictFail      = "fail"
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+)
+
+// importMode reads the conflict mode for an import request. dedupe=true is
+// shorthand for conflict=skip, meant for syncs that resend overlapping
+// batches. It responds itself and returns false when the parameters are
+// invalid.
+func importMode(c *gin.Context) (string, bool) {
+	mode := c.DefaultQuery("conflict", conflictFail)
+	if mode != conflictFail && mode != conflictSkip && mode != conflictOverwrite {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid conflict, expected fail, skip or overwrite"})
+		return "", false
+	}
+	if v := c.Query("dedupe"); v != "" {
+		dedupe, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dedupe, expected true or false"})
+			return "", false
+		}
+		if dedupe {
+			if c.Query("conflict") != "" && mode != conflictSkip {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "dedupe=true skips duplicates, remove conflict or set conflict=skip"})
+				return "", false
+			}
+			mode = conflictSkip
+		}
+	}
+	return mode, true
+}
+
+// importPayload uses the same row shapes as the insert endpoints
+type importPayload struct {
+	Sleep     []importSleepRow     `json:"sleep"`
+	Diet      []importDietRow      `json:"diet"`
+	Menstrual []importMenstrualRow `json:"menstrual"`
+	Symptoms  []importSymptomsRow  `json:"symptoms"`
+}
+
+// The binding tags mirror the insert handlers and are checked per row by
+// validateImport before anything is written
+type importSleepRow struct {
+	Date        string  `json:"date" binding:"required,rfc3339"`
+	Duration    float64 `json:"duration" binding:"min=0,max=24"`
+	Quality     int32   `json:"quality" binding:"min=0,max=10"`
+	Disruptions string  `json:"disruptions"`
+	Notes       string  `json:"notes"`
+}
+
+type importDietRow struct {
+	Meal  string   `json:"meal" binding:"meal"`
+	Date  string   `json:"date" binding:"required,rfc3339"`
+	Items []string `json:"items"`
+	Notes string   `json:"notes"`
+}
+
+type importMenstrualRow struct {
+	PeriodEvent string `json:"period_event"`
+	Date        string `json:"date" binding:"required,rfc3339"`
+	FlowLevel   string `json:"flow_level"`
+	Notes       string `json:"notes"`
+}
+
+// Components left out of a symptoms row are stored as null, as on insert
+type importSymptomsRow struct {
+	Date    string `json:"date" binding:"required,rfc3339"`
+	Nausea  *int32 `json:"nausea" binding:"omitempty,min=0,max=10"`
+	Fatigue *int32 `json:"fatigue" binding:"omitempty,min=0,max=10"`
+	Pain    *int32 `json:"pain" binding:"omitempty,min=0,max=10"`
+	Notes   string `json:"notes"`
+}
+
+func (r *importSymptomsRow) check() []fieldError {
+	return checkSymptomValues(r.Nausea, r.Fatigue, r.Pain)
+}
+
+type importCounts struct {
+	Imported    int `json:"imported"`
+	Skipped     int `json:"skipped"`
+	Overwritten int `json:"overwritten"`
+}
+
+// importConflictError aborts a conflict=fail import
+type importConflictError struct {
+	Domain string
+	Date   string
+}
+
+func (e *importConflictError) Error() string {
+	return fmt.Sprintf("%s entry already exists for %s", e.Domain, e.Date)
+}
+
+// parsedImport holds the validated rows ready to insert
+type parsedImport struct {
+	Sleep     []database.InsertSleepParams
+	Diet      []database.InsertDietParams
+	Menstrual []database.InsertMenstrualParams
+	Symptoms  []database.InsertSymptomsParams
+}
+
+// validateImport checks every row's binding tags, which binding the payload
+// doesn't reach, and the checks the insert route runs after them, naming the first invalid row, e.g. "symptoms[2]: pain must
+// be at most 10"
+func validateImport(payload importPayload) error {
+	validate := func(domain string, i int, row any) error {
+		var errs []fieldError
+		if err := binding.Validator.ValidateStruct(row); err != nil {
+			errs = fieldErrors(err)
+		} else if r, ok := row.(entryRequest); ok {
+			errs = r.check()
+		}
+		if len(errs) == 0 {
+			return nil
+		}
+		var problems []string
+		for _, fe := range errs {
+			problems = append(problems, strings.TrimSpace(fe.Field+" "+fe.Message))
+		}
+		return fmt.Errorf("%s[%d]: %s", domain, i, strings.Join(problems, ", "))
+	}
+	for i := range payload.Sleep {
+		if err := validate("sleep", i, &payload.Sleep[i]); err != nil {
+			return err
+		}
+	}
+	for i := range payload.Diet {
+		if err := validate("diet", i, &payload.Diet[i]); err != nil {
+			return err
+		}
+	}
+	for i := range payload.Menstrual {
+		if err := validate("menstrual", i, &payload.Menstrual[i]); err != nil {
+			return err
+		}
+	}
+	for i := range payload.Symptoms {
+		if err := validate("symptoms", i, &payload.Symptoms[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseImport validates every row up front so nothing is written when any
+// row is malformed. Dates follow calendarDate, with loc as the user's
+// timezone.
+func parseImport(payload importPayload, loc *time.Location) (parsedImport, error) {
+	var p parsedImport
+	if err := validateImport(payload); err != nil {
+		return p, err
+	}
+	parseDate := func(domain string, i int, v string) (pgtype.Date, error) {
+		t, err := parseTimestamp(v)
+		if err != nil {
+			return pgtype.Date{}, fmt.Errorf("%s[%d]: date %v", domain, i, err)
+		}
+		return pgtype.Date{Time: calendarDate(v, t, loc), Valid: true}, nil
+	}
+
+	for i, row := range payload.Sleep {
+		date, err := parseDate("sleep", i, row.Date)
+		if err != nil {
+			return p, err
+		}
+		p.Sleep = append(p.Sleep, database.InsertSleepParams{
+			Date:        date,
+			Duration:    pgtype.Float8{Float64: row.Duration, Valid: true},
+			Quality:     pgtype.Int4{Int32: row.Quality, Valid: true},
+			Disruptions: pgtype.Text{String: row.Disruptions, Valid: true},
+			Notes:       pgtype.Text{String: row.Notes, Valid: true},
+			Source:      pgtype.Text{String: sourceImport, Valid: true},
+		})
+	}
+	for i, row := range payload.Diet {
+		date, err := parseDate("diet", i, row.Date)
+		if err != nil {
+			return p, err
+		}
+		meal, err := normalizeMeal(row.Meal)
+		if err != nil {
+			return p, fmt.Errorf("diet[%d]: %w", i, err)
+		}
+		items := normalizeItems(row.Items)
+		caffeine, alcohol := dietFlags(items)
+		p.Diet = append(p.Diet, database.InsertDietParams{
+			Meal:             pgtype.Text{String: meal, Valid: true},
+			Date:             date,
+			Items:            items,
+			Notes:            pgtype.Text{String: row.Notes, Valid: true},
+			ContainsCaffeine: caffeine,
+			ContainsAlcohol:  alcohol,
+			Source:           pgtype.Text{String: sourceImport, Valid: true},
+		})
+	}
+	for i, row := range payload.Menstrual {
+		date, err := parseDate("menstrual", i, row.Date)
+		if err != nil {
+			return p, err
+		}
+		p.Menstrual = append(p.Menstrual, database.InsertMenstrualParams{
+			PeriodEvent: pgtype.Text{String: row.PeriodEvent, Valid: true},
+			Date:        date,
+			FlowLevel:   pgtype.Text{String: row.FlowLevel, Valid: true},
+			Notes:       pgtype.Text{String: row.Notes, Valid: true},
+			Source:      pgtype.Text{String: sourceImport, Valid: true},
+		})
+	}
+	for i, row := range payload.Symptoms {
+		date, err := parseDate("symptoms", i, row.Date)
+		if err != nil {
+			return p, err
+		}
+		p.Symptoms = append(p.Symptoms, database.InsertSymptomsParams{
+			Date:    date,
+			Nausea:  optionalInt4(row.Nausea),
+			Fatigue: optionalInt4(row.Fatigue),
+			Pain:    optionalInt4(row.Pain),
+			Notes:   pgtype.Text{String: row.Notes, Valid: true},
+			Source:  pgtype.Text{String: sourceImport, Valid: true},
+		})
+	}
+	return p, nil
+}
+
+// importWriter resolves conflicts between imported rows and the entries
+// that existed before the import according to mode, counting the outcome
+// per domain
+type importWriter struct {
+	mode string
+	// existing only holds the entries from before the import, several rows
+	// for one date in a payload are valid and don't conflict with each
+	// other. removed tracks the keys whose old entries an overwrite has
+	// already deleted.
+	existing map[string]map[string]bool
+	removed  map[string]map[string]bool
+	report   map[string]*importCounts
+}
+
+// newImportWriter keys the entries in data by date, and by meal for diet
+func newImportWriter(mode string, data analysisData) *importWriter {
+	w := &importWriter{
+		mode:     mode,
+		existing: map[string]map[string]bool{},
+		removed:  map[string]map[string]bool{},
+		report:   map[string]*importCounts{},
+	}
+	for _, domain := range []string{"sleep", "diet", "menstrual", "symptoms"} {
+		w.existing[domain] = map[string]bool{}
+		w.removed[domain] = map[string]bool{}
+		w.report[domain] = &importCounts{}
+	}
+	for _, s := range data.Sleep {
+		w.existing["sleep"][s.Date.Time.Format("2006-01-02")] = true
+	}
+	for _, d := range data.Diet {
+		w.existing["diet"][d.Date.Time.Format("2006-01-02")+"/"+d.Meal.String] = true
+	}
+	for _, m := range data.Menstrual {
+		w.existing["menstrual"][m.Date.Time.Format("2006-01-02")] = true
+	}
+	for _, s := range data.Symptoms {
+		w.existing["symptoms"][s.Date.Time.Format("2006-01-02")] = true
+	}
+	return w
+}
+
+// write resolves a conflict with an entry from before the import according
+// to the mode, then inserts the row
+func (w *importWriter) write(domain, key string, date time.Time, remove, insert func() error) error {
+	counts := w.report[domain]
+	overwrite := false
+	if w.existing[domain][key] {
+		switch w.mode {
+		case conflictSkip:
+			counts.Skipped++
+			return nil
+		case conflictOverwrite:
+			// Only the first row for the key removes the old entries, a
+			// second would delete the row just imported
+			if !w.removed[domain][key] {
+				if err := remove(); err != nil {
+					return err
+				}
+				w.removed[domain][key] = true
+			}
+			overwrite = true
+		default:
+			return &importConflictError{Domain: domain, Date: date.Format("2006-01-02")}
+		}
+	}
+	if err := insert(); err != nil {
+		return err
+	}
+	if overwrite {
+		counts.Overwritten++
+	} else {
+		counts.Imported++
+	}
+	return nil
+}
+
+// importRecords writes the parsed rows using queries, which should be bound
+// to a transaction so a conflict=fail abort rolls everything back
+func importRecords(ctx context.Context, queries *database.Queries, p parsedImport, mode string) (map[string]*importCounts, error) {
+	// Imports run one at a time, so rows committed by a concurrent import
+	// are seen as existing rather than inserted twice. The tables have no
+	// unique date constraint to lean on, several entries a day are allowed.
+	if err := queries.LockImports(ctx); err != nil {
+		return nil, err
+	}
+	data, err := loadAnalysisData(ctx, queries)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newImportWriter(mode, data)
+
+	for _, row := range p.Sleep {
+		err := w.write("sleep", row.Date.Time.Format("2006-01-02"), row.Date.Time,
+			func() error { _, err := queries.DeleteSleepByDate(ctx, row.Date); return err },
+			func() error { _, err := queries.InsertSleep(ctx, row); return err })
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range p.Diet {
+		err := w.write("diet", row.Date.Time.Format("2006-01-02")+"/"+row.Meal.String, row.Date.Time,
+			func() error {
+				_, err := queries.DeleteDietByDateAndMeal(ctx, database.DeleteDietByDateAndMealParams{Date: row.Date, Meal: row.Meal})
+				return err
+			},
+			func() error { _, err := queries.InsertDiet(ctx, row); return err })
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range p.Menstrual {
+		err := w.write("menstrual", row.Date.Time.Format("2006-01-02"), row.Date.Time,
+			func() error { _, err := queries.DeleteMenstrualByDate(ctx, row.Date); return err },
+			func() error { _, err := queries.InsertMenstrual(ctx, row); return err })
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range p.Symptoms {
+		err := w.write("symptoms", row.Date.Time.Format("2006-01-02"), row.Date.Time,
+			func() error { _, err := queries.DeleteSymptomsByDate(ctx, row.Date); return err },
+			func() error { _, err := queries.InsertSymptoms(ctx, row); return err })
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return w.report, nil
+}
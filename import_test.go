@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"terrahack2025-backend/database"
+)
+
+func TestImportMode(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string
+		wantErr string
+	}{
+		{"", conflictFail, ""},
+		{"conflict=overwrite", conflictOverwrite, ""},
+		{"dedupe=true", conflictSkip, ""},
+		{"dedupe=true&conflict=skip", conflictSkip, ""},
+		{"dedupe=false", conflictFail, ""},
+		{"dedupe=false&conflict=overwrite", conflictOverwrite, ""},
+		{"dedupe=true&conflict=fail", "", "dedupe=true skips duplicates, remove conflict or set conflict=skip"},
+		{"dedupe=true&conflict=overwrite", "", "dedupe=true skips duplicates, remove conflict or set conflict=skip"},
+		{"dedupe=maybe", "", "invalid dedupe, expected true or false"},
+		{"conflict=merge", "", "invalid conflict, expected fail, skip or overwrite"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c := testContext("/import?" + tt.query)
+			mode, ok := importMode(c)
+			if tt.wantErr == "" {
+				if !ok || mode != tt.want {
+					t.Errorf("importMode() = %q, %v, want %q", mode, ok, tt.want)
+				}
+				return
+			}
+			if ok {
+				t.Fatalf("importMode() = %q, want a 400", mode)
+			}
+			if c.Writer.Status() != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", c.Writer.Status(), http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// importCalls records what an importWriter asked to delete and insert
+type importCalls struct {
+	removed, inserted []string
+}
+
+func (c *importCalls) write(w *importWriter, domain, key string) error {
+	date, _ := time.Parse("2006-01-02", key[:10])
+	return w.write(domain, key, date,
+		func() error { c.removed = append(c.removed, domain+" "+key); return nil },
+		func() error { c.inserted = append(c.inserted, domain+" "+key); return nil })
+}
+
+func TestImportWriter(t *testing.T) {
+	existing := analysisData{
+		Sleep: []database.Sleep{{Date: testDate("2025-07-19")}},
+		Diet:  []database.Diet{{Date: testDate("2025-07-19"), Meal: pgtype.Text{String: "lunch", Valid: true}}},
+	}
+	// Two rows for the existing sleep date, a diet row for another meal on
+	// that date and a sleep row for a new date
+	rows := [][2]string{
+		{"sleep", "2025-07-19"},
+		{"sleep", "2025-07-19"},
+		{"diet", "2025-07-19/breakfast"},
+		{"sleep", "2025-07-20"},
+	}
+	tests := []struct {
+		mode         string
+		wantSleep    importCounts
+		wantRemoved  int
+		wantInserted int
+	}{
+		// dedupe=true, the resent rows are skipped without touching the old entry
+		{conflictSkip, importCounts{Imported: 1, Skipped: 2}, 0, 2},
+		// The old entry is deleted once, then both rows for its date are kept
+		{conflictOverwrite, importCounts{Imported: 1, Overwritten: 2}, 1, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			w := newImportWriter(tt.mode, existing)
+			var calls importCalls
+			for _, row := range rows {
+				if err := calls.write(w, row[0], row[1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := *w.report["sleep"]; got != tt.wantSleep {
+				t.Errorf("sleep counts = %+v, want %+v", got, tt.wantSleep)
+			}
+			if got := *w.report["diet"]; got != (importCounts{Imported: 1}) {
+				t.Errorf("diet counts = %+v, want one import for the new meal", got)
+			}
+			if len(calls.removed) != tt.wantRemoved || len(calls.inserted) != tt.wantInserted {
+				t.Errorf("removed %q and inserted %q", calls.removed, calls.inserted)
+			}
+		})
+	}
+}
+
+func TestImportWriterFailsOnConflict(t *testing.T) {
+	w := newImportWriter(conflictFail, analysisData{Symptoms: []database.Symptom{testSymptom("2025-07-19", 1, 2, 3)}})
+	var calls importCalls
+	if err := calls.write(w, "symptoms", "2025-07-20"); err != nil {
+		t.Fatal(err)
+	}
+	err := calls.write(w, "symptoms", "2025-07-19")
+	var conflict *importConflictError
+	if !errors.As(err, &conflict) || conflict.Domain != "symptoms" || conflict.Date != "2025-07-19" {
+		t.Fatalf("error = %v, want a symptoms conflict on 2025-07-19", err)
+	}
+	if len(calls.inserted) != 1 {
+		t.Errorf("inserted %q, want only the new date", calls.inserted)
+	}
+	if got := *w.report["symptoms"]; got != (importCounts{Imported: 1}) {
+		t.Errorf("symptoms counts = %+v, want one import", got)
+	}
+}
+
+func TestParseImportRejectsOutOfRangeRows(t *testing.T) {
+	valid := importSleepRow{Date: "2025-07-19T00:00:00Z", Duration: 7, Quality: 6}
+	tests := []struct {
+		name    string
+		payload importPayload
+		wantErr string
+	}{
+		{
+			"sleep quality",
+			importPayload{Sleep: []importSleepRow{valid, {Date: "2025-07-20T00:00:00Z", Duration: 7, Quality: 999}}},
+			"sleep[1]: quality must be at most 10",
+		},
+		{
+			"sleep duration",
+			importPayload{Sleep: []importSleepRow{{Date: "2025-07-20T00:00:00Z", Duration: 99}}},
+			"sleep[0]: duration must be at most 24",
+		},
+		{
+			"symptom components",
+			importPayload{
+				Sleep:    []importSleepRow{valid},
+				Symptoms: []importSymptomsRow{{Date: "2025-07-19T00:00:00Z", Nausea: int32Ptr(-5), Pain: int32Ptr(50)}},
+			},
+			"symptoms[0]: nausea must be at least 0, pain must be at most 10",
+		},
+		{
+			"diet meal",
+			importPayload{Diet: []importDietRow{{Date: "2025-07-19T00:00:00Z", Meal: "brunch"}}},
+			"diet[0]: meal must be one of breakfast, lunch, dinner, snack",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseImport(tt.payload, time.UTC)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("parseImport() error = %v, want %q", err, tt.wantErr)
+			}
+			// runImport only opens the transaction once parseImport succeeds,
+			// and the valid rows before the bad one aren't kept either
+			if len(p.Sleep)+len(p.Diet)+len(p.Menstrual)+len(p.Symptoms) != 0 {
+				t.Errorf("parseImport() kept rows %+v from a rejected payload", p)
+			}
+		})
+	}
+}
+
+func int32Ptr(v int32) *int32 { return &v }
+
+func TestParseImportPartialSymptoms(t *testing.T) {
+	p, err := parseImport(importPayload{Symptoms: []importSymptomsRow{{Date: "2025-07-19T00:00:00Z", Pain: int32Ptr(6)}}}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := p.Symptoms[0]
+	if row.Nausea.Valid || row.Fatigue.Valid {
+		t.Errorf("nausea %+v and fatigue %+v, want both null", row.Nausea, row.Fatigue)
+	}
+	if row.Pain != (pgtype.Int4{Int32: 6, Valid: true}) {
+		t.Errorf("pain = %+v, want 6", row.Pain)
+	}
+}
+
+func TestParseImportRejectsEmptySymptoms(t *testing.T) {
+	for name, row := range map[string]importSymptomsRow{
+		"nothing logged": {Date: "2025-07-19T00:00:00Z", Notes: "fine"},
+		"all zero":       {Date: "2025-07-19T00:00:00Z", Nausea: int32Ptr(0), Fatigue: int32Ptr(0), Pain: int32Ptr(0)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseImport(importPayload{Symptoms: []importSymptomsRow{row}}, time.UTC)
+			if want := "symptoms[0]: log at least one symptom value"; err == nil || err.Error() != want {
+				t.Errorf("parseImport() error = %v, want %q", err, want)
+			}
+		})
+	}
+}
+
+func TestParseCSVImportPartialSymptoms(t *testing.T) {
+	csv := "date,nausea,fatigue,pain\n2025-07-19T00:00:00Z,,,6\n2025-07-20T00:00:00Z,,,\n"
+	payload, lineErrs, err := parseCSVImport(strings.NewReader(csv), "symptoms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lineErrs) != 1 || lineErrs[0].Line != 3 || lineErrs[0].Message != "log at least one symptom value" {
+		t.Errorf("line errors = %+v, want the empty line 3 rejected", lineErrs)
+	}
+	if len(payload.Symptoms) != 1 {
+		t.Fatalf("got %d rows, want 1", len(payload.Symptoms))
+	}
+	row := payload.Symptoms[0]
+	if row.Nausea != nil || row.Fatigue != nil || row.Pain == nil || *row.Pain != 6 {
+		t.Errorf("row = %+v, want only pain 6", row)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"terrahack2025-backend/database"
+)
+
+const (
+	insightNewTrigger     = "new_trigger"
+	insightWorseningTrend = "worsening_trend"
+	insightLoggingStreak  = "logging_streak"
+)
+
+// A trigger is only worth surfacing once it has preceded a few spikes and
+// spikes are more likely than usual after it
+const (
+	minInsightTriggerCount = 3
+	minInsightTriggerLift  = 1.5
+)
+
+// Average severity rise, week on week, that counts as a worsening trend
+const worseningTrendDelta = 1.0
+
+var streakMilestones = []int{7, 14, 30, 60, 100, 365}
+
+// insightCandidate is a finding before it is stored. Fingerprint identifies
+// the finding itself, so the same trigger or the same week's trend maps to
+// the same row and a dismissed insight is never regenerated.
+type insightCandidate struct {
+	Kind        string
+	Fingerprint string
+	Message     string
+	Data        any
+}
+
+// findInsights derives the notable findings from the current data
+func findInsights(data analysisData) []insightCandidate {
+	var insights []insightCandidate
+	analysis := analyzeTriggers(data, defaultAnalysisOptions())
+
+	for _, t := range analysis.rankTriggers() {
+		if t.Count < minInsightTriggerCount || t.Lift < minInsightTriggerLift {
+			continue
+		}
+		insights = append(insights, insightCandidate{
+			Kind:        insightNewTrigger,
+			Fingerprint: fmt.Sprintf("%s:%s:%s", insightNewTrigger, t.Type, t.Name),
+			Message:     fmt.Sprintf("%s came the day before %d of your symptom spikes, spikes are %.1fx as likely after it", t.Name, t.Count, t.Lift),
+			Data:        t,
+		})
+	}
+
+	days := analysis.ScoredDays
+	if len(days) > 0 {
+		latest := days[len(days)-1].Date
+		var thisWeek, lastWeek []float64
+		for _, d := range days {
+			age := daysBetween(d.Date, latest)
+			switch {
+			case age < 7:
+				thisWeek = append(thisWeek, d.Score)
+			case age < 14:
+				lastWeek = append(lastWeek, d.Score)
+			}
+		}
+		if len(thisWeek) >= 3 && len(lastWeek) >= 3 {
+			current, _ := meanStdDev(thisWeek)
+			previous, _ := meanStdDev(lastWeek)
+			if current-previous >= worseningTrendDelta {
+				insights = append(insights, insightCandidate{
+					Kind:        insightWorseningTrend,
+					Fingerprint: fmt.Sprintf("%s:%s", insightWorseningTrend, latest.Format("2006-01-02")),
+					Message:     fmt.Sprintf("Your average symptom severity rose from %.1f to %.1f over the last week", previous, current),
+					Data:        map[string]float64{"previous_average": previous, "current_average": current},
+				})
+			}
+		}
+
+		// Consecutive logged days ending at the latest entry
+		streak := 1
+		for i := len(days) - 1; i > 0 && daysBetween(days[i-1].Date, days[i].Date) == 1; i-- {
+			streak++
+		}
+		// Only the highest milestone reached, a streak first seen at 30 days
+		// shouldn't also announce 7 and 14
+		streakStart := latest.AddDate(0, 0, 1-streak)
+		milestone := 0
+		for _, m := range streakMilestones {
+			if streak >= m {
+				milestone = m
+			}
+		}
+		if milestone > 0 {
+			insights = append(insights, insightCandidate{
+				Kind:        insightLoggingStreak,
+				Fingerprint: fmt.Sprintf("%s:%s:%d", insightLoggingStreak, streakStart.Format("2006-01-02"), milestone),
+				Message:     fmt.Sprintf("You've logged symptoms %d days in a row", milestone),
+				Data:        map[string]any{"days": milestone, "since": streakStart},
+			})
+		}
+	}
+
+	return insights
+}
+
+// refreshInsights stores any new findings. Existing fingerprints, including
+// dismissed ones, are left alone.
+func refreshInsights(ctx context.Context, queries *database.Queries) (int, error) {
+	data, err := loadAnalysisData(ctx, queries)
+	if err != nil {
+		return 0, err
+	}
+	if len(data.Symptoms) == 0 {
+		return 0, nil
+	}
+
+	var added int
+	for _, insight := range findInsights(data) {
+		payload, err := json.Marshal(insight.Data)
+		if err != nil {
+			return added, err
+		}
+		n, err := queries.InsertInsight(ctx, database.InsertInsightParams{
+			Kind:        insight.Kind,
+			Fingerprint: insight.Fingerprint,
+			Message:     insight.Message,
+			Data:        payload,
+		})
+		if err != nil {
+			return added, err
+		}
+		added += int(n)
+	}
+	return added, nil
+}
+
+// startInsightRefresh looks for new findings in the background whenever the
+// data changed, so reading the feed never has to write
+func startInsightRefresh(ctx context.Context, queries *database.Queries) {
+	go func() {
+		ticker := time.NewTicker(snapshotRefreshInterval)
+		defer ticker.Stop()
+		var seen string
+		for {
+			version, err := dataVersion(ctx, queries)
+			if err == nil && version != seen {
+				if _, err = refreshInsights(ctx, queries); err == nil {
+					seen = version
+				}
+			}
+			if err != nil {
+				slog.Error("insight refresh failed", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+type insightResponse struct {
+	ID          int32           `json:"id"`
+	Kind        string          `json:"kind"`
+	Message     string          `json:"message"`
+	Data        json.RawMessage `json:"data"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	DismissedAt *time.Time      `json:"dismissed_at"`
+}
+
+func newInsightResponse(i database.Insight) insightResponse {
+	res := insightResponse{
+		ID:          i.ID,
+		Kind:        i.Kind,
+		Message:     i.Message,
+		Data:        i.Data,
+		GeneratedAt: i.GeneratedAt.Time,
+	}
+	if i.DismissedAt.Valid {
+		res.DismissedAt = &i.DismissedAt.Time
+	}
+	return res
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindInsightsOnlyHighestStreakMilestone(t *testing.T) {
+	var data analysisData
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 32; i++ {
+		data.Symptoms = append(data.Symptoms, testSymptom(start.AddDate(0, 0, i).Format("2006-01-02"), 2, 2, 2))
+	}
+
+	var streaks []insightCandidate
+	for _, insight := range findInsights(data) {
+		if insight.Kind == insightLoggingStreak {
+			streaks = append(streaks, insight)
+		}
+	}
+	if len(streaks) != 1 {
+		t.Fatalf("got %d streak insights, want 1", len(streaks))
+	}
+	if want := "logging_streak:2025-06-01:30"; streaks[0].Fingerprint != want {
+		t.Errorf("fingerprint %s, want %s", streaks[0].Fingerprint, want)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"terrahack2025-backend/database"
+)
+
+// Minimum data each analysis endpoint needs, reported back to the client
+// when it isn't met
+const (
+	requireSymptomEntry    = "at least 1 symptom entry"
+	requireDietEntry       = "at least 1 diet entry"
+	requireDietSymptomDays = "at least 2 days with diet logged and symptoms scored that day or the next"
+	requireRecentFactors   = "sleep, diet or menstrual data logged in the last 3 entries"
+	requireSpikeTriggers   = "at least 1 trigger logged the day before a past symptom spike"
+	requireEventWindows    = "the event logged at least once with symptoms scored both before and after it"
+	requireCycleSymptoms   = "at least 1 logged period start followed by symptom entries"
+)
+
+// The "data_requirements" setting overrides any of the counted minimums,
+// e.g. {"forecast_cycles": 4}, anything left out keeps its default
+const dataRequirementsSetting = "data_requirements"
+
+// dataRequirements are the minimums for analyses that need more than one
+// entry to mean anything
+type dataRequirements struct {
+	// Days with a symptom score before z-scores are computed
+	ZScoreDays int `json:"zscore_days"`
+	// Days a food was logged and followed by a symptom entry before its
+	// drill-down is shown
+	FoodTriggerDays int `json:"food_trigger_days"`
+	// Complete cycles before symptoms are forecast by cycle day
+	ForecastCycles int `json:"forecast_cycles"`
+	// Days logged for both factors before a correlation is reported
+	CorrelationOverlapDays int `json:"correlation_overlap_days"`
+	// Symptom spikes before trigger pairs are looked for
+	CooccurrenceSpikes int `json:"cooccurrence_spikes"`
+}
+
+func defaultDataRequirements() dataRequirements {
+	return dataRequirements{
+		ZScoreDays:             2,
+		FoodTriggerDays:        minFoodTriggerDays,
+		ForecastCycles:         minForecastCycles,
+		CorrelationOverlapDays: minCorrelationOverlap,
+		CooccurrenceSpikes:     minCooccurrenceSpikes,
+	}
+}
+
+func (r dataRequirements) validate() error {
+	switch {
+	case r.ZScoreDays < 2:
+		return errors.New("invalid zscore_days, expected at least 2")
+	case r.FoodTriggerDays < 1:
+		return errors.New("invalid food_trigger_days, expected at least 1")
+	case r.ForecastCycles < 1:
+		return errors.New("invalid forecast_cycles, expected at least 1")
+	case r.CorrelationOverlapDays < 3:
+		return errors.New("invalid correlation_overlap_days, expected at least 3")
+	case r.CooccurrenceSpikes < 1:
+		return errors.New("invalid cooccurrence_spikes, expected at least 1")
+	}
+	return nil
+}
+
+// validDataRequirementsSetting checks a value for the data_requirements
+// setting before it is stored
+func validDataRequirementsSetting(value []byte) error {
+	r := defaultDataRequirements()
+	if err := json.Unmarshal(value, &r); err != nil {
+		return errors.New("data_requirements must be an object of integer minimums")
+	}
+	return r.validate()
+}
+
+// loadDataRequirements returns the defaults with the stored overrides applied
+func loadDataRequirements(ctx context.Context, queries *database.Queries) (dataRequirements, error) {
+	r := defaultDataRequirements()
+	err := loadSetting(ctx, queries, dataRequirementsSetting, &r)
+	return r, err
+}
+
+// shortfall is how far a counted requirement is from being met
+type shortfall struct {
+	Need int
+	Have int
+	// What is counted, plural, e.g. "complete cycles of logged period starts"
+	Unit string
+}
+
+const statusInsufficientData = "insufficient_data"
+
+// respondInsufficientData answers 200 with the shared not-enough-data shape,
+// so clients can tell it apart from real results by the status field
+// instead of parsing the message. extra adds endpoint-specific context.
+func respondInsufficientData(c *gin.Context, message, requirement string, extra gin.H) {
+	res := gin.H{
+		"status":      statusInsufficientData,
+		"message":     message,
+		"requirement": requirement,
+	}
+	for k, v := range extra {
+		res[k] = v
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// respondShortfall is respondInsufficientData for a counted requirement,
+// saying exactly what is short, e.g. "need 3 complete cycles of logged
+// period starts, have 1"
+func respondShortfall(c *gin.Context, message string, s shortfall, extra gin.H) {
+	res := gin.H{
+		"need":      s.Need,
+		"have":      s.Have,
+		"shortfall": fmt.Sprintf("need %d %s, have %d", s.Need, s.Unit, s.Have),
+	}
+	for k, v := range extra {
+		res[k] = v
+	}
+	respondInsufficientData(c, message, fmt.Sprintf("at least %d %s", s.Need, s.Unit), res)
+}
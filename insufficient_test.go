@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"terrahack2025-backend/database"
+)
+
+func TestRespondShortfall(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		s               shortfall
+		wantShortfall   string
+		wantRequirement string
+	}{
+		{
+			shortfall{Need: 3, Have: 1, Unit: "complete cycles of logged period starts"},
+			"need 3 complete cycles of logged period starts, have 1",
+			"at least 3 complete cycles of logged period starts",
+		},
+		{
+			// An overridden requirement is reported as set
+			shortfall{Need: 5, Have: 2, Unit: "symptom spikes"},
+			"need 5 symptom spikes, have 2",
+			"at least 5 symptom spikes",
+		},
+		{
+			shortfall{Need: 2, Have: 0, Unit: "days with symptoms logged"},
+			"need 2 days with symptoms logged, have 0",
+			"at least 2 days with symptoms logged",
+		},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		respondShortfall(c, "Not enough data.", tt.s, gin.H{"cycles_used": tt.s.Have})
+
+		if w.Code != http.StatusOK {
+			t.Errorf("status %d, want 200", w.Code)
+		}
+		var res struct {
+			Status      string `json:"status"`
+			Requirement string `json:"requirement"`
+			Shortfall   string `json:"shortfall"`
+			Need        int    `json:"need"`
+			Have        int    `json:"have"`
+			CyclesUsed  int    `json:"cycles_used"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Shortfall != tt.wantShortfall {
+			t.Errorf("shortfall %q, want %q", res.Shortfall, tt.wantShortfall)
+		}
+		if res.Requirement != tt.wantRequirement {
+			t.Errorf("requirement %q, want %q", res.Requirement, tt.wantRequirement)
+		}
+		if res.Status != statusInsufficientData || res.Need != tt.s.Need || res.Have != tt.s.Have || res.CyclesUsed != tt.s.Have {
+			t.Errorf("unexpected response %s", w.Body)
+		}
+	}
+}
+
+func TestValidDataRequirementsSetting(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{`{"forecast_cycles": 4}`, true},
+		{`{"correlation_overlap_days": 3}`, true},
+		{`{}`, true},
+		{`{"forecast_cycles": 0}`, false},
+		{`{"zscore_days": 1}`, false},
+		{`{"correlation_overlap_days": 2}`, false},
+		{`[4]`, false},
+	}
+	for _, tt := range tests {
+		if err := validDataRequirementsSetting([]byte(tt.value)); (err == nil) != tt.ok {
+			t.Errorf("validDataRequirementsSetting(%s) = %v, want ok %v", tt.value, err, tt.ok)
+		}
+	}
+}
+
+func TestForecastConfidenceFollowsRequirement(t *testing.T) {
+	if got := forecastConfidence(3, 4, minForecastCycles); got != "medium" {
+		t.Errorf("3 cycles at the default minimum = %s, want medium", got)
+	}
+	if got := forecastConfidence(3, 4, 4); got != "low" {
+		t.Errorf("3 cycles with forecast_cycles 4 = %s, want low", got)
+	}
+	if got := forecastConfidence(6, 2, 8); got != "low" {
+		t.Errorf("6 cycles with forecast_cycles 8 = %s, want low", got)
+	}
+}
+
+func testDate(date string) pgtype.Date {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		panic(err)
+	}
+	return pgtype.Date{Time: d, Valid: true}
+}
+
+// tinyData has the given numbers of sleep, diet and symptom rows on
+// consecutive days from 2025-07-01, the sizes at which the analyses used to
+// misbehave
+func tinyData(sleep, diet, symptoms int) analysisData {
+	var data analysisData
+	day := func(i int) string { return time.Date(2025, 7, 1+i, 0, 0, 0, 0, time.UTC).Format("2006-01-02") }
+	for i := 0; i < sleep; i++ {
+		data.Sleep = append(data.Sleep, database.Sleep{
+			Date:     testDate(day(i)),
+			Duration: pgtype.Float8{Float64: float64(5 + i), Valid: true},
+			Quality:  pgtype.Int4{Int32: int32(4 + i), Valid: true},
+			Source:   sourceManual,
+		})
+	}
+	for i := 0; i < diet; i++ {
+		data.Diet = append(data.Diet, database.Diet{Date: testDate(day(i)), Items: []string{"toast", "coffee"}[:1+i%2], Source: sourceManual})
+	}
+	for i := 0; i < symptoms; i++ {
+		data.Symptoms = append(data.Symptoms, testSymptom(day(i), int32(2+3*i), 3, 4))
+	}
+	return data
+}
+
+func TestTinyDatasetsAnswerInsufficientData(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Each endpoint's requirement for 0, 1 or 2 rows per domain, empty when
+	// it answers with results
+	endpoints := []struct {
+		path    string
+		respond func(c *gin.Context, data analysisData)
+		want    func(sleep, diet, symptoms int) string
+	}{
+		{
+			"/predict_flareups",
+			func(c *gin.Context, data analysisData) {
+				respondFlareupPrediction(c, data, defaultAnalysisOptions(), ratioModel{}, nil)
+			},
+			func(sleep, diet, symptoms int) string {
+				switch {
+				case symptoms == 0:
+					return requireSymptomEntry
+				case sleep == 0 && diet == 0:
+					return requireRecentFactors
+				}
+				// Two days can't hold a trigger the day before a spike
+				return requireSpikeTriggers
+			},
+		},
+		{
+			"/diet_volume_impact",
+			func(c *gin.Context, data analysisData) {
+				respondDietVolumeImpact(c, scoreSymptomDays(data.Symptoms, aggregateMean), data.Diet)
+			},
+			func(sleep, diet, symptoms int) string {
+				switch {
+				case symptoms == 0:
+					return requireSymptomEntry
+				case diet == 0:
+					return requireDietEntry
+				case diet < 2 || symptoms < 2:
+					return requireDietSymptomDays
+				}
+				return ""
+			},
+		},
+		{
+			"/correlation_matrix",
+			func(c *gin.Context, data analysisData) {
+				respondCorrelationMatrix(c, data, aggregateMean, minCorrelationOverlap)
+			},
+			func(sleep, diet, symptoms int) string {
+				if symptoms == 0 {
+					return requireSymptomEntry
+				}
+				return ""
+			},
+		},
+	}
+	for _, e := range endpoints {
+		for sleep := 0; sleep <= 2; sleep++ {
+			for diet := 0; diet <= 2; diet++ {
+				for symptoms := 0; symptoms <= 2; symptoms++ {
+					w := httptest.NewRecorder()
+					c, _ := gin.CreateTestContext(w)
+					c.Request = httptest.NewRequest(http.MethodGet, e.path, nil)
+					e.respond(c, tinyData(sleep, diet, symptoms))
+
+					name := fmt.Sprintf("%s with %d sleep, %d diet and %d symptom rows", e.path, sleep, diet, symptoms)
+					if w.Code != http.StatusOK {
+						t.Errorf("%s: status %d: %s", name, w.Code, w.Body)
+						continue
+					}
+					var res struct {
+						Status      string              `json:"status"`
+						Requirement string              `json:"requirement"`
+						Matrix      [][]correlationCell `json:"matrix"`
+					}
+					if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+						t.Errorf("%s: %v: %s", name, err, w.Body)
+						continue
+					}
+					want := e.want(sleep, diet, symptoms)
+					if want != "" && (res.Status != statusInsufficientData || res.Requirement != want) {
+						t.Errorf("%s: got %s, want insufficient_data requiring %q", name, w.Body, want)
+					}
+					if want == "" && res.Status != "" {
+						t.Errorf("%s: got %s, want results", name, w.Body)
+					}
+					// Far fewer days than the overlap minimum leaves every cell empty
+					for _, row := range res.Matrix {
+						for _, cell := range row {
+							if !cell.InsufficientData || cell.Correlation != nil {
+								t.Errorf("%s: cell %+v is not marked insufficient_data", name, cell)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
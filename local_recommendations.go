@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	recommendationModeAI    = "ai"
+	recommendationModeLocal = "local"
+	// Gemini only sees the triggers that passed the significance test
+	recommendationModeSignificant = "significant"
+)
+
+// A trigger is only worth a local recommendation once it has preceded a
+// couple of spikes and the following days score noticeably higher
+const (
+	minLocalTriggerCount    = 2
+	minLocalSeverityRisePct = 10
+	// Correlations weaker than this aren't mentioned
+	minLocalCorrelation = 0.3
+)
+
+// localRecommendations builds up to count recommendations from the ranked
+// triggers and correlations alone, for mode=local where nothing is sent to
+// Gemini. Remaining slots are filled with the generic fallbacks.
+// Correlations need minOverlap days logged for both factors.
+func localRecommendations(data analysisData, analysis triggerAnalysis, count int, restrictions []string, minOverlap int) []string {
+	var recommendations []string
+	rises := analysis.nextDaySeverityRise()
+	for _, t := range analysis.rankTriggers() {
+		key := t.Type + ":" + t.Name
+		if t.Type == "low_sleep" {
+			key = "low_sleep"
+		}
+		rise, ok := rises[key]
+		if !ok || t.Count < minLocalTriggerCount || t.Lift <= 1 || rise < minLocalSeverityRisePct {
+			continue
+		}
+		switch t.Type {
+		case "low_sleep":
+			recommendations = append(recommendations, fmt.Sprintf("Your symptoms are %.0f%% higher after %s, prioritise sleep", rise, lowSleepNights(analysis.ByDate.SleepTrigger)))
+		case "food":
+			recommendations = append(recommendations, fmt.Sprintf("Your symptoms are %.0f%% higher the day after eating %s, try cutting back on it", rise, t.Name))
+		case "menstrual_event":
+			recommendations = append(recommendations, fmt.Sprintf("Your symptoms are %.0f%% higher the day after your period %s, plan lighter days around it", rise, t.Name))
+		case "flow_level":
+			recommendations = append(recommendations, fmt.Sprintf("Your symptoms are %.0f%% higher after %s flow days, plan extra rest for them", rise, t.Name))
+		}
+	}
+
+	series := dailyFactorSeries(data, aggregateMean)
+	correlation := func(a, b string) (float64, bool) {
+		cell := correlationMatrix(series, []string{a, b}, minOverlap)[0][1]
+		if cell.Correlation == nil {
+			return 0, false
+		}
+		return *cell.Correlation, true
+	}
+	if r, ok := correlation("sleep_quality", "symptom_score"); ok && r <= -minLocalCorrelation {
+		recommendations = append(recommendations, fmt.Sprintf("Better sleep quality goes with milder symptoms for you (r = %.2f), keep a consistent bedtime", r))
+	}
+	if r, ok := correlation("diet_item_count", "symptom_score"); ok && r >= minLocalCorrelation {
+		recommendations = append(recommendations, fmt.Sprintf("Days you eat more items go with worse symptoms for you (r = %.2f), try smaller, simpler meals", r))
+	}
+
+	// Only the generic fallbacks, the trigger-based ones would repeat the above
+	recommendations = append(recommendations, fallbackRecommendations(triggerCounts{}, count, restrictions)...)
+	if len(recommendations) > count {
+		recommendations = recommendations[:count]
+	}
+	return recommendations
+}
+
+// nextDaySeverityRise is, per factor, how much higher in percent the mean
+// score is on days after the factor was logged than on all scored days
+func (a triggerAnalysis) nextDaySeverityRise() map[string]float64 {
+	totals := map[string]float64{}
+	counts := map[string]int{}
+	for i := 1; i < len(a.ScoredDays); i++ {
+		d := a.ScoredDays[i]
+		for factor := range a.ByDate.factors(d.Date.AddDate(0, 0, -1).Format("2006-01-02")) {
+			totals[factor] += d.Score
+			counts[factor]++
+		}
+	}
+
+	rises := map[string]float64{}
+	if a.Mean == 0 {
+		return rises
+	}
+	for factor, total := range totals {
+		rises[factor] = math.Round((total/float64(counts[factor])/a.Mean-1)*100*100) / 100
+	}
+	return rises
+}
+
+// lowSleepNights describes the nights the low-sleep trigger counts
+func lowSleepNights(sleepTrigger string) string {
+	switch sleepTrigger {
+	case sleepTriggerQuality:
+		return fmt.Sprintf("nights rated below %d/10", lowSleepQuality)
+	case sleepTriggerBoth:
+		return fmt.Sprintf("nights under %dh or rated below %d/10", lowSleepHours, lowSleepQuality)
+	default:
+		return fmt.Sprintf("nights under %dh of sleep", lowSleepHours)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// setupLogging installs a structured default logger at the level given by
+// LOG_LEVEL (debug, info, warn or error). Defaults to info.
+func setupLogging() {
+	level := slog.LevelInfo
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	// Gin's route dump and debug warnings are only useful at debug level
+	if level > slog.LevelDebug {
+		gin.SetMode(gin.ReleaseMode)
+	}
+}
+
+// requestLogger replaces gin's default logger so request logs respect LOG_LEVEL
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		slog.Info("request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration", time.Since(start),
+		)
+	}
+}
+
+type queryLogKey struct{}
+
+type queryLogStart struct {
+	name  string
+	start time.Time
+}
+
+// queryLogger logs each query's name and duration at debug level. Query
+// arguments are never logged since they can contain free-text notes.
+type queryLogger struct{}
+
+func (queryLogger) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return ctx
+	}
+	return context.WithValue(ctx, queryLogKey{}, queryLogStart{name: queryName(data.SQL), start: time.Now()})
+}
+
+func (queryLogger) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	q, ok := ctx.Value(queryLogKey{}).(queryLogStart)
+	if !ok {
+		return
+	}
+	attrs := []any{
+		"name", q.name,
+		"duration", time.Since(q.start),
+		"rows", data.CommandTag.RowsAffected(),
+	}
+	if data.Err != nil {
+		attrs = append(attrs, "error", data.Err)
+	}
+	slog.DebugContext(ctx, "query", attrs...)
+}
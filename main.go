@@ -2,19 +2,26 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"math"
+	"net"
 	"net/http"
 	"os"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/multitracer"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"google.golang.org/genai"
 
 	"terrahack2025-backend/database"
@@ -24,63 +31,143 @@ func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println(".env file not found, using environment variables")
 	}
+	setupLogging()
 
-	dbURL := os.Getenv("DATABASE_URL")
+	dbURL := envOrFile("DATABASE_URL")
 	if dbURL == "" {
-		log.Fatal("Missing required environment variable: DATABASE_URL")
+		log.Fatal("Missing required environment variable: DATABASE_URL or DATABASE_URL_FILE")
 	}
 
-	port := os.Getenv("PORT")
+	port := envOrFile("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	geminiAPIKey := os.Getenv("GEMINI_API_KEY")
-	if geminiAPIKey == "" {
-		log.Fatal("Missing required environment variable: GEMINI_API_KEY")
+	// Empty host binds on all interfaces
+	host := os.Getenv("HOST")
+	addr := net.JoinHostPort(host, port)
+
+	// Seeding writes fake data, so it needs an explicit opt-in and is never
+	// available in production
+	allowSeed := os.Getenv("ALLOW_SEED") == "true"
+	if allowSeed && os.Getenv("APP_ENV") == "production" {
+		log.Println("ALLOW_SEED is ignored when APP_ENV=production")
+		allowSeed = false
 	}
 
-	ctx2 := context.Background()
-	client, err := genai.NewClient(ctx2, &genai.ClientConfig{
-		APIKey: geminiAPIKey,
-	})
+	// Debug endpoints expose the shape of the user's data, so like seeding
+	// they need an explicit opt-in and are never available in production
+	debugEndpoints := os.Getenv("ENABLE_DEBUG_ENDPOINTS") == "true"
+	if debugEndpoints && os.Getenv("APP_ENV") == "production" {
+		log.Println("ENABLE_DEBUG_ENDPOINTS is ignored when APP_ENV=production")
+		debugEndpoints = false
+	}
 
-	if err != nil {
-		log.Fatal(err)
+	// Gemini is optional, without it the AI endpoints degrade and everything
+	// else keeps working
+	var client *genai.Client
+	if geminiAPIKey := envOrFile("GEMINI_API_KEY"); geminiAPIKey == "" {
+		log.Println("GEMINI_API_KEY is not set, AI is disabled")
+	} else {
+		c, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+			APIKey: geminiAPIKey,
+		})
+		if err != nil {
+			log.Printf("Unable to create Gemini client, AI is disabled: %v", err)
+		} else {
+			client = c
+		}
 	}
 
 	ctx := context.Background()
 
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		log.Fatalf("Unable to set up tracing: %v", err)
+	}
+	defer shutdownTracing(ctx)
+
+	poolConfig, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		log.Fatalf("Invalid DATABASE_URL: %v", err)
+	}
+	poolConfig.ConnConfig.Tracer = multitracer.New(queryTracer{}, queryLogger{})
+
 	// Use pgxpool instead of pgx.Connect
-	pool, err := pgxpool.New(ctx, dbURL)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		log.Fatalf("Unable to connect to database pool: %v", err)
 	}
 	defer pool.Close()
 
-	r := gin.Default()
+	// Off by default, real deployments apply migrations separately
+	if os.Getenv("AUTO_MIGRATE") == "true" {
+		if err := autoMigrate(ctx, pool); err != nil {
+			log.Fatalf("Auto-migrate failed: %v", err)
+		}
+	}
+
+	startWeeklyReports(ctx, database.New(pool), smtpConfigFromEnv())
+	startSnapshotRefresh(ctx, database.New(pool), client)
+	startInsightRefresh(ctx, database.New(pool))
+	startRetentionPurge(ctx, pool)
+
+	// Explanations only change when the ranked triggers do
+	explainCache := newTTLCache[string](6 * time.Hour)
+
+	registerValidators()
+	r := gin.New()
+	r.Use(requestLogger(), gin.Recovery())
+	r.Use(otelgin.Middleware(tracerName))
+	r.Use(validateRequestSchema())
+
+	// Attached to the analytics routes so they fail fast instead of queueing
+	// for a connection when the pool is exhausted
+	shed := poolBackpressure(pool, poolSaturationThreshold())
+	cached := lastModified(pool, analyticsCacheMaxAge())
 
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "pong"})
 	})
 
-	r.POST("/insert_sleep", func(c *gin.Context) {
-		var req struct {
-			Date        string  `json:"date"`
-			Duration    float64 `json:"duration"`
-			Quality     int32   `json:"quality"`
-			Disruptions string  `json:"disruptions"`
-			Notes       string  `json:"notes"`
-		}
+	r.GET("/metrics", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"pool": poolMetrics(pool.Stat())})
+	})
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// Operator-only aggregate stats, registered only when ADMIN_API_KEY is set
+	if adminKey := envOrFile("ADMIN_API_KEY"); adminKey != "" {
+		r.GET("/admin/stats", adminAuth(adminKey), func(c *gin.Context) {
+			queries := database.New(pool)
+			stats, err := queries.GetUsageStats(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"records": gin.H{
+					"sleep":     stats.SleepRecords,
+					"diet":      stats.DietRecords,
+					"menstrual": stats.MenstrualRecords,
+					"symptoms":  stats.SymptomRecords,
+					"journal":   stats.JournalRecords,
+				},
+				"active_days_last_7":  stats.ActiveDays7,
+				"active_days_last_30": stats.ActiveDays30,
+				"ai_enabled":          client != nil,
+				"gemini_calls":        geminiCalls.Load(),
+				"gemini_calls_since":  processStarted.UTC(),
+			})
+		})
+	}
+
+	r.POST("/insert_sleep", func(c *gin.Context) {
+		var req sleepRequest
+		if !bindJSON(c, &req) || !checkRequest(c, &req) {
 			return
 		}
 
-		parsedDate, err := time.Parse(time.RFC3339, req.Date)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date format, expected RFC3339"})
+		parsedDate, ok := parseRequestDate(c, database.New(pool), "date", req.Date)
+		if !ok {
 			return
 		}
 
@@ -90,6 +177,7 @@ func main() {
 			Quality:     pgtype.Int4{Int32: req.Quality, Valid: true},
 			Disruptions: pgtype.Text{String: req.Disruptions, Valid: true},
 			Notes:       pgtype.Text{String: req.Notes, Valid: true},
+			Source:      optionalText(req.Source),
 		}
 
 		queries := database.New(pool)
@@ -103,29 +191,35 @@ func main() {
 	})
 
 	r.POST("/insert_diet", func(c *gin.Context) {
-		var req struct {
-			Meal  string   `json:"meal"`
-			Date  string   `json:"date"`
-			Items []string `json:"items"`
-			Notes string   `json:"notes"`
+		var req dietRequest
+		if !bindJSON(c, &req) || !checkRequest(c, &req) {
+			return
 		}
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		parsedTime, ok := parseRequestDate(c, database.New(pool), "date", req.Date)
+		if !ok {
 			return
 		}
 
-		parsedTime, err := time.Parse(time.RFC3339, req.Date)
+		meal, err := normalizeMeal(req.Meal)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date format, expected RFC3339"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		// check already rejected items splitDietItems can't split
+		items, itemDetails, _ := splitDietItems(req.Items)
+		containsCaffeine, containsAlcohol := dietFlags(items)
+
 		params := database.InsertDietParams{
-			Meal:  pgtype.Text{String: req.Meal, Valid: true},
-			Date:  pgtype.Date{Time: parsedTime, Valid: true},
-			Items: req.Items,
-			Notes: pgtype.Text{String: req.Notes, Valid: true},
+			Meal:             pgtype.Text{String: meal, Valid: true},
+			Date:             pgtype.Date{Time: parsedTime, Valid: true},
+			Items:            items,
+			Notes:            pgtype.Text{String: req.Notes, Valid: true},
+			ContainsCaffeine: containsCaffeine,
+			ContainsAlcohol:  containsAlcohol,
+			ItemDetails:      itemDetails,
+			Source:           optionalText(req.Source),
 		}
 
 		queries := database.New(pool)
@@ -139,21 +233,13 @@ func main() {
 	})
 
 	r.POST("/insert_menstrual", func(c *gin.Context) {
-		var req struct {
-			PeriodEvent string `json:"period_event"`
-			Date        string `json:"date"`
-			FlowLevel   string `json:"flow_level"`
-			Notes       string `json:"notes"`
-		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var req menstrualRequest
+		if !bindJSON(c, &req) || !checkRequest(c, &req) {
 			return
 		}
 
-		parsedDate, err := time.Parse(time.RFC3339, req.Date)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date format, expected RFC3339"})
+		parsedDate, ok := parseRequestDate(c, database.New(pool), "date", req.Date)
+		if !ok {
 			return
 		}
 
@@ -162,6 +248,7 @@ func main() {
 			Date:        pgtype.Date{Time: parsedDate, Valid: true},
 			FlowLevel:   pgtype.Text{String: req.FlowLevel, Valid: true},
 			Notes:       pgtype.Text{String: req.Notes, Valid: true},
+			Source:      optionalText(req.Source),
 		}
 
 		queries := database.New(pool)
@@ -175,29 +262,22 @@ func main() {
 	})
 
 	r.POST("/insert_symptoms", func(c *gin.Context) {
-		var req struct {
-			Date    string `json:"date"`
-			Nausea  int32  `json:"nausea"`
-			Fatigue int32  `json:"fatigue"`
-			Pain    int32  `json:"pain"`
-			Notes   string `json:"notes"`
-		}
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var req symptomsRequest
+		if !bindJSON(c, &req) || !checkRequest(c, &req) {
 			return
 		}
-		parsedDate, err := time.Parse(time.RFC3339, req.Date)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date format, expected RFC3339"})
+		parsedDate, ok := parseRequestDate(c, database.New(pool), "date", req.Date)
+		if !ok {
 			return
 		}
 
 		params := database.InsertSymptomsParams{
 			Date:    pgtype.Date{Time: parsedDate, Valid: true},
-			Nausea:  pgtype.Int4{Int32: req.Nausea, Valid: true},
-			Fatigue: pgtype.Int4{Int32: req.Fatigue, Valid: true},
-			Pain:    pgtype.Int4{Int32: req.Pain, Valid: true},
+			Nausea:  optionalInt4(req.Nausea),
+			Fatigue: optionalInt4(req.Fatigue),
+			Pain:    optionalInt4(req.Pain),
 			Notes:   pgtype.Text{String: req.Notes, Valid: true},
+			Source:  optionalText(req.Source),
 		}
 
 		queries := database.New(pool)
@@ -209,9 +289,26 @@ func main() {
 		c.JSON(http.StatusOK, res)
 	})
 
-	r.GET("/get_all_sleep", func(c *gin.Context) {
+	// Logging a factor again for the same day replaces whether it was present
+	r.POST("/insert_custom_factor", func(c *gin.Context) {
+		var req customFactorRequest
+		if !bindJSON(c, &req) || !checkRequest(c, &req) {
+			return
+		}
+		parsedDate, ok := parseRequestDate(c, database.New(pool), "date", req.Date)
+		if !ok {
+			return
+		}
+		name := normalizeItem(req.FactorName)
+
+		params := database.UpsertCustomFactorParams{
+			FactorName: name,
+			Date:       pgtype.Date{Time: parsedDate, Valid: true},
+			Present:    req.Present == nil || *req.Present,
+		}
+
 		queries := database.New(pool)
-		res, err := queries.GetAllSleep(c.Request.Context())
+		res, err := queries.UpsertCustomFactor(c.Request.Context(), params)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -219,9 +316,24 @@ func main() {
 		c.JSON(http.StatusOK, res)
 	})
 
-	r.GET("/get_all_diet", func(c *gin.Context) {
+	r.POST("/insert_journal", func(c *gin.Context) {
+		var req journalRequest
+		if !bindJSON(c, &req) || !checkRequest(c, &req) {
+			return
+		}
+		parsedDate, ok := parseRequestDate(c, database.New(pool), "date", req.Date)
+		if !ok {
+			return
+		}
+		text := strings.TrimSpace(req.Text)
+
+		params := database.InsertJournalParams{
+			Date: pgtype.Date{Time: parsedDate, Valid: true},
+			Text: text,
+		}
+
 		queries := database.New(pool)
-		res, err := queries.GetAllDiet(c.Request.Context())
+		res, err := queries.InsertJournal(c.Request.Context(), params)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -229,705 +341,2587 @@ func main() {
 		c.JSON(http.StatusOK, res)
 	})
 
-	r.GET("/get_all_menstrual", func(c *gin.Context) {
-		queries := database.New(pool)
-		res, err := queries.GetAllMenstrual(c.Request.Context())
+	// Runs an insert's validation without saving, e.g. POST /validate?type=symptoms
+	// with the body that would go to /insert_symptoms
+	r.POST("/validate", func(c *gin.Context) {
+		entry, ok := entryTypes[c.Query("type")]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid type, expected one of sleep, diet, menstrual, symptoms, custom_factor, journal"})
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, res)
+		errs, ok := validateEntry(c, database.New(pool), entry.route, body, entry.newRequest())
+		if !ok {
+			return
+		}
+		if len(errs) > 0 {
+			c.JSON(http.StatusOK, gin.H{"valid": false, "errors": errs})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"valid": true})
 	})
 
-	r.GET("/get_all_symptoms", func(c *gin.Context) {
+	r.GET("/get_all_sleep", func(c *gin.Context) {
 		queries := database.New(pool)
-		res, err := queries.GetAllSymptoms(c.Request.Context())
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
+			return
+		}
+		res, err := queries.GetAllSleep(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, res)
+		c.JSON(http.StatusOK, filterByDate(res, func(r database.Sleep) pgtype.Date { return r.Date }, dates))
 	})
 
-	r.GET("/find_triggers", func(c *gin.Context) {
+	r.GET("/get_all_diet", func(c *gin.Context) {
 		queries := database.New(pool)
-
-		sleepData, err := queries.GetAllSleep(c.Request.Context())
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
+			return
+		}
+		res, err := queries.GetAllDiet(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		dietData, err := queries.GetAllDiet(c.Request.Context())
+		c.JSON(http.StatusOK, filterByDate(res, func(r database.Diet) pgtype.Date { return r.Date }, dates))
+	})
+
+	r.GET("/get_all_menstrual", func(c *gin.Context) {
+		queries := database.New(pool)
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
+			return
+		}
+		res, err := queries.GetAllMenstrual(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		menstrualData, err := queries.GetAllMenstrual(c.Request.Context())
+		c.JSON(http.StatusOK, filterByDate(res, func(r database.Menstrual) pgtype.Date { return r.Date }, dates))
+	})
+
+	// Distinct menstrual values in use, most frequent first, to build
+	// dropdowns and spot typos
+	r.GET("/menstrual/vocab", func(c *gin.Context) {
+		queries := database.New(pool)
+		events, err := queries.GetPeriodEventCounts(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		symptomsData, err := queries.GetAllSymptoms(c.Request.Context())
+		levels, err := queries.GetFlowLevelCounts(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		type triggerCounts struct {
-			LowSleepHours  int
-			MenstrualEvent map[string]int
-			FlowLevel      map[string]int
-			FoodItems      map[string]int
+		type vocabEntry struct {
+			Value *string `json:"value"` // null when left empty
+			Count int32   `json:"count"`
 		}
-
-		type TriggerDetail struct {
-			Date            string  `json:"date"`
-			TriggerSeverity float64 `json:"trigger_severity"`
+		entry := func(v pgtype.Text, count int32) vocabEntry {
+			e := vocabEntry{Count: count}
+			if v.Valid {
+				e.Value = &v.String
+			}
+			return e
 		}
-
-		triggers := triggerCounts{
-			MenstrualEvent: make(map[string]int),
-			FlowLevel:      make(map[string]int),
-			FoodItems:      make(map[string]int),
+		periodEvents := []vocabEntry{}
+		for _, e := range events {
+			periodEvents = append(periodEvents, entry(e.PeriodEvent, e.Count))
 		}
-
-		// Track details per trigger for output
-		var lowSleepDetails []TriggerDetail
-		foodItemDetails := map[string][]TriggerDetail{}
-		menstrualEventDetails := map[string][]TriggerDetail{}
-		flowLevelDetails := map[string][]TriggerDetail{}
-
-		// Map data by date
-		sleepMap := map[string]database.Sleep{}
-		for _, s := range sleepData {
-			sleepMap[s.Date.Time.Format("2006-01-02")] = s
+		flowLevels := []vocabEntry{}
+		for _, l := range levels {
+			flowLevels = append(flowLevels, entry(l.FlowLevel, l.Count))
 		}
+		c.JSON(http.StatusOK, gin.H{
+			"period_events": periodEvents,
+			"flow_levels":   flowLevels,
+		})
+	})
 
-		dietMap := map[string][]database.Diet{}
-		for _, d := range dietData {
-			date := d.Date.Time.Format("2006-01-02")
-			dietMap[date] = append(dietMap[date], d)
+	r.GET("/get_all_symptoms", func(c *gin.Context) {
+		queries := database.New(pool)
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
+			return
 		}
-
-		menstrualMap := map[string]database.Menstrual{}
-		for _, m := range menstrualData {
-			menstrualMap[m.Date.Time.Format("2006-01-02")] = m
+		res, err := queries.GetAllSymptoms(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(http.StatusOK, filterByDate(res, func(r database.Symptom) pgtype.Date { return r.Date }, dates))
+	})
 
-		// Calculate mean and std dev of symptom severity
-		var scores []float64
-		for _, sym := range symptomsData {
-			avg := float64(sym.Nausea.Int32+sym.Fatigue.Int32+sym.Pain.Int32) / 3.0
-			scores = append(scores, avg)
-		}
-		if len(scores) == 0 {
-			c.JSON(http.StatusOK, gin.H{"message": "No symptom data found."})
+	r.GET("/get_all_journal", func(c *gin.Context) {
+		queries := database.New(pool)
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
 			return
 		}
-
-		var sum float64
-		for _, s := range scores {
-			sum += s
+		res, err := queries.GetAllJournal(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		mean := sum / float64(len(scores))
+		c.JSON(http.StatusOK, filterByDate(res, func(r database.Journal) pgtype.Date { return r.Date }, dates))
+	})
 
-		var squaredDiffSum float64
-		for _, s := range scores {
-			diff := s - mean
-			squaredDiffSum += diff * diff
+	r.GET("/get_all_custom_factors", func(c *gin.Context) {
+		queries := database.New(pool)
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
+			return
 		}
-		stdDev := 0.0
-		if len(scores) > 1 {
-			stdDev = squaredDiffSum / float64(len(scores)-1)
-			stdDev = math.Sqrt(stdDev)
+		res, err := queries.GetAllCustomFactors(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(http.StatusOK, filterByDate(res, func(r database.CustomFactor) pgtype.Date { return r.Date }, dates))
+	})
 
-		// Calculate spike threshold based on symptom score differences
-		type ScoredDay struct {
-			Date  time.Time
-			Score float64
-		}
-		var scoredDays []ScoredDay
-		for _, sym := range symptomsData {
-			score := float64(sym.Nausea.Int32+sym.Fatigue.Int32+sym.Pain.Int32) / 3.0
-			scoredDays = append(scoredDays, ScoredDay{Date: sym.Date.Time, Score: score})
+	r.GET("/find_triggers", shed, cached, func(c *gin.Context) {
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-		sort.Slice(scoredDays, func(i, j int) bool {
-			return scoredDays[i].Date.Before(scoredDays[j].Date)
-		})
-
-		var diffs []float64
-		for i := 1; i < len(scoredDays); i++ {
-			diff := scoredDays[i].Score - scoredDays[i-1].Score
-			diffs = append(diffs, diff)
+		groupBy := c.DefaultQuery("group_by", "item")
+		if groupBy != "item" && groupBy != "category" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group_by, expected item or category"})
+			return
 		}
-		var sumDiff float64
-		for _, d := range diffs {
-			sumDiff += d
+		// Triggers seen before fewer spikes than this are left out as noise
+		minOccurrences := 1
+		if v := c.Query("min_occurrences"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid min_occurrences, expected a positive integer"})
+				return
+			}
+			minOccurrences = n
 		}
-		meanDiff := sumDiff / float64(len(diffs))
 
-		var sqSumDiff float64
-		for _, d := range diffs {
-			sqSumDiff += (d - meanDiff) * (d - meanDiff)
+		queries := database.New(pool)
+		today, ok := userToday(c, queries)
+		if !ok {
+			return
 		}
-		stdDiff := math.Sqrt(sqSumDiff / float64(len(diffs)))
-
-		threshold := meanDiff + stdDiff
-
-		// Find spike days based on diff threshold, keep symptom severity for spike day
-		spikeDays := make(map[string]float64) // date => symptom severity
-		for i := 1; i < len(scoredDays); i++ {
-			diff := scoredDays[i].Score - scoredDays[i-1].Score
-			if diff > threshold {
-				dateStr := scoredDays[i].Date.Format("2006-01-02")
-				spikeDays[dateStr] = scoredDays[i].Score
-			}
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
+		dataAge, staleData := dataFreshness(today, data.Sleep, data.Diet, data.Menstrual, data.Symptoms)
 
-		// Check triggers on the day before spike days
-		for spikeDateStr, severity := range spikeDays {
-			spikeDate, _ := time.Parse("2006-01-02", spikeDateStr)
-			dayBefore := spikeDate.AddDate(0, 0, -1).Format("2006-01-02")
-
-			if sleep, ok := sleepMap[dayBefore]; ok {
-				if sleep.Duration.Float64 < 6 {
-					triggers.LowSleepHours++
-					lowSleepDetails = append(lowSleepDetails, TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
-				}
-			}
-
-			if diets, ok := dietMap[dayBefore]; ok {
-				for _, d := range diets {
-					for _, item := range d.Items {
-						triggers.FoodItems[item]++
-						foodItemDetails[item] = append(foodItemDetails[item], TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
-					}
-				}
-			}
-
-			if menstrual, ok := menstrualMap[dayBefore]; ok {
-				triggers.MenstrualEvent[menstrual.PeriodEvent.String]++
-				menstrualEventDetails[menstrual.PeriodEvent.String] = append(menstrualEventDetails[menstrual.PeriodEvent.String], TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
-
-				triggers.FlowLevel[menstrual.FlowLevel.String]++
-				flowLevelDetails[menstrual.FlowLevel.String] = append(flowLevelDetails[menstrual.FlowLevel.String], TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
-			}
+		if len(data.Symptoms) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
 		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"symptom_spike_threshold": threshold,
-			"symptom_average":         mean,
-			"standard_deviation":      stdDev,
+		analysis := analyzeTriggers(data, opts)
+		suppressed := analysis.dropRare(minOccurrences)
+
+		baseRate, lifts := analysis.lifts()
+		foodLifts := map[string]float64{}
+		for item := range analysis.Triggers.FoodItems {
+			foodLifts[item] = lifts["food:"+item].Lift
+		}
+		menstrualEventLifts := map[string]float64{}
+		for event := range analysis.Triggers.MenstrualEvent {
+			menstrualEventLifts[event] = lifts["menstrual_event:"+event].Lift
+		}
+		flowLevelLifts := map[string]float64{}
+		for level := range analysis.Triggers.FlowLevel {
+			flowLevelLifts[level] = lifts["flow_level:"+level].Lift
+		}
+		customFactorLifts := map[string]float64{}
+		for name := range analysis.Triggers.CustomFactors {
+			customFactorLifts[name] = lifts["custom:"+name].Lift
+		}
+
+		res := gin.H{
+			"symptom_spike_threshold": analysis.Threshold,
+			"symptom_average":         analysis.Mean,
+			"standard_deviation":      analysis.StdDev,
+			"baseline":                opts.Baseline,
+			"baseline_window_days":    opts.BaselineWindow,
+			"min_spike_delta":         opts.MinSpikeDelta,
+			"min_spike_severity":      opts.MinSpikeSeverity,
+			"data_age_days":           dataAge,
+			"stale_data":              staleData,
+			"base_spike_rate":         baseRate,
+			"min_occurrences":         minOccurrences,
+			"suppressed_triggers":     suppressed,
+			"lift_explanation": "lift = P(spike | trigger logged the day before) / P(spike). " +
+				"P(spike) is the share of all scored days (after the first) that were spikes; " +
+				"a lift above 1 means spikes are more likely after the trigger than on an average day.",
 
 			"low_sleep_hours": map[string]interface{}{
-				"count":   triggers.LowSleepHours,
-				"details": lowSleepDetails,
+				"count":   analysis.Triggers.LowSleepHours,
+				"details": analysis.LowSleepDetails,
+				"lift":    lifts["low_sleep"].Lift,
 			},
 			"common_food_items": map[string]interface{}{
-				"counts":  triggers.FoodItems,
-				"details": foodItemDetails,
+				"counts":  analysis.Triggers.FoodItems,
+				"details": analysis.FoodItemDetails,
+				"lifts":   foodLifts,
 			},
 			"menstrual_events": map[string]interface{}{
-				"counts":  triggers.MenstrualEvent,
-				"details": menstrualEventDetails,
+				"counts":  analysis.Triggers.MenstrualEvent,
+				"details": analysis.MenstrualEventDetails,
+				"lifts":   menstrualEventLifts,
 			},
 			"flow_levels": map[string]interface{}{
-				"counts":  triggers.FlowLevel,
-				"details": flowLevelDetails,
+				"counts":  analysis.Triggers.FlowLevel,
+				"details": analysis.FlowLevelDetails,
+				"lifts":   flowLevelLifts,
 			},
-		})
+			"custom_factors": map[string]interface{}{
+				"counts":  analysis.Triggers.CustomFactors,
+				"details": analysis.CustomFactorDetails,
+				"lifts":   customFactorLifts,
+			},
+		}
+		if opts.RecencyHalfLife > 0 {
+			weighted := analysis.weightedCounts()
+			section := func(key, prefix string, names map[string]int) {
+				counts := map[string]float64{}
+				for name := range names {
+					counts[name] = weighted[prefix+name]
+				}
+				res[key].(map[string]interface{})["weighted_counts"] = counts
+			}
+			res["recency_halflife_days"] = opts.RecencyHalfLife
+			res["low_sleep_hours"].(map[string]interface{})["weighted_count"] = weighted["low_sleep"]
+			section("common_food_items", "food:", analysis.Triggers.FoodItems)
+			section("menstrual_events", "menstrual_event:", analysis.Triggers.MenstrualEvent)
+			section("flow_levels", "flow_level:", analysis.Triggers.FlowLevel)
+			section("custom_factors", "custom:", analysis.Triggers.CustomFactors)
+			res["ranked_triggers"] = analysis.rankTriggers()
+		}
+
+		// Category totals are reported alongside, not instead of, the per-item ones
+		if groupBy == "category" {
+			categoryRows, err := queries.GetFoodCategories(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			counts, details, items := categoryTriggers(analysis.Triggers.FoodItems, analysis.FoodItemDetails, categoryLookup(categoryRows))
+			res["food_categories"] = map[string]interface{}{
+				"counts":  counts,
+				"details": details,
+				"items":   items,
+			}
+		}
+		if same := analysis.SameDay; same != nil {
+			sameSuppressed := same.dropRare(minOccurrences)
+			res["same_day_triggers"] = map[string]interface{}{
+				"explanation": "Logged on the spike day itself rather than the day before. " +
+					"A same-day factor may have caused the spike within hours, but it may also be a response to the symptoms " +
+					"(for example eating differently when nauseous), so treat it as weaker evidence than a day-before trigger.",
+				"suppressed_triggers": sameSuppressed,
+				"low_sleep_hours": map[string]interface{}{
+					"count":   same.Triggers.LowSleepHours,
+					"details": same.LowSleepDetails,
+				},
+				"common_food_items": map[string]interface{}{
+					"counts":  same.Triggers.FoodItems,
+					"details": same.FoodItemDetails,
+				},
+				"menstrual_events": map[string]interface{}{
+					"counts":  same.Triggers.MenstrualEvent,
+					"details": same.MenstrualEventDetails,
+				},
+				"flow_levels": map[string]interface{}{
+					"counts":  same.Triggers.FlowLevel,
+					"details": same.FlowLevelDetails,
+				},
+				"custom_factors": map[string]interface{}{
+					"counts":  same.Triggers.CustomFactors,
+					"details": same.CustomFactorDetails,
+				},
+			}
+		}
+		respondRounded(c, res)
 	})
 
-	r.GET("/predict_flareups", func(c *gin.Context) {
-		queries := database.New(pool)
-
-		sleepData, err := queries.GetAllSleep(c.Request.Context())
+	r.GET("/predict_flareups", shed, cached, func(c *gin.Context) {
+		opts, err := parseAnalysisOptions(c)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		dietData, err := queries.GetAllDiet(c.Request.Context())
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		model, ok := flareupModels[c.DefaultQuery("model", flareupModelRatio)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid model, expected ratio, logistic or bayes"})
 			return
 		}
-		menstrualData, err := queries.GetAllMenstrual(c.Request.Context())
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+
+		queries := database.New(pool)
+		today, ok := userToday(c, queries)
+		if !ok {
 			return
 		}
-		symptomsData, err := queries.GetAllSymptoms(c.Request.Context())
+		data, err := loadAnalysisData(c.Request.Context(), queries)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		dataAge, staleData := dataFreshness(today, data.Sleep, data.Diet, data.Menstrual, data.Symptoms)
 
-		type triggerCounts struct {
-			LowSleepHours  int
-			MenstrualEvent map[string]int
-			FlowLevel      map[string]int
-			FoodItems      map[string]int
-		}
+		respondFlareupPrediction(c, data, opts, model, gin.H{"data_age_days": dataAge, "stale_data": staleData})
+	})
 
-		type TriggerDetail struct {
-			Date            string  `json:"date"`
-			TriggerSeverity float64 `json:"trigger_severity"`
+	// prepareRecommendations validates the request and builds the Gemini
+	// prompt shared by /recommendations and /recommendations/prompt. It
+	// responds itself and returns false when there is nothing to send.
+	prepareRecommendations := func(c *gin.Context) (recommendationInput, bool) {
+		var in recommendationInput
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return in, false
 		}
 
-		triggers := triggerCounts{
-			MenstrualEvent: make(map[string]int),
-			FlowLevel:      make(map[string]int),
-			FoodItems:      make(map[string]int),
+		in.Count = defaultRecommendationCount
+		if v := c.Query("count"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxRecommendationCount {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid count, expected an integer between 1 and %d", maxRecommendationCount)})
+				return in, false
+			}
+			in.Count = n
 		}
 
-		// Track details per trigger for output
-		var lowSleepDetails []TriggerDetail
-		foodItemDetails := map[string][]TriggerDetail{}
-		menstrualEventDetails := map[string][]TriggerDetail{}
-		flowLevelDetails := map[string][]TriggerDetail{}
-
-		// Map data by date
-		sleepMap := map[string]database.Sleep{}
-		for _, s := range sleepData {
-			sleepMap[s.Date.Time.Format("2006-01-02")] = s
-		}
+		queries := database.New(pool)
 
-		dietMap := map[string][]database.Diet{}
-		for _, d := range dietData {
-			date := d.Date.Time.Format("2006-01-02")
-			dietMap[date] = append(dietMap[date], d)
+		// An explicit restrictions parameter, even an empty one, overrides the stored default
+		var restrictionValues []string
+		if v, ok := c.GetQuery("restrictions"); ok {
+			restrictionValues = strings.Split(v, ",")
+		} else if err := loadSetting(c.Request.Context(), queries, "restrictions", &restrictionValues); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return in, false
 		}
-
-		menstrualMap := map[string]database.Menstrual{}
-		for _, m := range menstrualData {
-			menstrualMap[m.Date.Time.Format("2006-01-02")] = m
+		in.Restrictions, err = parseRestrictions(restrictionValues)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return in, false
 		}
 
-		// Calculate mean and std dev of symptom severity
-		var scores []float64
-		for _, sym := range symptomsData {
-			avg := float64(sym.Nausea.Int32+sym.Fatigue.Int32+sym.Pain.Int32) / 3.0
-			scores = append(scores, avg)
-		}
-		if len(scores) == 0 {
-			c.JSON(http.StatusOK, gin.H{"message": "No symptom data found."})
-			return
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return in, false
 		}
 
-		var sum float64
-		for _, s := range scores {
-			sum += s
+		if len(data.Symptoms) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return in, false
 		}
-		mean := sum / float64(len(scores))
-
-		var squaredDiffSum float64
-		for _, s := range scores {
-			diff := s - mean
-			squaredDiffSum += diff * diff
+		if in.Requirements, err = loadDataRequirements(c.Request.Context(), queries); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return in, false
 		}
-		stdDev := 0.0
-		if len(scores) > 1 {
-			stdDev = squaredDiffSum / float64(len(scores)-1)
-			stdDev = math.Sqrt(stdDev)
+		data = data.fromSources(opts.Sources)
+		in.Data = data
+		in.Analysis = analyzeTriggers(data, opts)
+		in.Prompt = buildRecommendationPrompt(data, in.Analysis.Triggers, in.Count, in.Restrictions)
+		if c.Query("mode") == recommendationModeSignificant {
+			in.Significant = in.Analysis.significantTriggers()
+			in.Prompt = buildSignificantRecommendationPrompt(in.Significant, in.Count, in.Restrictions)
 		}
+		return in, true
+	}
 
-		// Calculate spike threshold based on symptom score differences
-		type ScoredDay struct {
-			Date  time.Time
-			Score float64
+	r.GET("recommendations", shed, func(c *gin.Context) {
+		mode := c.DefaultQuery("mode", recommendationModeAI)
+		if mode != recommendationModeAI && mode != recommendationModeLocal && mode != recommendationModeSignificant {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mode, expected ai, local or significant"})
+			return
 		}
-		var scoredDays []ScoredDay
-		for _, sym := range symptomsData {
-			score := float64(sym.Nausea.Int32+sym.Fatigue.Int32+sym.Pain.Int32) / 3.0
-			scoredDays = append(scoredDays, ScoredDay{Date: sym.Date.Time, Score: score})
+		in, ok := prepareRecommendations(c)
+		if !ok {
+			return
 		}
-		sort.Slice(scoredDays, func(i, j int) bool {
-			return scoredDays[i].Date.Before(scoredDays[j].Date)
-		})
 
-		var diffs []float64
-		for i := 1; i < len(scoredDays); i++ {
-			diff := scoredDays[i].Score - scoredDays[i-1].Score
-			diffs = append(diffs, diff)
-		}
-		var sumDiff float64
-		for _, d := range diffs {
-			sumDiff += d
+		// Without Gemini, AI mode answers with the local recommendations in
+		// its usual shape
+		if mode == recommendationModeAI && client == nil {
+			c.Header("X-Data-Shared-With", "none")
+			c.Header("X-AI-Disabled", "true")
+			c.JSON(http.StatusOK, localRecommendations(in.Data, in.Analysis, in.Count, in.Restrictions, in.Requirements.CorrelationOverlapDays))
+			return
 		}
-		meanDiff := sumDiff / float64(len(diffs))
 
-		var sqSumDiff float64
-		for _, d := range diffs {
-			sqSumDiff += (d - meanDiff) * (d - meanDiff)
+		// Local recommendations never leave the server
+		if mode == recommendationModeLocal {
+			c.Header("X-Data-Shared-With", "none")
+			c.JSON(http.StatusOK, gin.H{
+				"mode":                   mode,
+				"data_shared_externally": false,
+				"recommendations":        localRecommendations(in.Data, in.Analysis, in.Count, in.Restrictions, in.Requirements.CorrelationOverlapDays),
+			})
+			return
 		}
-		stdDiff := math.Sqrt(sqSumDiff / float64(len(diffs)))
-
-		threshold := meanDiff + stdDiff
 
-		// Find spike days based on diff threshold, keep symptom severity for spike day
-		spikeDays := make(map[string]float64) // date => symptom severity
-		for i := 1; i < len(scoredDays); i++ {
-			diff := scoredDays[i].Score - scoredDays[i-1].Score
-			if diff > threshold {
-				dateStr := scoredDays[i].Date.Format("2006-01-02")
-				spikeDays[dateStr] = scoredDays[i].Score
+		if mode == recommendationModeSignificant {
+			if len(in.Significant) == 0 {
+				c.Header("X-Data-Shared-With", "none")
+				c.JSON(http.StatusOK, gin.H{
+					"mode":                 mode,
+					"significant_triggers": []significantTrigger{},
+					"recommendations":      []string{},
+					"message":              noSignificantTriggersMessage,
+				})
+				return
 			}
-		}
-
-		// Check triggers on the day before spike days
-		for spikeDateStr, severity := range spikeDays {
-			spikeDate, _ := time.Parse("2006-01-02", spikeDateStr)
-			dayBefore := spikeDate.AddDate(0, 0, -1).Format("2006-01-02")
-
-			if sleep, ok := sleepMap[dayBefore]; ok {
-				if sleep.Duration.Float64 < 6 {
-					triggers.LowSleepHours++
-					lowSleepDetails = append(lowSleepDetails, TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
-				}
+			if client == nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": errAIDisabled.Error()})
+				return
 			}
-
-			if diets, ok := dietMap[dayBefore]; ok {
-				for _, d := range diets {
-					for _, item := range d.Items {
-						triggers.FoodItems[item]++
-						foodItemDetails[item] = append(foodItemDetails[item], TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
-					}
-				}
+			c.Header("X-Data-Shared-With", "gemini")
+			recommendations, err := generateRecommendations(c.Request.Context(), client, in)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
 			}
+			c.JSON(http.StatusOK, gin.H{
+				"mode":                 mode,
+				"significant_triggers": in.Significant,
+				"recommendations":      recommendations,
+			})
+			return
+		}
 
-			if menstrual, ok := menstrualMap[dayBefore]; ok {
-				triggers.MenstrualEvent[menstrual.PeriodEvent.String]++
-				menstrualEventDetails[menstrual.PeriodEvent.String] = append(menstrualEventDetails[menstrual.PeriodEvent.String], TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
-
-				triggers.FlowLevel[menstrual.FlowLevel.String]++
-				flowLevelDetails[menstrual.FlowLevel.String] = append(flowLevelDetails[menstrual.FlowLevel.String], TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
-			}
+		c.Header("X-Data-Shared-With", "gemini")
+		recommendations, err := generateRecommendations(c.Request.Context(), client, in)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(http.StatusOK, recommendations)
+	})
 
-		// Check if any of these triggers have happened in the last 3 days of the data
-		recentSleep := make(map[string]database.Sleep)
-		for i := len(sleepData) - 3; i < len(sleepData); i++ {
-			if i >= 0 {
-				s := sleepData[i]
-				recentSleep[s.Date.Time.Format("2006-01-02")] = s
+	if debugEndpoints {
+		r.GET("/recommendations/prompt", shed, func(c *gin.Context) {
+			in, ok := prepareRecommendations(c)
+			if !ok {
+				return
 			}
+			c.JSON(http.StatusOK, gin.H{
+				"prompt":                  in.Prompt.Prompt,
+				"system_instruction":      in.Prompt.SystemInstruction,
+				"approximate_token_count": approxTokenCount(in.Prompt.Prompt) + approxTokenCount(in.Prompt.SystemInstruction),
+			})
+		})
+	}
+
+	r.GET("/seven_day_average", shed, cached, func(c *gin.Context) {
+		queries := database.New(pool)
+		symptomsData, err := queries.GetAllSymptoms(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		recentDiet := make(map[string][]database.Diet)
-		for i := len(dietData) - 3; i < len(dietData); i++ {
-			if i >= 0 {
-				d := dietData[i]
-				date := d.Date.Time.Format("2006-01-02")
-				recentDiet[date] = append(recentDiet[date], d)
-			}
+		if len(symptomsData) < 7 {
+			respondShortfall(c, "Not enough data for 7-day average", shortfall{Need: 7, Have: len(symptomsData), Unit: "symptom entries"}, nil)
+			return
 		}
-		recentMenstrual := make(map[string]database.Menstrual)
-		for i := len(menstrualData) - 3; i < len(menstrualData); i++ {
-			if i >= 0 {
-				m := menstrualData[i]
-				recentMenstrual[m.Date.Time.Format("2006-01-02")] = m
+		// Each component is averaged over the entries that logged it, and is
+		// null when none of the last 7 did
+		recent := symptomsData[len(symptomsData)-7:]
+		average := func(component func(database.Symptom) pgtype.Int4) *float64 {
+			var total float64
+			var n int
+			for _, sym := range recent {
+				if v := component(sym); v.Valid {
+					total += float64(v.Int32)
+					n++
+				}
 			}
-		}
-		recentSymptoms := make(map[string]database.Symptom)
-		for i := len(symptomsData) - 3; i < len(symptomsData); i++ {
-			if i >= 0 {
-				s := symptomsData[i]
-				recentSymptoms[s.Date.Time.Format("2006-01-02")] = s
+			if n == 0 {
+				return nil
 			}
+			avg := total / float64(n)
+			return &avg
 		}
+		respondRounded(c, gin.H{
+			"average_nausea":  average(func(s database.Symptom) pgtype.Int4 { return s.Nausea }),
+			"average_fatigue": average(func(s database.Symptom) pgtype.Int4 { return s.Fatigue }),
+			"average_pain":    average(func(s database.Symptom) pgtype.Int4 { return s.Pain }),
+		})
+	})
 
-		var recentFlareupPredictions []string
-		for date := range recentSleep {
-			if sleep, ok := recentSleep[date]; ok {
-				if sleep.Duration.Float64 < 6 {
-					recentFlareupPredictions = append(recentFlareupPredictions, fmt.Sprintf("Low sleep hours on %s", date))
-				}
-			}
-
-			if diets, ok := recentDiet[date]; ok {
-				for _, d := range diets {
-					for _, item := range d.Items {
-						recentFlareupPredictions = append(recentFlareupPredictions, fmt.Sprintf("%s consumed on %s", strings.Title(item), date))
-					}
-				}
-			}
+	r.GET("/flare_episodes", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		queries := database.New(pool)
+		scoredDays, err := loadDailyScores(c.Request.Context(), queries, opts.Aggregate, opts.Sources)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(scoredDays) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+
+		threshold, maxGap, err := parseFlareOptions(c, scoredDays)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		episodes := findFlareEpisodes(scoredDays, threshold, maxGap)
+
+		averageLength := 0.0
+		if len(episodes) > 0 {
+			var totalDays int
+			for _, e := range episodes {
+				totalDays += e.DurationDays
+			}
+			averageLength = float64(totalDays) / float64(len(episodes))
+		}
+
+		respondRounded(c, gin.H{
+			"threshold":           threshold,
+			"max_gap_days":        maxGap,
+			"episode_count":       len(episodes),
+			"average_length_days": averageLength,
+			"episodes":            episodes,
+		})
+	})
+
+	r.GET("/:type/:id/history", func(c *gin.Context) {
+		recordType := c.Param("type")
+		if !recordTypes[recordType] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid type, expected one of sleep, diet, menstrual, symptoms"})
+			return
+		}
+		id, err := strconv.ParseInt(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		queries := database.New(pool)
+		versions, err := queries.GetRecordHistory(c.Request.Context(), database.GetRecordHistoryParams{
+			RecordType: recordType,
+			RecordID:   int32(id),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		type historyEntry struct {
+			ChangedAt     time.Time       `json:"changed_at"`
+			ChangedFields []string        `json:"changed_fields"`
+			Previous      json.RawMessage `json:"previous"`
+		}
+		history := []historyEntry{}
+		for _, v := range versions {
+			history = append(history, historyEntry{
+				ChangedAt:     v.ChangedAt.Time,
+				ChangedFields: v.ChangedFields,
+				Previous:      v.Data,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"type":    recordType,
+			"id":      id,
+			"history": history,
+		})
+	})
+
+	r.GET("/symptom_free_streak", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		queries := database.New(pool)
+		scoredDays, err := loadDailyScores(c.Request.Context(), queries, opts.Aggregate, opts.Sources)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(scoredDays) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+
+		// Days at or below the flare threshold count as good days
+		threshold, maxGap, err := parseFlareOptions(c, scoredDays)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		current, longest := findSymptomFreeStreaks(scoredDays, threshold, maxGap)
+		res := gin.H{
+			"threshold":      threshold,
+			"max_gap_days":   maxGap,
+			"current_streak": current,
+			"longest_streak": longest,
+		}
+		if current != nil && current.Days > 1 {
+			res["message"] = fmt.Sprintf("You've had %d good days in a row", current.Days)
+		}
+		respondRounded(c, res)
+	})
+
+	r.GET("/time_since_flareup", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		queries := database.New(pool)
+		today, ok := userToday(c, queries)
+		if !ok {
+			return
+		}
+		scoredDays, err := loadDailyScores(c.Request.Context(), queries, opts.Aggregate, opts.Sources)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(scoredDays) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+
+		threshold, maxGap, err := parseFlareOptions(c, scoredDays)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		episodes := findFlareEpisodes(scoredDays, threshold, maxGap)
+		if len(episodes) == 0 {
+			respondRounded(c, gin.H{
+				"threshold":          threshold,
+				"max_gap_days":       maxGap,
+				"last_flareup":       nil,
+				"days_since_flareup": nil,
+				"message":            "No flare-up has been detected in your logged symptoms.",
+			})
+			return
+		}
+
+		last := episodes[len(episodes)-1]
+		end, _ := time.Parse("2006-01-02", last.End)
+		daysSince := daysBetween(end, today)
+		// Still running when it ends on the latest scored day and that day
+		// is recent, an old last entry says nothing about today
+		latest := scoredDays[len(scoredDays)-1].Date
+		ongoing := end.Equal(latest) && daysBetween(latest, today) <= 1
+		res := gin.H{
+			"threshold":          threshold,
+			"max_gap_days":       maxGap,
+			"last_flareup":       last,
+			"days_since_flareup": daysSince,
+			"ongoing":            ongoing,
+		}
+		if !ongoing && daysSince > 1 {
+			res["message"] = fmt.Sprintf("%d days since your last flare-up", daysSince)
+		}
+		respondRounded(c, res)
+	})
+
+	r.GET("/seasonal_patterns", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		queries := database.New(pool)
+		scoredDays, err := loadDailyScores(c.Request.Context(), queries, opts.Aggregate, opts.Sources)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(scoredDays) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+
+		var totals [12]float64
+		var counts [12]int
+		for _, d := range scoredDays {
+			// Dates are calendar days scanned as UTC midnight, so bucket in UTC
+			// to keep the server's local zone from shifting them across months
+			m := d.Date.UTC().Month() - 1
+			totals[m] += d.Score
+			counts[m]++
+		}
+
+		type monthStats struct {
+			Month           int      `json:"month"`
+			Name            string   `json:"name"`
+			AverageSeverity *float64 `json:"average_severity"`
+			SampleCount     int      `json:"sample_count"`
+		}
+		var months []monthStats
+		for i := range totals {
+			stats := monthStats{
+				Month:       i + 1,
+				Name:        time.Month(i + 1).String(),
+				SampleCount: counts[i],
+			}
+			if counts[i] > 0 {
+				avg := totals[i] / float64(counts[i])
+				stats.AverageSeverity = &avg
+			}
+			months = append(months, stats)
+		}
+
+		respondRounded(c, gin.H{"months": months})
+	})
+
+	// Bucketed in SQL so years of history come back as one row per week
+	r.GET("/weekly_summary", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		queries := database.New(pool)
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
+			return
+		}
+		rows, err := queries.GetWeeklySymptomAverages(c.Request.Context(), database.GetWeeklySymptomAveragesParams{
+			FromDate: pgtype.Date{Time: dates.From, Valid: !dates.From.IsZero()},
+			ToDate:   pgtype.Date{Time: dates.To, Valid: !dates.To.IsZero()},
+			Sources:  opts.Sources,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(rows) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+
+		type weekStats struct {
+			WeekStart       time.Time `json:"week_start"`
+			Nausea          *float64  `json:"nausea"`
+			Fatigue         *float64  `json:"fatigue"`
+			Pain            *float64  `json:"pain"`
+			AverageSeverity float64   `json:"average_severity"`
+			Entries         int32     `json:"entries"`
+			DaysLogged      int32     `json:"days_logged"`
+		}
+		optional := func(v pgtype.Float8) *float64 {
+			if !v.Valid {
+				return nil
+			}
+			return &v.Float64
+		}
+		weeks := []weekStats{}
+		for _, w := range rows {
+			severity := w.MeanScore
+			if opts.Aggregate == aggregateMax {
+				severity = w.MaxScore
+			}
+			weeks = append(weeks, weekStats{
+				WeekStart:       w.WeekStart.Time,
+				Nausea:          optional(w.Nausea),
+				Fatigue:         optional(w.Fatigue),
+				Pain:            optional(w.Pain),
+				AverageSeverity: severity,
+				Entries:         w.Entries,
+				DaysLogged:      w.DaysLogged,
+			})
+		}
+		respondRounded(c, gin.H{"weeks": weeks})
+	})
+
+	r.POST("/backfill/diet_flags", func(c *gin.Context) {
+		tx, err := pool.Begin(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback(c.Request.Context())
+
+		queries := database.New(pool).WithTx(tx)
+		dietData, err := queries.GetAllDiet(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Rows whose flags already match are left untouched, so re-running is safe
+		var updated int64
+		for _, d := range dietData {
+			containsCaffeine, containsAlcohol := dietFlags(d.Items)
+			n, err := queries.UpdateDietFlags(c.Request.Context(), database.UpdateDietFlagsParams{
+				ID:               d.ID,
+				ContainsCaffeine: containsCaffeine,
+				ContainsAlcohol:  containsAlcohol,
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			updated += n
+		}
+
+		if err := tx.Commit(c.Request.Context()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"scanned": len(dietData),
+			"updated": updated,
+		})
+	})
+
+	// Renames near-duplicate spellings of a food, e.g. {"from": ["Dairy", "dairy "], "to": "dairy"},
+	// so trigger analysis counts them as one item
+	r.POST("/maintenance/merge_food", func(c *gin.Context) {
+		var req struct {
+			From []string `json:"from" binding:"required,min=1,dive,required"`
+			To   string   `json:"to" binding:"required"`
+		}
+		if !bindJSON(c, &req) {
+			return
+		}
+		to := normalizeItem(req.To)
+		if to == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be blank"})
+			return
+		}
+		from := map[string]bool{}
+		for _, item := range req.From {
+			from[normalizeItem(item)] = true
+		}
+
+		tx, err := pool.Begin(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback(c.Request.Context())
+
+		queries := database.New(pool).WithTx(tx)
+		dietData, err := queries.GetAllDiet(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var updated int64
+		for _, d := range dietData {
+			items, details, changed, err := mergeDietItems(d, from, to)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("diet %d: %v", d.ID, err)})
+				return
+			}
+			if !changed {
+				continue
+			}
+			containsCaffeine, containsAlcohol := dietFlags(items)
+			n, err := queries.UpdateDietItems(c.Request.Context(), database.UpdateDietItemsParams{
+				ID:               d.ID,
+				Items:            items,
+				ItemDetails:      details,
+				ContainsCaffeine: containsCaffeine,
+				ContainsAlcohol:  containsAlcohol,
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			updated += n
+		}
+
+		if err := tx.Commit(c.Request.Context()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"to":      to,
+			"scanned": len(dietData),
+			"updated": updated,
+		})
+	})
+
+	// Runs the daily retention purge now, see retention.go
+	r.POST("/retention/purge", func(c *gin.Context) {
+		today, ok := userToday(c, database.New(pool))
+		if !ok {
+			return
+		}
+		report, err := runRetentionPurge(c.Request.Context(), pool, today)
+		if errors.Is(err, errRetentionDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	})
+
+	r.GET("/settings", func(c *gin.Context) {
+		queries := database.New(pool)
+		settings, err := queries.GetAllSettings(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, settingsMap(settings))
+	})
+
+	r.PUT("/settings/:key", func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !json.Valid(body) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "setting value must be valid JSON"})
+			return
+		}
+		if c.Param("key") == timezoneSetting {
+			if err := validTimezoneSetting(body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if c.Param("key") == referenceRangesSetting {
+			if err := validReferenceRangesSetting(body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if c.Param("key") == weatherSetting {
+			if err := validWeatherSetting(body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if c.Param("key") == dataRequirementsSetting {
+			if err := validDataRequirementsSetting(body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if c.Param("key") == quickLogSetting {
+			if err := validQuickLogSetting(body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if c.Param("key") == retentionSetting {
+			if err := validRetentionSetting(body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		queries := database.New(pool)
+		res, err := queries.UpsertSetting(c.Request.Context(), database.UpsertSettingParams{
+			Key:   c.Param("key"),
+			Value: body,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{res.Key: redactSetting(res.Key, res.Value)})
+	})
+
+	r.GET("/food_categories", func(c *gin.Context) {
+		queries := database.New(pool)
+		rows, err := queries.GetFoodCategories(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, categoryLookup(rows))
+	})
+
+	r.PUT("/food_categories/:item", func(c *gin.Context) {
+		var req struct {
+			Category string `json:"category" binding:"required"`
+		}
+		if !bindJSON(c, &req) {
+			return
+		}
+		item := normalizeItem(c.Param("item"))
+		category := normalizeItem(req.Category)
+		if item == "" || category == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "item and category must not be blank"})
+			return
+		}
+
+		queries := database.New(pool)
+		res, err := queries.UpsertFoodCategory(c.Request.Context(), database.UpsertFoodCategoryParams{
+			Item:     item,
+			Category: category,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{res.Item: res.Category})
+	})
+
+	r.POST("/quick_log", func(c *gin.Context) {
+		queries := database.New(pool)
+		presets, err := loadQuickLogPresets(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		value := strings.ToLower(c.Query("value"))
+		date, ok := userToday(c, queries)
+		if !ok {
+			return
+		}
+		today := pgtype.Date{Time: date, Valid: true}
+
+		switch c.Query("type") {
+		case "symptom", "symptoms":
+			preset, ok := presets.Symptom[value]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid value for symptom, expected " + ratingWords(symptomRatings, presets.Symptom)})
+				return
+			}
+			res, err := queries.InsertSymptoms(c.Request.Context(), database.InsertSymptomsParams{
+				Date:    today,
+				Nausea:  pgtype.Int4{Int32: preset.Nausea, Valid: true},
+				Fatigue: pgtype.Int4{Int32: preset.Fatigue, Valid: true},
+				Pain:    pgtype.Int4{Int32: preset.Pain, Valid: true},
+				Notes:   pgtype.Text{String: "quick log: " + value, Valid: true},
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		case "sleep":
+			preset, ok := presets.Sleep[value]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid value for sleep, expected " + ratingWords(sleepRatings, presets.Sleep)})
+				return
+			}
+			res, err := queries.InsertSleep(c.Request.Context(), database.InsertSleepParams{
+				Date:        today,
+				Duration:    pgtype.Float8{Float64: preset.Duration, Valid: true},
+				Quality:     pgtype.Int4{Int32: preset.Quality, Valid: true},
+				Disruptions: pgtype.Text{String: "", Valid: true},
+				Notes:       pgtype.Text{String: "quick log: " + value, Valid: true},
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid type, expected symptom or sleep"})
+		}
+	})
+
+	r.GET("/missing_logs", shed, func(c *gin.Context) {
+		days := 7
+		if v := c.Query("days"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 90 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid days, expected an integer between 1 and 90"})
+				return
+			}
+			days = n
+		}
+		queries := database.New(pool)
+		today, ok := userToday(c, queries)
+		if !ok {
+			return
+		}
+		// last, from and to are an alternative to days
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
+			return
+		}
+		from, to := today.AddDate(0, 0, -(days-1)), today
+		if dates.bounded() {
+			if c.Query("days") != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "days can't be combined with last, from or to"})
+				return
+			}
+			if !dates.To.IsZero() {
+				to = dates.To.AddDate(0, 0, -1)
+			}
+			from = to.AddDate(0, 0, -(days - 1))
+			if !dates.From.IsZero() {
+				from = dates.From
+			}
+			if daysBetween(from, to) >= 90 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid range, expected at most 90 days"})
+				return
+			}
+		}
+		sleepData, err := queries.GetAllSleep(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		dietData, err := queries.GetAllDiet(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		menstrualData, err := queries.GetAllMenstrual(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		symptomsData, err := queries.GetAllSymptoms(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		logged := map[string]map[string]bool{
+			"sleep":     {},
+			"diet":      {},
+			"menstrual": {},
+			"symptoms":  {},
+		}
+		for _, s := range sleepData {
+			logged["sleep"][s.Date.Time.Format("2006-01-02")] = true
+		}
+		for _, d := range dietData {
+			logged["diet"][d.Date.Time.Format("2006-01-02")] = true
+		}
+		for _, m := range menstrualData {
+			logged["menstrual"][m.Date.Time.Format("2006-01-02")] = true
+		}
+		for _, s := range symptomsData {
+			logged["symptoms"][s.Date.Time.Format("2006-01-02")] = true
+		}
+
+		missing := map[string][]string{}
+		missingCounts := map[string]int{}
+		for domain, loggedDates := range logged {
+			missing[domain] = []string{}
+			for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+				date := d.Format("2006-01-02")
+				if !loggedDates[date] {
+					missing[domain] = append(missing[domain], date)
+				}
+			}
+			missingCounts[domain] = len(missing[domain])
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from":           from.Format("2006-01-02"),
+			"to":             to.Format("2006-01-02"),
+			"missing":        missing,
+			"missing_counts": missingCounts,
+		})
+	})
+
+	// dietItemHandler adds or removes a single item on an existing diet
+	// entry. Sending the entry's Version as If-Match makes the edit fail
+	// with 409 when the entry changed in the meantime.
+	dietItemHandler := func(remove bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			id, err := strconv.ParseInt(c.Param("id"), 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+				return
+			}
+
+			var req struct {
+				Item string `json:"item" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			item := normalizeItem(req.Item)
+			if item == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "item must not be empty"})
+				return
+			}
+			expected, ok := ifMatchVersion(c)
+			if !ok {
+				return
+			}
+
+			tx, err := pool.Begin(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			defer tx.Rollback(c.Request.Context())
+
+			queries := database.New(pool).WithTx(tx)
+			var res database.Diet
+			if remove {
+				res, err = queries.RemoveDietItem(c.Request.Context(), database.RemoveDietItemParams{Item: item, ID: int32(id), ExpectedVersion: expected})
+			} else {
+				res, err = queries.AppendDietItem(c.Request.Context(), database.AppendDietItemParams{Item: item, ID: int32(id), ExpectedVersion: expected})
+			}
+			currentVersion := func() (int32, error) { return queries.GetDietVersion(c.Request.Context(), int32(id)) }
+			if respondVersionConflict(c, err, expected, "diet entry", currentVersion) {
+				return
+			}
+			if respondDBError(c, err, "diet entry not found") {
+				return
+			}
+
+			// Keep the derived flags in step with the new item list
+			res.ContainsCaffeine, res.ContainsAlcohol = dietFlags(res.Items)
+			if _, err := queries.UpdateDietFlags(c.Request.Context(), database.UpdateDietFlagsParams{
+				ID:               res.ID,
+				ContainsCaffeine: res.ContainsCaffeine,
+				ContainsAlcohol:  res.ContainsAlcohol,
+			}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if err := tx.Commit(c.Request.Context()); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.Header("ETag", versionETag(res.Version))
+			c.JSON(http.StatusOK, res)
+		}
+	}
+
+	r.POST("/diet/:id/items", dietItemHandler(false))
+	r.DELETE("/diet/:id/items", dietItemHandler(true))
+
+	r.POST("/batch_delete", func(c *gin.Context) {
+		var req struct {
+			Type string  `json:"type" binding:"required,oneof=sleep diet menstrual symptoms"`
+			IDs  []int32 `json:"ids" binding:"required,min=1,max=500"`
+		}
+		if !bindJSON(c, &req) {
+			return
+		}
+
+		tx, err := pool.Begin(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback(c.Request.Context())
+
+		queries := database.New(pool).WithTx(tx)
+		var deleted []int32
+		switch req.Type {
+		case "sleep":
+			deleted, err = queries.SoftDeleteSleep(c.Request.Context(), req.IDs)
+		case "diet":
+			deleted, err = queries.SoftDeleteDiet(c.Request.Context(), req.IDs)
+		case "menstrual":
+			deleted, err = queries.SoftDeleteMenstrual(c.Request.Context(), req.IDs)
+		case "symptoms":
+			deleted, err = queries.SoftDeleteSymptoms(c.Request.Context(), req.IDs)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit(c.Request.Context()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"type":    req.Type,
+			"deleted": len(deleted),
+			"results": batchDeleteResults(req.IDs, deleted),
+		})
+	})
+
+	r.GET("/account/summary", shed, func(c *gin.Context) {
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		settings, err := queries.GetAllSettings(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		generatedAt := time.Now().UTC()
+		c.Header("Content-Type", "application/json")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="endocare-account-summary-%s.json"`, generatedAt.Format("2006-01-02")))
+		c.Status(http.StatusOK)
+
+		// Headers are already sent, so a failure here can only be logged
+		if err := writeAccountSummary(c.Writer, data, settings, generatedAt); err != nil {
+			slog.Error("failed to stream account summary", "error", err)
+		}
+	})
+
+	r.GET("/diet_volume_impact", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		queries := database.New(pool)
+		dietData, err := queries.GetAllDiet(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		dietData = withSource(dietData, opts.Sources, func(r database.Diet) string { return r.Source })
+		scoredDays, err := loadDailyScores(c.Request.Context(), queries, opts.Aggregate, opts.Sources)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		respondDietVolumeImpact(c, scoredDays, dietData)
+	})
+
+	// Findings are stored by the background refresh or POST
+	// /insights/refresh, dismissed ones stay dismissed
+	r.GET("/insights/feed", shed, func(c *gin.Context) {
+		includeDismissed := false
+		if v := c.Query("include_dismissed"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid include_dismissed, expected true or false"})
+				return
+			}
+			includeDismissed = b
+		}
+
+		queries := database.New(pool)
+		rows, err := queries.GetInsights(c.Request.Context(), includeDismissed)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		insights := []insightResponse{}
+		for _, row := range rows {
+			insights = append(insights, newInsightResponse(row))
+		}
+		c.JSON(http.StatusOK, gin.H{"insights": insights})
+	})
+
+	r.POST("/insights/refresh", shed, func(c *gin.Context) {
+		added, err := refreshInsights(c.Request.Context(), database.New(pool))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"added": added})
+	})
+
+	r.POST("/insights/:id/dismiss", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		queries := database.New(pool)
+		res, err := queries.DismissInsight(c.Request.Context(), int32(id))
+		if respondDBError(c, err, "insight not found") {
+			return
+		}
+		c.JSON(http.StatusOK, newInsightResponse(res))
+	})
+
+	r.GET("/snapshot", func(c *gin.Context) {
+		queries := database.New(pool)
+		snapshot, err := queries.GetAnalysisSnapshot(c.Request.Context())
+		if respondDBError(c, err, "no snapshot yet, POST /snapshot/refresh to compute one") {
+			return
+		}
+		version, err := dataVersion(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, newSnapshotResponse(snapshot, version))
+	})
+
+	r.POST("/snapshot/refresh", shed, func(c *gin.Context) {
+		snapshot, err := refreshSnapshot(c.Request.Context(), database.New(pool), client)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, newSnapshotResponse(snapshot, snapshot.DataVersion))
+	})
+
+	r.POST("/share", shed, func(c *gin.Context) {
+		var req struct {
+			ExpiresInHours int `json:"expires_in_hours" binding:"omitempty,min=1,max=2160"`
+		}
+		// The body is optional
+		if c.Request.ContentLength != 0 && !bindJSON(c, &req) {
+			return
+		}
+		expiry := defaultShareExpiry
+		if req.ExpiresInHours > 0 {
+			expiry = time.Duration(req.ExpiresInHours) * time.Hour
+		}
+
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(data.Symptoms) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+		payload, err := json.Marshal(buildSharedAnalysis(data, time.Now().UTC()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		token, err := newShareToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		share, err := queries.InsertShare(c.Request.Context(), database.InsertShareParams{
+			Token:     token,
+			Data:      payload,
+			ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(expiry), Valid: true},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		scheme := "http"
+		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"token":      share.Token,
+			"url":        fmt.Sprintf("%s://%s/shared/%s", scheme, c.Request.Host, share.Token),
+			"expires_at": share.ExpiresAt.Time,
+		})
+	})
+
+	// Anyone with the link can read it, it only holds aggregates
+	r.GET("/shared/:token", func(c *gin.Context) {
+		queries := database.New(pool)
+		share, err := queries.GetActiveShare(c.Request.Context(), c.Param("token"))
+		if respondDBError(c, err, "share link not found or expired") {
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		respondRounded(c, gin.H{
+			"analysis":   json.RawMessage(share.Data),
+			"shared_at":  share.CreatedAt.Time,
+			"expires_at": share.ExpiresAt.Time,
+		})
+	})
+
+	r.DELETE("/share/:token", func(c *gin.Context) {
+		queries := database.New(pool)
+		n, err := queries.RevokeShare(c.Request.Context(), c.Param("token"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "share link not found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	r.GET("/safe_foods", shed, cached, func(c *gin.Context) {
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		minOccurrences := defaultSafeFoodMinOccurrences
+		if v := c.Query("min_occurrences"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 365 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid min_occurrences, expected an integer between 1 and 365"})
+				return
+			}
+			minOccurrences = n
+		}
+
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(data.Symptoms) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+		analysis := analyzeTriggers(data, opts)
+		baseRate, _ := analysis.lifts()
+
+		foods := analysis.safeFoods(minOccurrences)
+		if foods == nil {
+			foods = []safeFood{}
+		}
+		respondRounded(c, gin.H{
+			"base_spike_rate": baseRate,
+			"min_occurrences": minOccurrences,
+			"explanation": "Foods eaten at least min_occurrences times with a lift below 1, meaning spikes were less likely the day after " +
+				"than on an average day, and mostly followed by days at or below your average severity.",
+			"safe_foods": foods,
+		})
+	})
+
+	r.GET("/symptom_zscores", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		queries := database.New(pool)
+		requirements, err := loadDataRequirements(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		scoredDays, err := loadDailyScores(c.Request.Context(), queries, opts.Aggregate, opts.Sources)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(scoredDays) < requirements.ZScoreDays {
+			respondShortfall(c, "Not enough symptom data for z-scores.", shortfall{Need: requirements.ZScoreDays, Have: len(scoredDays), Unit: "days with symptoms logged"}, nil)
+			return
+		}
+
+		var scores []float64
+		for _, d := range scoredDays {
+			scores = append(scores, d.Score)
+		}
+		mean, stdDev := meanStdDev(scores)
+
+		type zScoreDay struct {
+			Date    time.Time `json:"date"`
+			Score   float64   `json:"score"`
+			ZScore  *float64  `json:"z_score"`
+			Unusual bool      `json:"unusual"`
+		}
+		days := []zScoreDay{}
+		for _, d := range scoredDays {
+			day := zScoreDay{Date: d.Date, Score: d.Score}
+			// Identical scores every day leave z undefined
+			if stdDev > 0 {
+				z := (d.Score - mean) / stdDev
+				day.ZScore = &z
+				day.Unusual = math.Abs(z) > 2
+			}
+			days = append(days, day)
+		}
+
+		respondRounded(c, gin.H{
+			"mean":               mean,
+			"standard_deviation": stdDev,
+			"unusual_beyond":     2,
+			"days":               days,
+		})
+	})
+
+	r.GET("/day/:date", shed, cached, func(c *gin.Context) {
+		date, err := time.Parse("2006-01-02", c.Param("date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date, expected YYYY-MM-DD"})
+			return
+		}
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		respondAnalytics(c, buildDayDetail(data, analyzeTriggers(data, opts), date))
+	})
+
+	r.GET("/trigger/food/:item", shed, cached, func(c *gin.Context) {
+		item := normalizeItem(c.Param("item"))
+		if item == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "item must not be blank"})
+			return
+		}
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(data.Symptoms) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+		requirements, err := loadDataRequirements(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		trigger, ok := analyzeTriggers(data, opts).foodTrigger(item, requirements.FoodTriggerDays)
+		if !ok {
+			respondShortfall(c, fmt.Sprintf("%s was not logged often enough to analyze.", item), shortfall{
+				Need: requirements.FoodTriggerDays,
+				Have: trigger.DaysEaten,
+				Unit: "days with the food logged and symptoms scored the next day",
+			}, gin.H{
+				"item":       item,
+				"days_eaten": trigger.DaysEaten,
+			})
+			return
+		}
+		// Not rounded, a small p-value would round to 0
+		respondAnalytics(c, trigger)
+	})
+
+	r.GET("/worst_days", shed, cached, func(c *gin.Context) {
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		limit := defaultWorstDaysLimit
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxWorstDaysLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit, expected an integer between 1 and %d", maxWorstDaysLimit)})
+				return
+			}
+			limit = n
+		}
+
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(data.Symptoms) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+		respondRounded(c, gin.H{"days": analyzeTriggers(data, opts).worstDays(limit)})
+	})
+
+	r.GET("/diet_clusters", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		k := defaultDietClusters
+		if v := c.Query("clusters"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 2 || n > maxDietClusters {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid clusters, expected an integer between 2 and %d", maxDietClusters)})
+				return
+			}
+			k = n
+		}
+
+		data, err := loadAnalysisData(c.Request.Context(), database.New(pool))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		data = data.fromSources(opts.Sources)
+		days := dietDays(data.Diet)
+		if need := k * dietDaysPerCluster; len(days) < need {
+			respondShortfall(c, "Not enough diet history to find patterns.", shortfall{Need: need, Have: len(days), Unit: "days with diet items logged"}, gin.H{"clusters": k})
+			return
+		}
+		scores := map[string]float64{}
+		for _, d := range scoreSymptomDays(data.Symptoms, opts.Aggregate) {
+			scores[d.Date.Format("2006-01-02")] = d.Score
+		}
+
+		respondRounded(c, gin.H{
+			"clusters": dietClusters(days, scores, k),
+			"note":     "Days grouped by which foods were logged, labelled from the worst average symptom score down. Patterns, not proof that a diet causes symptoms.",
+		})
+	})
+
+	r.GET("/trigger_cooccurrence", shed, cached, func(c *gin.Context) {
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		limit := defaultCooccurrenceLimit
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxCooccurrenceLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit, expected an integer between 1 and %d", maxCooccurrenceLimit)})
+				return
+			}
+			limit = n
+		}
+
+		queries := database.New(pool)
+		requirements, err := loadDataRequirements(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(data.Symptoms) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+		analysis := analyzeTriggers(data, opts)
+		if len(analysis.SpikeDays) < requirements.CooccurrenceSpikes {
+			respondShortfall(c, "Not enough symptom spikes to look for trigger combinations.", shortfall{Need: requirements.CooccurrenceSpikes, Have: len(analysis.SpikeDays), Unit: "symptom spikes"}, nil)
+			return
+		}
+		baseRate, _ := analysis.lifts()
+		// Not rounded, a small p-value would round to 0
+		respondAnalytics(c, gin.H{
+			"base_spike_rate": baseRate,
+			"min_pair_spikes": minPairSpikes,
+			"pairs":           analysis.triggerPairs(limit),
+			"explanation": "joint_lift = P(spike | both factors logged the day before) / P(spike). " +
+				"synergy compares it to the stronger factor's own lift, above 1 means the pair is worse than either alone.",
+		})
+	})
+
+	r.GET("/whatif", shed, cached, func(c *gin.Context) {
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		remove := c.Query("remove")
+		if remove == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "remove is required, e.g. remove=dairy or remove=low_sleep"})
+			return
+		}
+
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(data.Symptoms) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+		categoryRows, err := queries.GetFoodCategories(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		analysis := analyzeTriggers(data, opts)
+		_, lifts := analysis.lifts()
+		factors, err := whatIfFactors(remove, lifts, categoryLookup(categoryRows))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondRounded(c, analysis.whatIf(remove, factors))
+	})
+
+	r.GET("/compare_to_baseline", shed, cached, func(c *gin.Context) {
+		queries := database.New(pool)
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
+			return
+		}
+		ranges := defaultReferenceRanges()
+		if err := loadSetting(c.Request.Context(), queries, referenceRangesSetting, &ranges); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		sleepData, err := queries.GetAllSleep(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		symptomsData, err := queries.GetAllSymptoms(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sleepData = filterByDate(sleepData, func(s database.Sleep) pgtype.Date { return s.Date }, dates)
+		symptomsData = filterByDate(symptomsData, func(s database.Symptom) pgtype.Date { return s.Date }, dates)
+
+		var hours, severities []float64
+		for _, s := range sleepData {
+			if s.Duration.Valid {
+				hours = append(hours, s.Duration.Float64)
+			}
+		}
+		for _, d := range scoreSymptomDays(symptomsData, aggregateMean) {
+			severities = append(severities, d.Score)
+		}
+
+		respondRounded(c, gin.H{
+			"sleep_hours":      compareToRange("sleep", hours, ranges.SleepHours),
+			"symptom_severity": compareToRange("daily symptom severity", severities, ranges.SymptomSeverity),
+			"disclaimer":       baselineDisclaimer,
+		})
+	})
+
+	r.GET("/event_impact", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		event, factor := c.Query("event"), normalizeItem(c.Query("factor"))
+		if (event == "") == (factor == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "set exactly one of event (a menstrual period_event) or factor (a custom factor)"})
+			return
+		}
+		windows := map[string]int{"before": defaultEventWindowDays, "after": defaultEventWindowDays}
+		for _, name := range []string{"before", "after"} {
+			if v := c.Query(name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > maxEventWindowDays {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s, expected an integer between 1 and %d", name, maxEventWindowDays)})
+					return
+				}
+				windows[name] = n
+			}
+		}
+
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		data = data.fromSources(opts.Sources)
+		if len(data.Symptoms) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
+
+		var dates []time.Time
+		res := gin.H{"before_days": windows["before"], "after_days": windows["after"]}
+		if event != "" {
+			dates = periodEventDates(data.Menstrual, event)
+			res["event"] = event
+		} else {
+			dates = customFactorDates(data, factor)
+			res["factor"] = factor
+		}
+		impact := eventImpact(dates, scoreSymptomDays(data.Symptoms, opts.Aggregate), windows["before"], windows["after"])
+		if len(impact.Occurrences) == 0 {
+			respondInsufficientData(c, "No occurrences with symptoms logged around them.", requireEventWindows, gin.H{"skipped": impact.Skipped})
+			return
+		}
+		res["occurrence_count"] = len(impact.Occurrences)
+		res["occurrences"] = impact.Occurrences
+		res["skipped"] = impact.Skipped
+		res["mean_before"] = impact.MeanBefore
+		res["mean_after"] = impact.MeanAfter
+		res["mean_delta"] = impact.MeanDelta
+		respondRounded(c, res)
+	})
+
+	r.GET("/symptom_components", shed, cached, func(c *gin.Context) {
+		queries := database.New(pool)
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
+			return
+		}
+		symptomsData, err := queries.GetAllSymptoms(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		symptomsData = filterByDate(symptomsData, func(s database.Symptom) pgtype.Date { return s.Date }, dates)
+		if len(symptomsData) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
 
-			if menstrual, ok := recentMenstrual[date]; ok {
-				recentFlareupPredictions = append(recentFlareupPredictions, fmt.Sprintf("Menstrual event %s on %s", menstrual.PeriodEvent.String, date))
-				recentFlareupPredictions = append(recentFlareupPredictions, fmt.Sprintf("Flow level %s on %s", menstrual.FlowLevel.String, date))
+		// Open ends of the range stop at the first and last logged day
+		from, to := dates.From, dates.To.AddDate(0, 0, -1)
+		for _, s := range symptomsData {
+			if dates.From.IsZero() && (from.IsZero() || s.Date.Time.Before(from)) {
+				from = s.Date.Time
 			}
-
-			if sym, ok := recentSymptoms[date]; ok {
-				avgSeverity := float64(sym.Nausea.Int32+sym.Fatigue.Int32+sym.Pain.Int32) / 3.0
-				if avgSeverity > mean+stdDev { // Predict flareup if above average severity
-					recentFlareupPredictions = append(recentFlareupPredictions, fmt.Sprintf("High symptom severity on %s: %.2f", date, avgSeverity))
-				}
+			if dates.To.IsZero() && s.Date.Time.After(to) {
+				to = s.Date.Time
 			}
 		}
+		if daysBetween(from, to) >= maxComponentDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid range, expected at most %d days", maxComponentDays)})
+			return
+		}
+
+		respondRounded(c, componentSeries(symptomsData, from, to))
+	})
+
+	r.GET("/correlation_matrix", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		if len(recentFlareupPredictions) == 0 {
-			c.JSON(http.StatusOK, gin.H{"message": "No recent flareup predictions found."})
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		data = data.fromSources(opts.Sources)
 
-		// Calculate probability of flareup based on recent data, and severity of triggers
-		var totalTriggers int
-		for _, count := range triggers.FoodItems {
-			totalTriggers += count
+		requirements, err := loadDataRequirements(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		totalTriggers += triggers.LowSleepHours
-		for _, count := range triggers.MenstrualEvent {
-			totalTriggers += count
+		respondCorrelationMatrix(c, data, opts.Aggregate, requirements.CorrelationOverlapDays)
+	})
+
+	// Computes several reports over one load of the data. Shared parameters
+	// are the usual analysis and date range query parameters.
+	r.POST("/analytics/batch", shed, func(c *gin.Context) {
+		var req struct {
+			Reports []string `json:"reports" binding:"required,min=1,max=10,dive,required"`
 		}
-		for _, count := range triggers.FlowLevel {
-			totalTriggers += count
+		if !bindJSON(c, &req) {
+			return
 		}
-		if totalTriggers == 0 {
-			c.JSON(http.StatusOK, gin.H{"message": "No triggers found in recent data."})
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		probability := float64(totalTriggers) / float64(len(recentFlareupPredictions))
-		probability = math.Min(probability, 1.0)        // Cap at 100%
-		probability *= 100                              // Convert to percentage
-		probability = math.Round(probability*100) / 100 // Round to 2 decimal places
-		c.JSON(http.StatusOK, gin.H{
-			"flareup_probability": probability,
-			"flareup_predictions": recentFlareupPredictions,
-		})
+		queries := database.New(pool)
+		dates, ok := parseDateRange(c, queries)
+		if !ok {
+			return
+		}
+
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		requirements, err := loadDataRequirements(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		data = data.fromSources(opts.Sources)
+		in := batchInput{Data: data.inRange(dates), Opts: opts, Requirements: requirements, PeriodStarts: periodStarts(data.Menstrual)}
+		in.Analysis = analyzeTriggers(in.Data, opts)
+
+		reports := map[string]batchResult{}
+		for _, name := range req.Reports {
+			report, ok := batchReports[name]
+			if !ok {
+				reports[name] = batchResult{Error: "unknown report, expected triggers, scores, correlations or cycle_phases"}
+				continue
+			}
+			result, err := report(in)
+			if err != nil {
+				reports[name] = batchResult{Error: err.Error()}
+				continue
+			}
+			reports[name] = batchResult{Result: result}
+		}
+		respondRounded(c, gin.H{"reports": reports})
 	})
 
-	r.GET("recommendations", func(c *gin.Context) {
+	r.GET("/anomalies", shed, cached, func(c *gin.Context) {
 		queries := database.New(pool)
-
 		sleepData, err := queries.GetAllSleep(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		dietData, err := queries.GetAllDiet(c.Request.Context())
+		symptomsData, err := queries.GetAllSymptoms(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+
+		anomalies := findAnomalies(sleepData, symptomsData)
+		respondRounded(c, gin.H{
+			"count":     len(anomalies),
+			"anomalies": anomalies,
+		})
+	})
+
+	r.GET("/period_symptom_forecast", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		queries := database.New(pool)
+		today, ok := userToday(c, queries)
+		if !ok {
+			return
+		}
 		menstrualData, err := queries.GetAllMenstrual(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		symptomsData, err := queries.GetAllSymptoms(c.Request.Context())
+		menstrualData = withSource(menstrualData, opts.Sources, func(r database.Menstrual) string { return r.Source })
+		scoredDays, err := loadDailyScores(c.Request.Context(), queries, opts.Aggregate, opts.Sources)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		type triggerCounts struct {
-			LowSleepHours  int
-			MenstrualEvent map[string]int
-			FlowLevel      map[string]int
-			FoodItems      map[string]int
+		requirements, err := loadDataRequirements(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
-		type TriggerDetail struct {
-			Date            string  `json:"date"`
-			TriggerSeverity float64 `json:"trigger_severity"`
+		starts := periodStarts(menstrualData)
+		lengths := cycleLengths(starts)
+		if len(lengths) < requirements.ForecastCycles {
+			respondShortfall(c, "Not enough cycle history.", shortfall{Need: requirements.ForecastCycles, Have: len(lengths), Unit: "complete cycles of logged period starts"}, gin.H{"cycles_used": len(lengths)})
+			return
 		}
+		meanLength, lengthStdDev := meanStdDev(lengths)
 
-		triggers := triggerCounts{
-			MenstrualEvent: make(map[string]int),
-			FlowLevel:      make(map[string]int),
-			FoodItems:      make(map[string]int),
+		var totals [maxCycleLength + 1]float64
+		var counts [maxCycleLength + 1]int
+		for _, d := range scoredDays {
+			if day, ok := cycleDay(d.Date, starts); ok {
+				totals[day] += d.Score
+				counts[day]++
+			}
 		}
 
-		// Track details per trigger for output
-		var lowSleepDetails []TriggerDetail
-		foodItemDetails := map[string][]TriggerDetail{}
-		menstrualEventDetails := map[string][]TriggerDetail{}
-		flowLevelDetails := map[string][]TriggerDetail{}
+		type forecastDay struct {
+			Date             time.Time `json:"date"`
+			CycleDay         int       `json:"cycle_day"`
+			Phase            string    `json:"phase"`
+			ExpectedSeverity *float64  `json:"expected_severity"`
+			SampleCount      int       `json:"sample_count"`
+		}
+		nextStart := predictNextPeriod(starts, meanLength, today)
+		var days []forecastDay
+		for day := 1; day <= int(math.Round(meanLength)); day++ {
+			fd := forecastDay{
+				Date:        nextStart.AddDate(0, 0, day-1),
+				CycleDay:    day,
+				Phase:       cyclePhase(day),
+				SampleCount: counts[day],
+			}
+			if counts[day] > 0 {
+				avg := totals[day] / float64(counts[day])
+				fd.ExpectedSeverity = &avg
+			}
+			days = append(days, fd)
+		}
+
+		respondRounded(c, gin.H{
+			"estimate":             true,
+			"note":                 "Projected from your past cycles, actual symptoms will vary. This is an estimate, not medical advice.",
+			"predicted_start":      nextStart,
+			"cycle_length_days":    meanLength,
+			"cycle_length_std_dev": lengthStdDev,
+			"cycles_used":          len(lengths),
+			"confidence":           forecastConfidence(len(lengths), lengthStdDev, requirements.ForecastCycles),
+			"days":                 days,
+		})
+	})
 
-		// Map data by date
-		sleepMap := map[string]database.Sleep{}
-		for _, s := range sleepData {
-			sleepMap[s.Date.Time.Format("2006-01-02")] = s
+	// Replays the forecasts over past days, see backtest.go
+	r.GET("/forecast_backtest", shed, cached, func(c *gin.Context) {
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		model, ok := flareupModels[c.DefaultQuery("model", flareupModelRatio)]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid model, expected ratio, logistic or bayes"})
+			return
 		}
 
-		dietMap := map[string][]database.Diet{}
-		for _, d := range dietData {
-			date := d.Date.Time.Format("2006-01-02")
-			dietMap[date] = append(dietMap[date], d)
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		requirements, err := loadDataRequirements(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
-		menstrualMap := map[string]database.Menstrual{}
-		for _, m := range menstrualData {
-			menstrualMap[m.Date.Time.Format("2006-01-02")] = m
+		scoredDays := scoreSymptomDays(data.fromSources(opts.Sources).Symptoms, opts.Aggregate)
+		if len(scoredDays) <= minBacktestHistory {
+			respondShortfall(c, "Not enough symptom history to backtest.", shortfall{Need: minBacktestHistory + 1, Have: len(scoredDays), Unit: "days with a symptom score"}, nil)
+			return
 		}
 
-		// Calculate mean and std dev of symptom severity
-		var scores []float64
-		for _, sym := range symptomsData {
-			avg := float64(sym.Nausea.Int32+sym.Fatigue.Int32+sym.Pain.Int32) / 3.0
-			scores = append(scores, avg)
+		respondRounded(c, gin.H{
+			"flareups":     backtestFlareups(data, opts, model),
+			"severity":     backtestSeverity(scoredDays, periodStarts(data.Menstrual), requirements.ForecastCycles),
+			"warm_up_days": minBacktestHistory,
+			"min_points":   minBacktestPoints,
+			"note":         "Each day is predicted from the data logged before it and compared with what happened. Past accuracy doesn't guarantee future accuracy.",
+		})
+	})
+
+	// Backfills weather for logged days that don't have it yet
+	weatherFetches := &weatherLimiter{}
+	r.POST("/weather/refresh", func(c *gin.Context) {
+		queries := database.New(pool)
+		cfg, err := loadWeatherConfig(c.Request.Context(), queries)
+		if errors.Is(err, errWeatherDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		if len(scores) == 0 {
-			c.JSON(http.StatusOK, gin.H{"message": "No symptom data found."})
+		scoredDays, err := loadDailyScores(c.Request.Context(), queries, aggregateMean, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-
-		var sum float64
-		for _, s := range scores {
-			sum += s
+		stored, err := queries.GetAllWeather(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		from, to, missing := missingWeatherRange(scoredDays, stored)
+		if !missing {
+			c.JSON(http.StatusOK, gin.H{"fetched": 0})
+			return
+		}
+		if ok, wait := weatherFetches.allow(time.Now()); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "weather was fetched recently, try again later"})
+			return
 		}
-		mean := sum / float64(len(scores))
 
-		var squaredDiffSum float64
-		for _, s := range scores {
-			diff := s - mean
-			squaredDiffSum += diff * diff
+		days, err := fetchWeather(c.Request.Context(), cfg, from, to)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
 		}
-		stdDev := 0.0
-		if len(scores) > 1 {
-			stdDev = squaredDiffSum / float64(len(scores)-1)
-			stdDev = math.Sqrt(stdDev)
+		for _, d := range days {
+			if err := queries.UpsertWeather(c.Request.Context(), d); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
 		}
+		c.JSON(http.StatusOK, gin.H{"fetched": len(days), "from": from, "to": to})
+	})
 
-		// Calculate spike threshold based on symptom score differences
-		type ScoredDay struct {
-			Date  time.Time
-			Score float64
+	r.GET("/weather_impact", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		queries := database.New(pool)
+		if _, err := loadWeatherConfig(c.Request.Context(), queries); errors.Is(err, errWeatherDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		requirements, err := loadDataRequirements(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		scoredDays, err := loadDailyScores(c.Request.Context(), queries, opts.Aggregate, opts.Sources)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(scoredDays) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
 		}
-		var scoredDays []ScoredDay
-		for _, sym := range symptomsData {
-			score := float64(sym.Nausea.Int32+sym.Fatigue.Int32+sym.Pain.Int32) / 3.0
-			scoredDays = append(scoredDays, ScoredDay{Date: sym.Date.Time, Score: score})
+		weather, err := queries.GetAllWeather(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		sort.Slice(scoredDays, func(i, j int) bool {
-			return scoredDays[i].Date.Before(scoredDays[j].Date)
+		respondRounded(c, gin.H{
+			"correlations":     weatherImpact(scoredDays, weather, requirements.CorrelationOverlapDays),
+			"min_overlap_days": requirements.CorrelationOverlapDays,
+			"note":             "Correlation with the same day's symptom score, days without weather are skipped. Run POST /weather/refresh to fetch weather for newly logged days.",
 		})
+	})
+
+	r.GET("/sleep_quality_scatter", shed, cached, func(c *gin.Context) {
+		queries := database.New(pool)
+		requirements, err := loadDataRequirements(c.Request.Context(), queries)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sleepData, err := queries.GetAllSleep(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		respondRounded(c, sleepQualityScatter(sleepData, requirements.CorrelationOverlapDays))
+	})
 
-		var diffs []float64
-		for i := 1; i < len(scoredDays); i++ {
-			diff := scoredDays[i].Score - scoredDays[i-1].Score
-			diffs = append(diffs, diff)
+	r.GET("/cycle_overlay", shed, cached, func(c *gin.Context) {
+		opts, err := parseScoreOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		queries := database.New(pool)
+		menstrualData, err := queries.GetAllMenstrual(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		var sumDiff float64
-		for _, d := range diffs {
-			sumDiff += d
+		menstrualData = withSource(menstrualData, opts.Sources, func(r database.Menstrual) string { return r.Source })
+		scoredDays, err := loadDailyScores(c.Request.Context(), queries, opts.Aggregate, opts.Sources)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		meanDiff := sumDiff / float64(len(diffs))
 
-		var sqSumDiff float64
-		for _, d := range diffs {
-			sqSumDiff += (d - meanDiff) * (d - meanDiff)
+		cycles, average := cycleOverlay(scoredDays, periodStarts(menstrualData))
+		if len(cycles) == 0 {
+			respondInsufficientData(c, "No symptoms logged within a cycle.", requireCycleSymptoms, nil)
+			return
 		}
-		stdDiff := math.Sqrt(sqSumDiff / float64(len(diffs)))
+		respondRounded(c, gin.H{
+			"note":    "Day 1 is the logged period start. The band is a 95% confidence interval for the average, wider where fewer cycles were scored.",
+			"average": average,
+			"cycles":  cycles,
+		})
+	})
 
-		threshold := meanDiff + stdDiff
+	if allowSeed {
+		r.POST("/seed", func(c *gin.Context) {
+			cfg := defaultSeedConfig()
+			if c.Request.ContentLength != 0 {
+				if err := c.ShouldBindJSON(&cfg); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
+			if cfg.Days < 1 || cfg.Days > 730 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid days, expected an integer between 1 and 730"})
+				return
+			}
+			if cfg.TriggerProbability < 0 || cfg.TriggerProbability > 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid trigger_probability, expected a value between 0 and 1"})
+				return
+			}
 
-		// Find spike days based on diff threshold, keep symptom severity for spike day
-		spikeDays := make(map[string]float64) // date => symptom severity
-		for i := 1; i < len(scoredDays); i++ {
-			diff := scoredDays[i].Score - scoredDays[i-1].Score
-			if diff > threshold {
-				dateStr := scoredDays[i].Date.Format("2006-01-02")
-				spikeDays[dateStr] = scoredDays[i].Score
+			today, ok := userToday(c, database.New(pool))
+			if !ok {
+				return
 			}
-		}
+			data := generateSeedData(cfg, today)
 
-		// Check triggers on the day before spike days
-		for spikeDateStr, severity := range spikeDays {
-			spikeDate, _ := time.Parse("2006-01-02", spikeDateStr)
-			dayBefore := spikeDate.AddDate(0, 0, -1).Format("2006-01-02")
+			tx, err := pool.Begin(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			defer tx.Rollback(c.Request.Context())
 
-			if sleep, ok := sleepMap[dayBefore]; ok {
-				if sleep.Duration.Float64 < 6 {
-					triggers.LowSleepHours++
-					lowSleepDetails = append(lowSleepDetails, TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
+			queries := database.New(pool).WithTx(tx)
+			for _, p := range data.Sleep {
+				if _, err := queries.InsertSleep(c.Request.Context(), p); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
 				}
 			}
-
-			if diets, ok := dietMap[dayBefore]; ok {
-				for _, d := range diets {
-					for _, item := range d.Items {
-						triggers.FoodItems[item]++
-						foodItemDetails[item] = append(foodItemDetails[item], TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
-					}
+			for _, p := range data.Diet {
+				if _, err := queries.InsertDiet(c.Request.Context(), p); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+			}
+			for _, p := range data.Menstrual {
+				if _, err := queries.InsertMenstrual(c.Request.Context(), p); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+			}
+			for _, p := range data.Symptoms {
+				if _, err := queries.InsertSymptoms(c.Request.Context(), p); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
 				}
 			}
 
-			if menstrual, ok := menstrualMap[dayBefore]; ok {
-				triggers.MenstrualEvent[menstrual.PeriodEvent.String]++
-				menstrualEventDetails[menstrual.PeriodEvent.String] = append(menstrualEventDetails[menstrual.PeriodEvent.String], TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
-
-				triggers.FlowLevel[menstrual.FlowLevel.String]++
-				flowLevelDetails[menstrual.FlowLevel.String] = append(flowLevelDetails[menstrual.FlowLevel.String], TriggerDetail{Date: dayBefore, TriggerSeverity: severity})
+			if err := tx.Commit(c.Request.Context()); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
 			}
-		}
 
-		temp := float32(1)
-		// Example output something like ["avoid inflammatory foods", "increase hydration", "improve sleep hygiene"], only 3
-		result, err := client.Models.GenerateContent(ctx2, "gemini-2.5-flash-lite", genai.Text(`Be short and concise, and specific. Return an array of 3 recommendations to reduce flare-ups based on the following data:
-			Sleep Data: `+fmt.Sprintf("%v", sleepData)+
-			`Diet Data: `+fmt.Sprintf("%v", dietData)+
-			`Menstrual Data: `+fmt.Sprintf("%v", menstrualData)+
-			`Symptoms Data: `+fmt.Sprintf("%v", symptomsData)+
-			`Triggers: `+fmt.Sprintf("%v", triggers)), &genai.GenerateContentConfig{
-			SystemInstruction: &genai.Content{
-				Role: "Output in the format of a JSON array with 3 items. Example: [\"recommendation1\", \"recommendation2\", \"recommendation3\"]. Output only the json array nothing more. Be very short and concise.",
-			},
-			Temperature:      &temp,
-			MaxOutputTokens:  200,
-			ResponseMIMEType: "application/json",
-			ResponseSchema: &genai.Schema{
-				Type: genai.TypeArray,
-				Items: &genai.Schema{
-					Type: genai.TypeString,
+			c.JSON(http.StatusOK, gin.H{
+				"config": cfg,
+				"inserted": gin.H{
+					"sleep":     len(data.Sleep),
+					"diet":      len(data.Diet),
+					"menstrual": len(data.Menstrual),
+					"symptoms":  len(data.Symptoms),
 				},
-			},
+			})
 		})
+	}
+
+	r.GET("/triggers/explain", shed, func(c *gin.Context) {
+		if client == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": errAIDisabled.Error()})
+			return
+		}
+		opts, err := parseAnalysisOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
+		queries := database.New(pool)
+		data, err := loadAnalysisData(c.Request.Context(), queries)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if len(data.Symptoms) == 0 {
+			respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+			return
+		}
 
-		if len(result.Candidates) == 0 {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "No recommendations generated"})
+		ranked := analyzeTriggers(data, opts).rankTriggers()
+		if len(ranked) == 0 {
+			respondInsufficientData(c, "No triggers found to explain.", requireSpikeTriggers, gin.H{"disclaimer": medicalDisclaimer})
 			return
 		}
 
-		recommendations := result.Text()
-		c.String(http.StatusOK, recommendations)
-	})
+		key, err := fingerprint(ranked)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if explanation, ok := explainCache.Get(key); ok {
+			c.JSON(http.StatusOK, gin.H{
+				"explanation": explanation,
+				"triggers":    ranked,
+				"disclaimer":  medicalDisclaimer,
+				"cached":      true,
+			})
+			return
+		}
 
-	r.GET("/seven_day_average", func(c *gin.Context) {
-		queries := database.New(pool)
-		symptomsData, err := queries.GetAllSymptoms(c.Request.Context())
+		triggerJSON, err := json.Marshal(ranked)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		if len(symptomsData) < 7 {
-			c.JSON(http.StatusOK, gin.H{"message": "Not enough data for 7-day average"})
+
+		temp := float32(0.5)
+		genCtx, span := tracer.Start(c.Request.Context(), "gemini.GenerateContent")
+		geminiCalls.Add(1)
+		result, err := client.Models.GenerateContent(genCtx, "gemini-2.5-flash-lite", genai.Text(
+			"These are possible flare-up triggers found in a person's endometriosis symptom log, ranked by how many symptom spikes they preceded. "+
+				"count is the number of spikes the trigger was logged the day before; lift compares the spike rate after the trigger to the overall spike rate (above 1 means more likely). "+
+				"Explain in plain language, in under 150 words, what these results mean and why these factors might matter. Do not give medical advice.\n"+
+				string(triggerJSON)), &genai.GenerateContentConfig{
+			Temperature:     &temp,
+			MaxOutputTokens: 400,
+		})
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if reason, blocked := blockedReason(result); blocked {
+			slog.Warn("Gemini withheld trigger explanation", "finish_reason", reason)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Gemini declined to explain these triggers (%s)", reason)})
 			return
 		}
-		var totalNausea, totalFatigue, totalPain int32
-		for i := len(symptomsData) - 7; i < len(symptomsData); i++ {
-			sym := symptomsData[i]
-			totalNausea += sym.Nausea.Int32
-			totalFatigue += sym.Fatigue.Int32
-			totalPain += sym.Pain.Int32
+		explanation := strings.TrimSpace(result.Text())
+		if explanation == "" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "No explanation generated"})
+			return
 		}
-		averageNausea := float64(totalNausea) / 7.0
-		averageFatigue := float64(totalFatigue) / 7.0
-		averagePain := float64(totalPain) / 7.0
+		explainCache.Set(key, explanation)
+
 		c.JSON(http.StatusOK, gin.H{
-			"average_nausea":  averageNausea,
-			"average_fatigue": averageFatigue,
-			"average_pain":    averagePain,
+			"explanation": explanation,
+			"triggers":    ranked,
+			"disclaimer":  medicalDisclaimer,
+			"cached":      false,
 		})
 	})
 
-	fmt.Printf("Server is running on http://localhost:%s\n", port)
-	if err := r.Run(":" + port); err != nil {
+	// runImport writes a parsed import in one transaction and responds with
+	// the per-domain counts
+	runImport := func(c *gin.Context, payload importPayload, mode string) {
+		// UTC instants in the file are dated in the user's timezone
+		loc, ok := userLocation(c, database.New(pool))
+		if !ok {
+			return
+		}
+		parsed, err := parseImport(payload, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tx, err := pool.Begin(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer tx.Rollback(c.Request.Context())
+
+		report, err := importRecords(c.Request.Context(), database.New(pool).WithTx(tx), parsed, mode)
+		var conflict *importConflictError
+		if errors.As(err, &conflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "domain": conflict.Domain, "date": conflict.Date})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tx.Commit(c.Request.Context()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"conflict": mode, "results": report})
+	}
+
+	r.POST("/import.json", func(c *gin.Context) {
+		mode, ok := importMode(c)
+		if !ok {
+			return
+		}
+
+		var payload importPayload
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		runImport(c, payload, mode)
+	})
+
+	r.POST("/import/csv", func(c *gin.Context) {
+		mode, ok := importMode(c)
+		if !ok {
+			return
+		}
+
+		// Accept either a multipart upload in the "file" field or a raw CSV body
+		var body io.Reader = c.Request.Body
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			file, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "missing CSV upload in the file field"})
+				return
+			}
+			f, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			defer f.Close()
+			body = f
+		}
+
+		payload, lineErrs, err := parseCSVImport(body, c.Query("type"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(lineErrs) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid CSV rows, nothing was imported", "errors": lineErrs})
+			return
+		}
+		runImport(c, payload, mode)
+	})
+
+	fmt.Printf("Server is listening on %s\n", addr)
+	if err := r.Run(addr); err != nil {
 		log.Fatalf("Failed to run server: %v", err)
 	}
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"terrahack2025-backend/database"
+)
+
+// autoMigrate applies the embedded schema when AUTO_MIGRATE=true, so a fresh
+// database works without running schema.sql by hand. The schema only uses
+// "if not exists" and "create or replace", so it is safe on every start.
+func autoMigrate(ctx context.Context, pool *pgxpool.Pool) error {
+	queries := database.New(pool)
+	before, err := queries.GetTableNames(ctx)
+	if err != nil {
+		return err
+	}
+	// Without arguments pgx uses the simple protocol, which allows the
+	// whole multi-statement script in one call
+	if _, err := pool.Exec(ctx, database.Schema); err != nil {
+		return err
+	}
+	after, err := queries.GetTableNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	existed := map[string]bool{}
+	for _, t := range before {
+		existed[t] = true
+	}
+	var created []string
+	for _, t := range after {
+		if !existed[t] {
+			created = append(created, t)
+		}
+	}
+	slog.Info("auto-migrate applied schema", "created_tables", created, "existing_tables", len(before))
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Record types that can be addressed by path, keyed by table name
+var recordTypes = map[string]bool{
+	"sleep":     true,
+	"diet":      true,
+	"menstrual": true,
+	"symptoms":  true,
+}
+
+// Canonical meal names accepted by /insert_diet
+var validMeals = map[string]bool{
+	"breakfast": true,
+	"lunch":     true,
+	"dinner":    true,
+	"snack":     true,
+}
+
+// normalizeMeal trims and lowercases a meal name so "Breakfast" and
+// "BREAKFAST " are stored the same way. Empty meals are allowed.
+func normalizeMeal(meal string) (string, error) {
+	meal = strings.ToLower(strings.TrimSpace(meal))
+	if meal == "" || validMeals[meal] {
+		return meal, nil
+	}
+	return "", fmt.Errorf("invalid meal %q, expected one of breakfast, lunch, dinner, snack", meal)
+}
+
+// normalizeItem trims and lowercases a food item so the same food is always
+// stored under one spelling
+func normalizeItem(item string) string {
+	return strings.ToLower(strings.TrimSpace(item))
+}
+
+// normalizeItems normalizes every item and drops empty ones
+func normalizeItems(items []string) []string {
+	normalized := []string{}
+	for _, item := range items {
+		if item = normalizeItem(item); item != "" {
+			normalized = append(normalized, item)
+		}
+	}
+	return normalized
+}
+
+var caffeineKeywords = []string{
+	"coffee", "espresso", "latte", "cappuccino", "americano", "mocha",
+	"macchiato", "tea", "matcha", "chai", "cola", "energy drink",
+}
+
+var alcoholKeywords = []string{
+	"beer", "wine", "vodka", "whiskey", "whisky", "rum", "gin", "tequila",
+	"cider", "champagne", "prosecco", "cocktail", "sake", "margarita",
+}
+
+// containsKeyword reports whether any item mentions one of the keywords as a
+// whole word (or its plural), so "gin" doesn't match "ginger"
+func containsKeyword(items []string, keywords []string) bool {
+	for _, item := range items {
+		words := strings.FieldsFunc(strings.ToLower(item), func(r rune) bool {
+			return !unicode.IsLetter(r)
+		})
+		padded := " " + strings.Join(words, " ") + " "
+		for _, kw := range keywords {
+			if strings.Contains(padded, " "+kw+" ") || strings.Contains(padded, " "+kw+"s ") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dietFlags derives the caffeine and alcohol flags for a meal's items.
+// Decaf items don't count towards caffeine.
+func dietFlags(items []string) (caffeine bool, alcohol bool) {
+	var caffeinated []string
+	for _, item := range items {
+		if !strings.Contains(strings.ToLower(item), "decaf") {
+			caffeinated = append(caffeinated, item)
+		}
+	}
+	return containsKeyword(caffeinated, caffeineKeywords), containsKeyword(items, alcoholKeywords)
+}
+
+// optionalInt4 stores an omitted JSON number as null
+func optionalInt4(v *int32) pgtype.Int4 {
+	if v == nil {
+		return pgtype.Int4{}
+	}
+	return pgtype.Int4{Int32: *v, Valid: true}
+}
+
+// How a record was logged, stored in each logged table's source column
+const (
+	sourceManual = "manual"
+	sourceImport = "import"
+	// Parsed from free text, so less certain than the other two
+	sourceNLP = "nlp"
+)
+
+// optionalText stores an empty string as null, so the column default applies
+func optionalText(v string) pgtype.Text {
+	return pgtype.Text{String: v, Valid: v != ""}
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestNormalizeMeal(t *testing.T) {
+	tests := []struct {
+		meal    string
+		want    string
+		wantErr bool
+	}{
+		{"breakfast", "breakfast", false},
+		{"Breakfast", "breakfast", false},
+		{"BREAKFAST ", "breakfast", false},
+		{"  Lunch\t", "lunch", false},
+		{"DiNnEr", "dinner", false},
+		{"\nsnack\n", "snack", false},
+		{"", "", false},
+		{"   ", "", false},
+		{"brunch", "", true},
+		{"break fast", "", true},
+		{"dinner!", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeMeal(tt.meal)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeMeal(%q) error = %v, want error %v", tt.meal, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeMeal(%q) = %q, want %q", tt.meal, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeMealErrorNamesMeal(t *testing.T) {
+	_, err := normalizeMeal(" Brunch ")
+	want := `invalid meal "brunch", expected one of breakfast, lunch, dinner, snack`
+	if err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	aggregateMean = "mean"
+	aggregateMax  = "max"
+)
+
+const (
+	baselineGlobal  = "global"
+	baselineRolling = "rolling"
+
+	defaultBaselineWindow = 30
+)
+
+const (
+	sleepTriggerDuration = "duration"
+	sleepTriggerQuality  = "quality"
+	sleepTriggerBoth     = "both"
+)
+
+// analysisOptions are the query parameters shared by the analysis endpoints.
+// The zero value is not valid; use defaultAnalysisOptions.
+type analysisOptions struct {
+	// Aggregate is how a day's score is combined from its symptom components
+	Aggregate string
+	// Baseline selects whether spikes are judged against all history
+	// ("global") or only the trailing BaselineWindow days ("rolling")
+	Baseline       string
+	BaselineWindow int
+	// MinSpikeDelta floors the spike threshold so small jumps in very stable
+	// data aren't flagged. Zero leaves the threshold unchanged.
+	MinSpikeDelta float64
+	// MinSpikeSeverity is the score a day has to reach, as well as clearing
+	// the threshold, to count as a spike. Zero lets any jump count.
+	MinSpikeSeverity float64
+	// IncludeSameDay also counts triggers logged on the spike day itself
+	IncludeSameDay bool
+	// RecencyHalfLife decays each trigger occurrence by half every this
+	// many days before the latest logged day. Zero disables decay.
+	RecencyHalfLife float64
+	// SleepTrigger is whether low sleep means a short night ("duration"),
+	// a poorly rated one ("quality") or either ("both")
+	SleepTrigger string
+	// Sources limits analysis to records logged through these sources, all
+	// of them when empty, e.g. to leave out less certain nlp entries
+	Sources []string
+}
+
+func defaultAnalysisOptions() analysisOptions {
+	return analysisOptions{
+		Aggregate:      aggregateMean,
+		Baseline:       baselineGlobal,
+		BaselineWindow: defaultBaselineWindow,
+		SleepTrigger:   sleepTriggerDuration,
+	}
+}
+
+// floorThreshold raises a spike threshold to MinSpikeDelta. At the default
+// of 0 the threshold is left alone, negative ones included.
+func (o analysisOptions) floorThreshold(threshold float64) float64 {
+	if o.MinSpikeDelta > 0 {
+		return max(threshold, o.MinSpikeDelta)
+	}
+	return threshold
+}
+
+// parseAnalysisOptions reads and validates the shared analysis parameters
+func parseAnalysisOptions(c *gin.Context) (analysisOptions, error) {
+	opts := defaultAnalysisOptions()
+
+	if v := c.Query("aggregate"); v != "" {
+		if v != aggregateMean && v != aggregateMax {
+			return opts, fmt.Errorf("invalid aggregate %q, expected mean or max", v)
+		}
+		opts.Aggregate = v
+	}
+
+	if v := c.Query("baseline"); v != "" {
+		if v != baselineGlobal && v != baselineRolling {
+			return opts, fmt.Errorf("invalid baseline %q, expected global or rolling", v)
+		}
+		opts.Baseline = v
+	}
+
+	if v := c.Query("baseline_window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 || n > 365 {
+			return opts, fmt.Errorf("invalid baseline_window %q, expected an integer between 2 and 365", v)
+		}
+		opts.BaselineWindow = n
+	}
+
+	if v := c.Query("min_spike_delta"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 0 || n > 10 {
+			return opts, fmt.Errorf("invalid min_spike_delta %q, expected a number between 0 and 10", v)
+		}
+		opts.MinSpikeDelta = n
+	}
+
+	if v := c.Query("min_spike_severity"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 0 || n > 10 {
+			return opts, fmt.Errorf("invalid min_spike_severity %q, expected a number between 0 and 10", v)
+		}
+		opts.MinSpikeSeverity = n
+	}
+
+	if v := c.Query("include_same_day"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid include_same_day %q, expected true or false", v)
+		}
+		opts.IncludeSameDay = b
+	}
+
+	if v := c.Query("recency_halflife_days"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n <= 0 || n > 3650 {
+			return opts, fmt.Errorf("invalid recency_halflife_days %q, expected a positive number of days up to 3650", v)
+		}
+		opts.RecencyHalfLife = n
+	}
+
+	if v := c.Query("sleep_trigger"); v != "" {
+		if v != sleepTriggerDuration && v != sleepTriggerQuality && v != sleepTriggerBoth {
+			return opts, fmt.Errorf("invalid sleep_trigger %q, expected duration, quality or both", v)
+		}
+		opts.SleepTrigger = v
+	}
+
+	if v := c.Query("sources"); v != "" {
+		for _, source := range strings.Split(v, ",") {
+			source = strings.TrimSpace(source)
+			if source != sourceManual && source != sourceImport && source != sourceNLP {
+				return opts, fmt.Errorf("invalid source %q in sources, expected a list of manual, import or nlp", source)
+			}
+			opts.Sources = append(opts.Sources, source)
+		}
+	}
+
+	for _, rule := range optionConflicts {
+		if rule.conflicts(c, opts) {
+			return opts, errors.New(rule.message)
+		}
+	}
+
+	return opts, nil
+}
+
+// optionConflict rejects a parameter combination where one parameter would
+// otherwise be silently ignored or contradict another
+type optionConflict struct {
+	conflicts func(c *gin.Context, opts analysisOptions) bool
+	message   string
+}
+
+var optionConflicts = []optionConflict{
+	{
+		conflicts: func(c *gin.Context, opts analysisOptions) bool {
+			return c.Query("baseline_window") != "" && opts.Baseline != baselineRolling
+		},
+		message: "baseline_window only applies with baseline=rolling, remove it or set baseline=rolling",
+	},
+}
+
+// spikeParams only change how spikes are detected and triggers ranked
+var spikeParams = []string{
+	"baseline", "baseline_window", "min_spike_delta", "min_spike_severity",
+	"include_same_day", "recency_halflife_days", "sleep_trigger",
+}
+
+// parseScoreOptions is parseAnalysisOptions for endpoints that only score
+// days and never detect spikes, rejecting the spike parameters they would
+// otherwise silently ignore
+func parseScoreOptions(c *gin.Context) (analysisOptions, error) {
+	for _, p := range spikeParams {
+		if c.Query(p) != "" {
+			return defaultAnalysisOptions(), fmt.Errorf("%s only applies to spike detection, which this endpoint doesn't use, remove it", p)
+		}
+	}
+	return parseAnalysisOptions(c)
+}
+
+// parseFlareOptions reads the threshold and max_gap_days parameters shared
+// by the flare-up endpoints. A day above threshold is a flare day, by
+// default one standard deviation above the mean score of days, the same
+// "high severity" cutoff /predict_flareups uses. Flare days at most
+// max_gap_days apart (default 0) are one episode.
+func parseFlareOptions(c *gin.Context, days []scoredDay) (float64, int, error) {
+	scores := make([]float64, len(days))
+	for i, d := range days {
+		scores[i] = d.Score
+	}
+	mean, stdDev := meanStdDev(scores)
+	threshold := mean + stdDev
+	if v := c.Query("threshold"); v != "" {
+		var err error
+		threshold, err = strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(threshold) || math.IsInf(threshold, 0) {
+			return 0, 0, errors.New("invalid threshold, expected a finite number")
+		}
+	}
+
+	maxGap := 0
+	if v := c.Query("max_gap_days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("invalid max_gap_days, expected a non-negative integer")
+		}
+		maxGap = n
+	}
+	return threshold, maxGap, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testContext(target string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	return c
+}
+
+func TestParseAnalysisOptionsConflicts(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{"", false},
+		{"baseline=rolling&baseline_window=14", false},
+		{"baseline_window=14", true},
+		{"baseline=global&baseline_window=14", true},
+		{"min_spike_delta=1&min_spike_severity=3&sleep_trigger=both", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := parseAnalysisOptions(testContext("/find_triggers?" + tt.query))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseAnalysisOptions(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseScoreOptionsRejectsSpikeParams(t *testing.T) {
+	values := map[string]string{
+		"baseline":              "rolling",
+		"baseline_window":       "14",
+		"min_spike_delta":       "1",
+		"min_spike_severity":    "3",
+		"include_same_day":      "true",
+		"recency_halflife_days": "30",
+		"sleep_trigger":         "quality",
+	}
+	for _, p := range spikeParams {
+		t.Run(p, func(t *testing.T) {
+			_, err := parseScoreOptions(testContext("/flare_episodes?" + p + "=" + values[p]))
+			if err == nil {
+				t.Fatalf("parseScoreOptions accepted %s", p)
+			}
+			if want := p + " only applies to spike detection, which this endpoint doesn't use, remove it"; err.Error() != want {
+				t.Errorf("error = %q, want %q", err, want)
+			}
+		})
+	}
+}
+
+func TestParseScoreOptions(t *testing.T) {
+	opts, err := parseScoreOptions(testContext("/flare_episodes?aggregate=max&sources=manual,import"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Aggregate != aggregateMax || len(opts.Sources) != 2 {
+		t.Errorf("parseScoreOptions() = %+v, want aggregate max and two sources", opts)
+	}
+	if _, err := parseScoreOptions(testContext("/flare_episodes?aggregate=median")); err == nil {
+		t.Error("parseScoreOptions accepted an invalid aggregate")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"terrahack2025-backend/database"
+)
+
+// flareupPrediction is the /predict_flareups result. When there is nothing
+// to predict from, Requirement names the unmet data requirement instead.
+type flareupPrediction struct {
+	Model       string   `json:"model"`
+	Probability float64  `json:"flareup_probability"`
+	Predictions []string `json:"flareup_predictions"`
+	// How much each historical trigger adds to Probability
+	Contributions []triggerContribution `json:"trigger_contributions"`
+
+	Message     string `json:"message,omitempty"`
+	Requirement string `json:"requirement,omitempty"`
+}
+
+// predictFlareups checks the last 3 entries of each domain for the triggers
+// found in analysis and estimates the chance of a flare-up with model
+func predictFlareups(data analysisData, analysis triggerAnalysis, model flareupModel) flareupPrediction {
+	// Check if any of these triggers have happened in the last 3 days of the data
+	recentSleep := make(map[string]database.Sleep)
+	for i := len(data.Sleep) - 3; i < len(data.Sleep); i++ {
+		if i >= 0 {
+			s := data.Sleep[i]
+			recentSleep[s.Date.Time.Format("2006-01-02")] = s
+		}
+	}
+	recentDiet := make(map[string][]database.Diet)
+	for i := len(data.Diet) - 3; i < len(data.Diet); i++ {
+		if i >= 0 {
+			d := data.Diet[i]
+			date := d.Date.Time.Format("2006-01-02")
+			recentDiet[date] = append(recentDiet[date], d)
+		}
+	}
+	recentMenstrual := make(map[string]database.Menstrual)
+	for i := len(data.Menstrual) - 3; i < len(data.Menstrual); i++ {
+		if i >= 0 {
+			m := data.Menstrual[i]
+			recentMenstrual[m.Date.Time.Format("2006-01-02")] = m
+		}
+	}
+	// Scored days already combine every entry logged on the same date
+	recentSeverity := make(map[string]float64)
+	for i := len(analysis.ScoredDays) - 3; i < len(analysis.ScoredDays); i++ {
+		if i >= 0 {
+			d := analysis.ScoredDays[i]
+			recentSeverity[d.Date.Format("2006-01-02")] = d.Score
+		}
+	}
+
+	// Every recent date from any domain, so missing sleep logs don't hide
+	// recent diet or menstrual triggers
+	dateSet := map[string]bool{}
+	for date := range recentSleep {
+		dateSet[date] = true
+	}
+	for date := range recentDiet {
+		dateSet[date] = true
+	}
+	for date := range recentMenstrual {
+		dateSet[date] = true
+	}
+	var dates []string
+	for date := range dateSet {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	var recentFlareupPredictions []string
+	recent := recentFactors{Factors: map[string]bool{}}
+	for _, date := range dates {
+		for factor := range analysis.ByDate.factors(date) {
+			recent.Factors[factor] = true
+		}
+
+		if sleep, ok := recentSleep[date]; ok {
+			if analysis.ByDate.lowSleep(sleep) {
+				recentFlareupPredictions = append(recentFlareupPredictions, fmt.Sprintf("Low sleep hours on %s", date))
+			}
+		}
+
+		if diets, ok := recentDiet[date]; ok {
+			for _, d := range diets {
+				for _, item := range d.Items {
+					recentFlareupPredictions = append(recentFlareupPredictions, fmt.Sprintf("%s consumed on %s", strings.Title(item), date))
+				}
+			}
+		}
+
+		if menstrual, ok := recentMenstrual[date]; ok {
+			recentFlareupPredictions = append(recentFlareupPredictions, fmt.Sprintf("Menstrual event %s on %s", menstrual.PeriodEvent.String, date))
+			recentFlareupPredictions = append(recentFlareupPredictions, fmt.Sprintf("Flow level %s on %s", menstrual.FlowLevel.String, date))
+		}
+
+		if avgSeverity, ok := recentSeverity[date]; ok {
+			if avgSeverity > analysis.Mean+analysis.StdDev { // Predict flareup if above average severity
+				recentFlareupPredictions = append(recentFlareupPredictions, fmt.Sprintf("High symptom severity on %s: %.2f", date, avgSeverity))
+			}
+		}
+	}
+
+	if len(recentFlareupPredictions) == 0 {
+		return flareupPrediction{Message: "No recent flareup predictions found.", Requirement: requireRecentFactors}
+	}
+
+	// Calculate probability of flareup based on recent data, and severity of triggers
+	recent.Predictions = len(recentFlareupPredictions)
+	probability, contributions := model.predict(analysis, recent)
+	if len(contributions) == 0 {
+		return flareupPrediction{Message: "No triggers found in recent data.", Requirement: requireSpikeTriggers}
+	}
+	for i, tc := range contributions {
+		contributions[i].MeanSeverity = math.Round(tc.MeanSeverity*100) / 100
+		contributions[i].Weight = math.Round(tc.Weight*100) / 100
+		contributions[i].Contribution = math.Round(tc.Contribution*100) / 100
+	}
+	probability = math.Round(probability*100) / 100 // Round to 2 decimal places
+	return flareupPrediction{Model: model.Name(), Probability: probability, Predictions: recentFlareupPredictions, Contributions: contributions}
+}
+
+// respondFlareupPrediction answers /predict_flareups from the loaded data.
+// extra is added to both the prediction and the insufficient data response.
+func respondFlareupPrediction(c *gin.Context, data analysisData, opts analysisOptions, model flareupModel, extra gin.H) {
+	if len(data.Symptoms) == 0 {
+		respondInsufficientData(c, "No symptom data found.", requireSymptomEntry, nil)
+		return
+	}
+	analysis := analyzeTriggers(data, opts)
+
+	prediction := predictFlareups(data, analysis, model)
+	if prediction.Requirement != "" {
+		respondInsufficientData(c, prediction.Message, prediction.Requirement, extra)
+		return
+	}
+	res := gin.H{
+		"model":                 prediction.Model,
+		"flareup_probability":   prediction.Probability,
+		"flareup_predictions":   prediction.Predictions,
+		"trigger_contributions": prediction.Contributions,
+	}
+	for k, v := range extra {
+		res[k] = v
+	}
+	respondRounded(c, res)
+}
+
+// triggerContribution is one trigger's share of the flare-up probability
+type triggerContribution struct {
+	Type string `json:"type"` // low_sleep, food, menstrual_event, flow_level or custom
+	Name string `json:"name"`
+	// Spikes the trigger preceded and their mean severity
+	Count        int     `json:"count"`
+	MeanSeverity float64 `json:"mean_severity"`
+	// MeanSeverity relative to the mean severity of all spikes
+	Weight float64 `json:"weight"`
+	// Percentage points added to the probability, before the 100% cap for
+	// the ratio model and as the drop without the trigger for the others
+	Contribution float64 `json:"contribution"`
+}
+
+// triggerContributions weights each trigger's count by how severe the spikes
+// it preceded were compared with the average spike:
+//
+//	weight       = mean severity of the trigger's spikes / mean severity of all spikes
+//	contribution = count * weight / recent predictions * 100
+//
+// The probability is the sum of the contributions capped at 100. With
+// equally severe spikes every weight is 1, which gives the unweighted
+// total triggers / recent predictions.
+func (a triggerAnalysis) triggerContributions(recentPredictions int) []triggerContribution {
+	var spikeTotal float64
+	for _, severity := range a.SpikeDays {
+		spikeTotal += severity
+	}
+	if len(a.SpikeDays) == 0 || spikeTotal == 0 || recentPredictions == 0 {
+		return nil
+	}
+	meanSpike := spikeTotal / float64(len(a.SpikeDays))
+
+	var contributions []triggerContribution
+	add := func(kind, name string, details []triggerDetail) {
+		if len(details) == 0 {
+			return
+		}
+		var total float64
+		for _, d := range details {
+			total += d.TriggerSeverity
+		}
+		mean := total / float64(len(details))
+		weight := mean / meanSpike
+		contributions = append(contributions, triggerContribution{
+			Type:         kind,
+			Name:         name,
+			Count:        len(details),
+			MeanSeverity: mean,
+			Weight:       weight,
+			Contribution: float64(len(details)) * weight / float64(recentPredictions) * 100,
+		})
+	}
+	add("low_sleep", "low_sleep", a.LowSleepDetails)
+	for item, details := range a.FoodItemDetails {
+		add("food", item, details)
+	}
+	for event, details := range a.MenstrualEventDetails {
+		add("menstrual_event", event, details)
+	}
+	for level, details := range a.FlowLevelDetails {
+		add("flow_level", level, details)
+	}
+	for name, details := range a.CustomFactorDetails {
+		add("custom", name, details)
+	}
+
+	sortContributions(contributions)
+	return contributions
+}
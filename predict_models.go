@@ -0,0 +1,201 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	flareupModelRatio    = "ratio"
+	flareupModelLogistic = "logistic"
+	flareupModelBayes    = "bayes"
+)
+
+// flareupModel turns the factors logged in the last few days into a
+// flare-up probability in percent, with each factor's part in it. It
+// returns no contributions when the history has nothing to go on.
+type flareupModel interface {
+	Name() string
+	predict(a triggerAnalysis, recent recentFactors) (float64, []triggerContribution)
+}
+
+// recentFactors are the factors found in the recent entries, keyed like
+// dailyData.factors, and how many recent predictions they produced
+type recentFactors struct {
+	Factors     map[string]bool
+	Predictions int
+}
+
+var flareupModels = map[string]flareupModel{
+	flareupModelRatio:    ratioModel{},
+	flareupModelLogistic: logisticModel{},
+	flareupModelBayes:    bayesModel{},
+}
+
+// ratioModel is the original estimate: every historical trigger's
+// severity-weighted spike count over the number of recent predictions (see
+// triggerContributions). It assumes nothing about which factors were seen
+// recently, so it grows with history rather than with the recent days.
+type ratioModel struct{}
+
+func (ratioModel) Name() string { return flareupModelRatio }
+
+func (ratioModel) predict(a triggerAnalysis, recent recentFactors) (float64, []triggerContribution) {
+	contributions := a.triggerContributions(recent.Predictions)
+	var probability float64
+	for _, tc := range contributions {
+		probability += tc.Contribution
+	}
+	return math.Min(probability, 100), contributions
+}
+
+// Strength of the prior pulling small samples towards the base spike rate,
+// in days
+const flareupPriorDays = 2
+
+// spikePrior is the smoothed base spike rate and the Beta prior built on it,
+// so factors seen once or never preceding a spike don't give rates of 0 or 1
+func (a triggerAnalysis) spikePrior() (base, alpha, beta float64) {
+	candidates := max(len(a.ScoredDays)-1, 0)
+	base = (float64(len(a.SpikeDays)) + 1) / (float64(candidates) + 2)
+	return base, flareupPriorDays * base, flareupPriorDays * (1 - base)
+}
+
+// knownContributions indexes the ratio model's per-trigger figures by
+// factor key, so the other models can report the same count, severity and
+// weight
+func (a triggerAnalysis) knownContributions() map[string]triggerContribution {
+	known := map[string]triggerContribution{}
+	for _, tc := range a.triggerContributions(1) {
+		tc.Contribution = 0
+		known[contributionKey(tc)] = tc
+	}
+	return known
+}
+
+// factorContribution is the known figures for factor, or a weight of 1 for
+// a factor that never preceded a spike
+func factorContribution(known map[string]triggerContribution, factor string) triggerContribution {
+	if tc, ok := known[factor]; ok {
+		return tc
+	}
+	kind, name, _ := strings.Cut(factor, ":")
+	if name == "" {
+		name = kind
+	}
+	return triggerContribution{Type: kind, Name: name, Weight: 1}
+}
+
+// logisticModel adds up log-odds: it starts from the base spike rate and
+// each recent factor shifts the odds by its smoothed lift, scaled by how
+// severe the spikes it preceded were. It assumes factors act independently
+// and add up on the log-odds scale. A factor's contribution is how many
+// points the probability drops without it.
+type logisticModel struct{}
+
+func (logisticModel) Name() string { return flareupModelLogistic }
+
+func (logisticModel) predict(a triggerAnalysis, recent recentFactors) (float64, []triggerContribution) {
+	if len(a.SpikeDays) == 0 || len(recent.Factors) == 0 {
+		return 0, nil
+	}
+	base, alpha, beta := a.spikePrior()
+	_, lifts := a.lifts()
+	known := a.knownContributions()
+	sigmoid := func(z float64) float64 { return 1 / (1 + math.Exp(-z)) }
+
+	z := math.Log(base / (1 - base))
+	coefficients := map[string]float64{}
+	var contributions []triggerContribution
+	for factor := range recent.Factors {
+		l := lifts[factor]
+		tc := factorContribution(known, factor)
+		rate := (float64(l.Spikes) + alpha) / (float64(l.DaysPresent) + alpha + beta)
+		coefficients[factor] = tc.Weight * math.Log(rate/base)
+		z += coefficients[factor]
+		contributions = append(contributions, tc)
+	}
+	probability := sigmoid(z) * 100
+	for i, tc := range contributions {
+		contributions[i].Contribution = probability - sigmoid(z-coefficients[contributionKey(tc)])*100
+	}
+	sortContributions(contributions)
+	return probability, contributions
+}
+
+// bayesModel is the posterior mean spike rate over past days that followed
+// any of the recent factors, with a Beta prior centred on the base spike
+// rate. It assumes the future behaves like the days that followed the same
+// factors before, and makes no assumption about how factors combine. A
+// factor's contribution is how many points the estimate drops without it.
+type bayesModel struct{}
+
+func (bayesModel) Name() string { return flareupModelBayes }
+
+func (bayesModel) predict(a triggerAnalysis, recent recentFactors) (float64, []triggerContribution) {
+	if len(a.SpikeDays) == 0 || len(recent.Factors) == 0 {
+		return 0, nil
+	}
+	_, alpha, beta := a.spikePrior()
+	estimate := func(factors map[string]bool) float64 {
+		days, spikes := a.spikesAfterAny(factors)
+		return (float64(spikes) + alpha) / (float64(days) + alpha + beta) * 100
+	}
+
+	probability := estimate(recent.Factors)
+	known := a.knownContributions()
+	var contributions []triggerContribution
+	for factor := range recent.Factors {
+		without := map[string]bool{}
+		for f := range recent.Factors {
+			if f != factor {
+				without[f] = true
+			}
+		}
+		tc := factorContribution(known, factor)
+		tc.Contribution = probability - estimate(without)
+		contributions = append(contributions, tc)
+	}
+	sortContributions(contributions)
+	return probability, contributions
+}
+
+// spikesAfterAny counts the scored days, after the first, whose previous day
+// had at least one of factors logged, and how many of them were spikes
+func (a triggerAnalysis) spikesAfterAny(factors map[string]bool) (days, spikes int) {
+	for i := 1; i < len(a.ScoredDays); i++ {
+		date := a.ScoredDays[i].Date
+		for factor := range a.ByDate.factors(date.AddDate(0, 0, -1).Format("2006-01-02")) {
+			if factors[factor] {
+				days++
+				if _, ok := a.SpikeDays[date.Format("2006-01-02")]; ok {
+					spikes++
+				}
+				break
+			}
+		}
+	}
+	return days, spikes
+}
+
+// contributionKey is the dailyData.factors key of a contribution
+func contributionKey(tc triggerContribution) string {
+	if tc.Type == "low_sleep" {
+		return "low_sleep"
+	}
+	return tc.Type + ":" + tc.Name
+}
+
+// sortContributions orders contributions largest first, then by type and name
+func sortContributions(contributions []triggerContribution) {
+	sort.Slice(contributions, func(i, j int) bool {
+		if contributions[i].Contribution != contributions[j].Contribution {
+			return contributions[i].Contribution > contributions[j].Contribution
+		}
+		if contributions[i].Type != contributions[j].Type {
+			return contributions[i].Type < contributions[j].Type
+		}
+		return contributions[i].Name < contributions[j].Name
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// severityAnalysis has four spikes, two severe and two mild, with coffee
+// logged before the two on coffeeDates
+func severityAnalysis(coffeeDates ...string) triggerAnalysis {
+	spikes := map[string]float64{
+		"2025-07-02": 8,
+		"2025-07-04": 8,
+		"2025-07-06": 2,
+		"2025-07-08": 2,
+	}
+	var details []triggerDetail
+	for _, date := range coffeeDates {
+		details = append(details, triggerDetail{Date: date, TriggerSeverity: spikes[date]})
+	}
+	return triggerAnalysis{
+		SpikeDays: spikes,
+		triggerSet: triggerSet{
+			FoodItemDetails: map[string][]triggerDetail{"coffee": details},
+		},
+	}
+}
+
+func TestRatioModelWeightsBySeverity(t *testing.T) {
+	recent := recentFactors{Predictions: 10}
+	severe, severeContributions := ratioModel{}.predict(severityAnalysis("2025-07-02", "2025-07-04"), recent)
+	mild, mildContributions := ratioModel{}.predict(severityAnalysis("2025-07-06", "2025-07-08"), recent)
+
+	// Same count, but the average spike is 5: weights 8/5 and 2/5
+	if math.Abs(severe-32) > 1e-9 || math.Abs(mild-8) > 1e-9 {
+		t.Errorf("probabilities = %v and %v, want 32 and 8", severe, mild)
+	}
+	if severe <= mild {
+		t.Errorf("severe history gave %v, not more than the mild history's %v", severe, mild)
+	}
+	if severeContributions[0].Count != mildContributions[0].Count {
+		t.Errorf("counts differ: %d and %d", severeContributions[0].Count, mildContributions[0].Count)
+	}
+	if w := severeContributions[0].Weight; math.Abs(w-1.6) > 1e-9 {
+		t.Errorf("severe weight = %v, want 1.6", w)
+	}
+}
+
+func TestRatioModelEqualSeverityIsUnweighted(t *testing.T) {
+	a := severityAnalysis("2025-07-02", "2025-07-04")
+	a.SpikeDays = map[string]float64{"2025-07-02": 8, "2025-07-04": 8}
+	probability, _ := ratioModel{}.predict(a, recentFactors{Predictions: 4})
+	// 2 triggers over 4 recent predictions
+	if math.Abs(probability-50) > 1e-9 {
+		t.Errorf("probability = %v, want 50", probability)
+	}
+}
+
+func TestRatioModelCapsAt100(t *testing.T) {
+	probability, _ := ratioModel{}.predict(severityAnalysis("2025-07-02", "2025-07-04"), recentFactors{Predictions: 1})
+	if probability != 100 {
+		t.Errorf("probability = %v, want the 100 cap", probability)
+	}
+}
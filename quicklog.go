@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"terrahack2025-backend/database"
+)
+
+// Quick-log presets map a one-word rating to the values stored for today.
+// They can be overridden per value through the "quick_log" setting, e.g.
+//
+//	{"symptom": {"bad": {"fatigue": 9, "pain": 9}}}
+//
+// Overrides are merged per field, so the bad preset above keeps nausea 8.
+// New rating words can be added too, but must set every field.
+//
+// Defaults:
+//
+//	symptom good -> nausea 1, fatigue 1, pain 1
+//	symptom ok   -> nausea 4, fatigue 4, pain 4
+//	symptom bad  -> nausea 8, fatigue 8, pain 8
+//	sleep well   -> 8 hours, quality 8
+//	sleep ok     -> 7 hours, quality 5
+//	sleep poorly -> 5 hours, quality 3
+
+type symptomPreset struct {
+	Nausea  int32 `json:"nausea"`
+	Fatigue int32 `json:"fatigue"`
+	Pain    int32 `json:"pain"`
+}
+
+type sleepPreset struct {
+	Duration float64 `json:"duration"`
+	Quality  int32   `json:"quality"`
+}
+
+type quickLogPresets struct {
+	Symptom map[string]symptomPreset `json:"symptom"`
+	Sleep   map[string]sleepPreset   `json:"sleep"`
+}
+
+// defaultQuickLogPresets returns fresh maps so settings can be merged in
+// without mutating shared state
+func defaultQuickLogPresets() quickLogPresets {
+	return quickLogPresets{
+		Symptom: map[string]symptomPreset{
+			"good": {Nausea: 1, Fatigue: 1, Pain: 1},
+			"ok":   {Nausea: 4, Fatigue: 4, Pain: 4},
+			"bad":  {Nausea: 8, Fatigue: 8, Pain: 8},
+		},
+		Sleep: map[string]sleepPreset{
+			"well":   {Duration: 8, Quality: 8},
+			"ok":     {Duration: 7, Quality: 5},
+			"poorly": {Duration: 5, Quality: 3},
+		},
+	}
+}
+
+const quickLogSetting = "quick_log"
+
+// The built-in rating words, in the order error messages list them
+var (
+	symptomRatings = []string{"good", "ok", "bad"}
+	sleepRatings   = []string{"well", "ok", "poorly"}
+)
+
+// quickLogOverrides is the stored quick_log setting. Pointers tell an
+// omitted field apart from 0 so it can keep the preset's value.
+type quickLogOverrides struct {
+	Symptom map[string]struct {
+		Nausea  *int32 `json:"nausea"`
+		Fatigue *int32 `json:"fatigue"`
+		Pain    *int32 `json:"pain"`
+	} `json:"symptom"`
+	Sleep map[string]struct {
+		Duration *float64 `json:"duration"`
+		Quality  *int32   `json:"quality"`
+	} `json:"sleep"`
+}
+
+// parseQuickLogOverrides decodes a quick_log setting, rejecting unknown
+// keys, and checks every override is in range
+func parseQuickLogOverrides(value []byte) (quickLogOverrides, error) {
+	var o quickLogOverrides
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o); err != nil {
+		return o, errors.New(`quick_log must be an object like {"symptom": {"bad": {"nausea": 8, "fatigue": 8, "pain": 8}}, "sleep": {"well": {"duration": 8, "quality": 8}}}`)
+	}
+	defaults := defaultQuickLogPresets()
+	for _, word := range slices.Sorted(maps.Keys(o.Symptom)) {
+		p := o.Symptom[word]
+		if err := checkRatingWord("symptom", word); err != nil {
+			return o, err
+		}
+		if _, ok := defaults.Symptom[word]; !ok && (p.Nausea == nil || p.Fatigue == nil || p.Pain == nil) {
+			return o, fmt.Errorf("invalid symptom.%s, a new rating must set nausea, fatigue and pain", word)
+		}
+		for i, v := range []*int32{p.Nausea, p.Fatigue, p.Pain} {
+			if v != nil && (*v < 0 || *v > 10) {
+				name := []string{"nausea", "fatigue", "pain"}[i]
+				return o, fmt.Errorf("invalid symptom.%s.%s, expected 0 to 10", word, name)
+			}
+		}
+	}
+	for _, word := range slices.Sorted(maps.Keys(o.Sleep)) {
+		p := o.Sleep[word]
+		if err := checkRatingWord("sleep", word); err != nil {
+			return o, err
+		}
+		if _, ok := defaults.Sleep[word]; !ok && (p.Duration == nil || p.Quality == nil) {
+			return o, fmt.Errorf("invalid sleep.%s, a new rating must set duration and quality", word)
+		}
+		if p.Duration != nil && (*p.Duration < 0 || *p.Duration > 24) {
+			return o, fmt.Errorf("invalid sleep.%s.duration, expected 0 to 24 hours", word)
+		}
+		if p.Quality != nil && (*p.Quality < 0 || *p.Quality > 10) {
+			return o, fmt.Errorf("invalid sleep.%s.quality, expected 0 to 10", word)
+		}
+	}
+	return o, nil
+}
+
+// checkRatingWord rejects words the quick_log value query can never match,
+// since it is lowercased before the lookup
+func checkRatingWord(kind, word string) error {
+	if word == "" || word != strings.ToLower(strings.TrimSpace(word)) {
+		return fmt.Errorf("invalid %s rating %q, expected a lowercase word", kind, word)
+	}
+	return nil
+}
+
+// validQuickLogSetting checks a value for the quick_log setting before it
+// is stored
+func validQuickLogSetting(value []byte) error {
+	_, err := parseQuickLogOverrides(value)
+	return err
+}
+
+// loadQuickLogPresets returns the defaults with the stored overrides merged
+// in field by field
+func loadQuickLogPresets(ctx context.Context, queries *database.Queries) (quickLogPresets, error) {
+	presets := defaultQuickLogPresets()
+	var raw json.RawMessage
+	if err := loadSetting(ctx, queries, quickLogSetting, &raw); err != nil || raw == nil {
+		return presets, err
+	}
+	o, err := parseQuickLogOverrides(raw)
+	if err != nil {
+		return presets, err
+	}
+	for word, v := range o.Symptom {
+		p := presets.Symptom[word]
+		if v.Nausea != nil {
+			p.Nausea = *v.Nausea
+		}
+		if v.Fatigue != nil {
+			p.Fatigue = *v.Fatigue
+		}
+		if v.Pain != nil {
+			p.Pain = *v.Pain
+		}
+		presets.Symptom[word] = p
+	}
+	for word, v := range o.Sleep {
+		p := presets.Sleep[word]
+		if v.Duration != nil {
+			p.Duration = *v.Duration
+		}
+		if v.Quality != nil {
+			p.Quality = *v.Quality
+		}
+		presets.Sleep[word] = p
+	}
+	return presets, nil
+}
+
+// ratingWords lists the configured words for an error message, built-in
+// words first in their usual order and then any added ones alphabetically,
+// e.g. "good, ok, bad or awful"
+func ratingWords[T any](builtin []string, presets map[string]T) string {
+	words := slices.Clone(builtin)
+	var added []string
+	for word := range presets {
+		if !slices.Contains(builtin, word) {
+			added = append(added, word)
+		}
+	}
+	slices.Sort(added)
+	words = append(words, added...)
+	if len(words) == 1 {
+		return words[0]
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " or " + words[len(words)-1]
+}
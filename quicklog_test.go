@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"terrahack2025-backend/database"
+)
+
+func TestValidQuickLogSetting(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{`{}`, ""},
+		{`{"symptom": {"bad": {"pain": 9}}}`, ""},
+		{`{"sleep": {"well": {"duration": 9.5}}}`, ""},
+		{`{"symptom": {"awful": {"nausea": 10, "fatigue": 10, "pain": 10}}}`, ""},
+		{`{"symptom": 5}`, `quick_log must be an object like {"symptom": {"bad": {"nausea": 8, "fatigue": 8, "pain": 8}}, "sleep": {"well": {"duration": 8, "quality": 8}}}`},
+		{`{"bad": {"pain": 9}}`, `quick_log must be an object like {"symptom": {"bad": {"nausea": 8, "fatigue": 8, "pain": 8}}, "sleep": {"well": {"duration": 8, "quality": 8}}}`},
+		{`{"symptom": {"bad": {"headache": 9}}}`, `quick_log must be an object like {"symptom": {"bad": {"nausea": 8, "fatigue": 8, "pain": 8}}, "sleep": {"well": {"duration": 8, "quality": 8}}}`},
+		{`{"symptom": {"bad": {"pain": 11}}}`, "invalid symptom.bad.pain, expected 0 to 10"},
+		{`{"symptom": {"good": {"nausea": -1}}}`, "invalid symptom.good.nausea, expected 0 to 10"},
+		{`{"symptom": {"awful": {"pain": 10}}}`, "invalid symptom.awful, a new rating must set nausea, fatigue and pain"},
+		{`{"symptom": {"Bad": {"pain": 9}}}`, `invalid symptom rating "Bad", expected a lowercase word`},
+		{`{"sleep": {"well": {"duration": 25}}}`, "invalid sleep.well.duration, expected 0 to 24 hours"},
+		{`{"sleep": {"ok": {"quality": 11}}}`, "invalid sleep.ok.quality, expected 0 to 10"},
+		{`{"sleep": {"great": {"duration": 9}}}`, "invalid sleep.great, a new rating must set duration and quality"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			err := validQuickLogSetting([]byte(tt.value))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadQuickLogPresetsMergesPerField(t *testing.T) {
+	queries := database.New(settingsDB{settings: map[string]string{
+		quickLogSetting: `{"symptom": {"bad": {"pain": 9}, "awful": {"nausea": 10, "fatigue": 10, "pain": 10}}, "sleep": {"well": {"quality": 9}}}`,
+	}})
+	presets, err := loadQuickLogPresets(context.Background(), queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := presets.Symptom["bad"], (symptomPreset{Nausea: 8, Fatigue: 8, Pain: 9}); got != want {
+		t.Errorf("bad = %+v, want %+v", got, want)
+	}
+	if got, want := presets.Symptom["good"], (symptomPreset{Nausea: 1, Fatigue: 1, Pain: 1}); got != want {
+		t.Errorf("good = %+v, want %+v", got, want)
+	}
+	if got, want := presets.Sleep["well"], (sleepPreset{Duration: 8, Quality: 9}); got != want {
+		t.Errorf("well = %+v, want %+v", got, want)
+	}
+	if got, want := ratingWords(symptomRatings, presets.Symptom), "good, ok, bad or awful"; got != want {
+		t.Errorf("symptom words = %q, want %q", got, want)
+	}
+	if got, want := ratingWords(sleepRatings, presets.Sleep), "well, ok or poorly"; got != want {
+		t.Errorf("sleep words = %q, want %q", got, want)
+	}
+}
+
+func TestLoadQuickLogPresetsRejectsStoredBadShape(t *testing.T) {
+	queries := database.New(settingsDB{settings: map[string]string{quickLogSetting: `{"symptom": 5}`}})
+	if _, err := loadQuickLogPresets(context.Background(), queries); err == nil {
+		t.Fatal("expected an error for a malformed stored setting")
+	}
+}
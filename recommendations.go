@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"google.golang.org/genai"
+
+	"terrahack2025-backend/database"
+)
+
+// parseRecommendations decodes the model output into a list of
+// recommendations. The model sometimes wraps the array in a markdown code
+// fence despite the response schema, so fences are stripped first.
+func parseRecommendations(text string) ([]string, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		// Drop the optional language tag after the opening fence
+		if i := strings.Index(text, "\n"); i >= 0 {
+			text = text[i+1:]
+		}
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+		text = strings.TrimSpace(text)
+	}
+
+	var recommendations []string
+	if err := json.Unmarshal([]byte(text), &recommendations); err != nil {
+		return nil, err
+	}
+	if len(recommendations) == 0 {
+		return nil, errors.New("empty recommendation list")
+	}
+	return recommendations, nil
+}
+
+// recommendationInput is everything /recommendations needs once the request
+// has been validated and the user's data analysed
+type recommendationInput struct {
+	Count        int
+	Restrictions []string
+	Data         analysisData
+	Analysis     triggerAnalysis
+	Requirements dataRequirements
+	Prompt       recommendationPrompt
+	// Set for mode=significant, the only triggers the prompt mentions
+	Significant []significantTrigger
+}
+
+// recommendationPrompt is exactly what /recommendations sends to Gemini
+type recommendationPrompt struct {
+	Prompt            string `json:"prompt"`
+	SystemInstruction string `json:"system_instruction"`
+}
+
+func buildRecommendationPrompt(data analysisData, triggers triggerCounts, count int, restrictions []string) recommendationPrompt {
+	prompt := fmt.Sprintf("Be short and concise, and specific. Return an array of %d recommendations to reduce flare-ups based on the following data:", count) + `
+			Sleep Data: ` + fmt.Sprintf("%v", data.Sleep) +
+		`Diet Data: ` + fmt.Sprintf("%v", data.Diet) +
+		`Menstrual Data: ` + fmt.Sprintf("%v", data.Menstrual) +
+		`Symptoms Data: ` + fmt.Sprintf("%v", data.Symptoms) +
+		`Triggers: ` + fmt.Sprintf("%v", triggers)
+	systemInstruction := fmt.Sprintf("Output in the format of a JSON array with %d items. Example: [\"recommendation1\", \"recommendation2\", \"recommendation3\"]. Output only the json array nothing more. Be very short and concise.", count)
+	if notes := recentJournalNotes(data.Journal); notes != "" {
+		prompt += `
+			Journal Notes: ` + notes
+	}
+	if len(restrictions) > 0 {
+		prompt += `
+			Dietary Restrictions: ` + strings.Join(restrictions, ", ")
+		systemInstruction += " Never suggest foods or drinks that conflict with the user's dietary restrictions: " + strings.Join(restrictions, ", ") + "."
+	}
+	return recommendationPrompt{Prompt: prompt, SystemInstruction: systemInstruction}
+}
+
+// buildSignificantRecommendationPrompt is the mode=significant prompt. Unlike
+// the default prompt it carries no raw logs, journal notes or raw trigger
+// counts, only the triggers whose link to spikes passed the significance
+// test, so Gemini can't ground advice in patterns that may be chance.
+func buildSignificantRecommendationPrompt(triggers []significantTrigger, count int, restrictions []string) recommendationPrompt {
+	var lines []string
+	for _, t := range triggers {
+		lines = append(lines, fmt.Sprintf("%s %s: preceded %d symptom spikes, spikes are %.1fx as likely after it (p=%.3f)", t.Type, t.Name, t.Count, t.Lift, t.PValue))
+	}
+	prompt := fmt.Sprintf("Be short and concise, and specific. Return an array of %d recommendations to reduce flare-ups. Base them only on these statistically significant triggers:", count) + `
+			` + strings.Join(lines, "\n")
+	systemInstruction := fmt.Sprintf("Output in the format of a JSON array with %d items. Example: [\"recommendation1\", \"recommendation2\", \"recommendation3\"]. Output only the json array nothing more. Be very short and concise. Only address the triggers listed, never suggest anything else.", count)
+	if len(restrictions) > 0 {
+		prompt += `
+			Dietary Restrictions: ` + strings.Join(restrictions, ", ")
+		systemInstruction += " Never suggest foods or drinks that conflict with the user's dietary restrictions: " + strings.Join(restrictions, ", ") + "."
+	}
+	return recommendationPrompt{Prompt: prompt, SystemInstruction: systemInstruction}
+}
+
+// Answered instead of calling Gemini when mode=significant finds nothing
+const noSignificantTriggersMessage = "None of your triggers are statistically significant yet. Keep logging sleep, diet and symptoms daily so real patterns can be confirmed."
+
+// Only the latest journal entries go into the prompt, older context is
+// rarely relevant and would dominate the token count
+const promptJournalEntries = 14
+
+// recentJournalNotes formats the latest journal entries, which are ordered
+// by date, as "2006-01-02: text" lines
+func recentJournalNotes(journal []database.Journal) string {
+	var lines []string
+	for _, j := range journal[max(0, len(journal)-promptJournalEntries):] {
+		lines = append(lines, j.Date.Time.Format("2006-01-02")+": "+j.Text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// approxTokenCount estimates tokens at roughly four characters each, close
+// enough for cost estimates without calling the CountTokens API
+func approxTokenCount(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// Attached to every AI-generated explanation of the user's data
+const medicalDisclaimer = "These insights are based on patterns in your own logs and are not medical advice. Talk to your doctor before changing your care."
+
+const (
+	defaultRecommendationCount = 3
+	maxRecommendationCount     = 10
+)
+
+// errAIDisabled is returned in place of a Gemini call when the client
+// couldn't be created at startup
+var errAIDisabled = errors.New("AI is disabled on this server")
+
+// blockedReason reports why Gemini withheld its answer, either because the
+// prompt was blocked or because generation stopped for safety, recitation or
+// a similar policy reason. Such responses carry empty or partial text.
+func blockedReason(result *genai.GenerateContentResponse) (string, bool) {
+	if result.PromptFeedback != nil && result.PromptFeedback.BlockReason != "" {
+		return string(result.PromptFeedback.BlockReason), true
+	}
+	if len(result.Candidates) == 0 {
+		return "", false
+	}
+	switch reason := result.Candidates[0].FinishReason; reason {
+	case "", genai.FinishReasonUnspecified, genai.FinishReasonStop, genai.FinishReasonMaxTokens:
+		return "", false
+	default:
+		return string(reason), true
+	}
+}
+
+// generateRecommendations asks Gemini for in.Count recommendations, falling
+// back to the rule-based ones when the output can't be parsed
+func generateRecommendations(ctx context.Context, client *genai.Client, in recommendationInput) ([]string, error) {
+	if client == nil {
+		return nil, errAIDisabled
+	}
+	count := in.Count
+	temp := float32(1)
+	itemCount := int64(count)
+	config := &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(in.Prompt.SystemInstruction, genai.RoleUser),
+		Temperature:       &temp,
+		MaxOutputTokens:   int32(max(200, 70*count)),
+		ResponseMIMEType:  "application/json",
+		ResponseSchema: &genai.Schema{
+			Type:     genai.TypeArray,
+			MinItems: &itemCount,
+			MaxItems: &itemCount,
+			Items: &genai.Schema{
+				Type: genai.TypeString,
+			},
+		},
+	}
+
+	// The model occasionally returns fewer items than asked for, so retry once before settling
+	var recommendations []string
+	for attempt := 0; attempt < 2 && len(recommendations) < count; attempt++ {
+		genCtx, span := tracer.Start(ctx, "gemini.GenerateContent")
+		geminiCalls.Add(1)
+		result, err := client.Models.GenerateContent(genCtx, "gemini-2.5-flash-lite", genai.Text(in.Prompt.Prompt), config)
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+
+		// A failed retry keeps what the first attempt returned
+		if err != nil && len(recommendations) > 0 {
+			slog.Warn("Gemini retry failed, keeping the first attempt", "error", err)
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// A blocked answer would be blocked again, so go straight to the fallback
+		if reason, blocked := blockedReason(result); blocked {
+			slog.Warn("Gemini withheld recommendations", "finish_reason", reason)
+			break
+		}
+		if len(result.Candidates) == 0 {
+			if len(recommendations) > 0 {
+				break
+			}
+			return nil, errors.New("No recommendations generated")
+		}
+		slog.Debug("Gemini recommendations generated", "finish_reason", result.Candidates[0].FinishReason)
+
+		parsed, err := parseRecommendations(result.Text())
+		if err != nil {
+			slog.Warn("unparseable recommendations from Gemini", "error", err)
+			continue
+		}
+		parsed = filterRestricted(parsed, in.Restrictions)
+		if len(parsed) > len(recommendations) {
+			recommendations = parsed
+		}
+	}
+
+	if len(recommendations) == 0 {
+		triggers := in.Analysis.Triggers
+		if in.Significant != nil {
+			triggers = significantCounts(triggers, in.Significant)
+		}
+		recommendations = fallbackRecommendations(triggers, count, in.Restrictions)
+	}
+	if len(recommendations) > count {
+		recommendations = recommendations[:count]
+	}
+	return recommendations, nil
+}
+
+// fallbackRecommendations builds up to count rule-based recommendations from
+// the detected triggers for when the model output can't be used. Generic
+// suggestions that conflict with the user's dietary restrictions are skipped.
+func fallbackRecommendations(triggers triggerCounts, count int, restrictions []string) []string {
+	var recommendations []string
+
+	if triggers.LowSleepHours > 0 {
+		recommendations = append(recommendations, "Aim for at least 6 hours of sleep, short nights often precede your flare-ups")
+	}
+
+	if food := mostFrequent(triggers.FoodItems); food != "" {
+		recommendations = append(recommendations, fmt.Sprintf("Try limiting %s, it often appears the day before a flare-up", food))
+	}
+
+	if event := mostFrequent(triggers.MenstrualEvent); event != "" {
+		recommendations = append(recommendations, fmt.Sprintf("Plan for extra rest around your period %s, symptoms tend to rise then", event))
+	}
+
+	generic := []string{
+		"Keep logging symptoms daily to improve trigger detection",
+		"Stay hydrated throughout the day",
+		"Favour anti-inflammatory foods like leafy greens and oily fish",
+		"Try gentle movement such as walking or stretching on good days",
+		"Use a heat pad to ease cramping pain",
+		"Keep a consistent bedtime, even on weekends",
+		"Eat smaller, more frequent meals when nausea is high",
+		"Practice a short relaxation routine to manage stress",
+		"Limit caffeine and alcohol, especially in the evening",
+		"Share your symptom log with your doctor at your next visit",
+	}
+	for _, g := range generic {
+		if respectsRestrictions(g, restrictions) {
+			recommendations = append(recommendations, g)
+		}
+	}
+
+	if len(recommendations) > count {
+		recommendations = recommendations[:count]
+	}
+	return recommendations
+}
+
+// mostFrequent returns the key with the highest count, breaking ties alphabetically
+func mostFrequent(counts map[string]int) string {
+	var keys []string
+	for k := range counts {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys[0]
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestParseRecommendations(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []string
+		wantErr bool
+	}{
+		{"plain array", `["a", "b"]`, []string{"a", "b"}, false},
+		{"surrounding whitespace", "\n  [\"a\"]  \n", []string{"a"}, false},
+		{"fenced with language", "```json\n[\"a\", \"b\"]\n```", []string{"a", "b"}, false},
+		{"fenced without language", "```\n[\"a\"]\n```", []string{"a"}, false},
+		{"truncated array", `["a", "b`, nil, true},
+		{"unterminated fence", "```json\n[\"a\",", nil, true},
+		{"object instead of array", `{"recommendations": ["a"]}`, nil, true},
+		{"prose", "Here are some recommendations: sleep more", nil, true},
+		{"empty array", `[]`, nil, true},
+		{"empty text", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRecommendations(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRecommendations(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRecommendations(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFallbackRecommendations(t *testing.T) {
+	triggers := triggerCounts{
+		LowSleepHours:  2,
+		MenstrualEvent: map[string]int{"start": 1},
+		FoodItems:      map[string]int{"coffee": 3, "bread": 1},
+	}
+
+	got := fallbackRecommendations(triggers, 3, nil)
+	want := []string{
+		"Aim for at least 6 hours of sleep, short nights often precede your flare-ups",
+		"Try limiting coffee, it often appears the day before a flare-up",
+		"Plan for extra rest around your period start, symptoms tend to rise then",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fallbackRecommendations() = %q, want %q", got, want)
+	}
+}
+
+func TestFallbackRecommendationsFillsWithGeneric(t *testing.T) {
+	got := fallbackRecommendations(triggerCounts{}, 5, nil)
+	if len(got) != 5 {
+		t.Fatalf("got %d recommendations, want 5", len(got))
+	}
+	if got[0] != "Keep logging symptoms daily to improve trigger detection" {
+		t.Errorf("first recommendation = %q, want the first generic one", got[0])
+	}
+}
+
+func TestFallbackRecommendationsTieBreak(t *testing.T) {
+	triggers := triggerCounts{FoodItems: map[string]int{"milk": 2, "bread": 2}}
+	got := fallbackRecommendations(triggers, 1, nil)
+	if len(got) != 1 || !strings.Contains(got[0], "bread") {
+		t.Errorf("fallbackRecommendations() = %q, want the alphabetically first food on a tie", got)
+	}
+}
+
+func TestBlockedReason(t *testing.T) {
+	finished := func(reason genai.FinishReason) *genai.GenerateContentResponse {
+		return &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{FinishReason: reason}}}
+	}
+	tests := []struct {
+		name        string
+		result      *genai.GenerateContentResponse
+		wantReason  string
+		wantBlocked bool
+	}{
+		{"stop", finished(genai.FinishReasonStop), "", false},
+		{"max tokens", finished(genai.FinishReasonMaxTokens), "", false},
+		{"unspecified", finished(genai.FinishReasonUnspecified), "", false},
+		{"no finish reason", finished(""), "", false},
+		{"no candidates", &genai.GenerateContentResponse{}, "", false},
+		{"safety", finished(genai.FinishReasonSafety), "SAFETY", true},
+		{"recitation", finished(genai.FinishReasonRecitation), "RECITATION", true},
+		{"blocklist", finished(genai.FinishReasonBlocklist), "BLOCKLIST", true},
+		{"prohibited content", finished(genai.FinishReasonProhibitedContent), "PROHIBITED_CONTENT", true},
+		{"other", finished(genai.FinishReasonOther), "OTHER", true},
+		{
+			"blocked prompt",
+			&genai.GenerateContentResponse{PromptFeedback: &genai.GenerateContentResponsePromptFeedback{BlockReason: genai.BlockedReasonSafety}},
+			"SAFETY",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, blocked := blockedReason(tt.result)
+			if reason != tt.wantReason || blocked != tt.wantBlocked {
+				t.Errorf("blockedReason() = %q, %v, want %q, %v", reason, blocked, tt.wantReason, tt.wantBlocked)
+			}
+		})
+	}
+}
+
+// testGeminiClient is a client whose every GenerateContent call is answered
+// with body
+func testGeminiClient(t *testing.T, body string) *genai.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestGenerateRecommendationsBlockedUsesFallback(t *testing.T) {
+	in := recommendationInput{
+		Count:    2,
+		Analysis: triggerAnalysis{triggerSet: triggerSet{Triggers: triggerCounts{LowSleepHours: 1}}},
+	}
+	want := fallbackRecommendations(in.Analysis.Triggers, in.Count, nil)
+	tests := map[string]string{
+		"safety":         `{"candidates": [{"finishReason": "SAFETY", "content": {"parts": [{"text": "[\"partial"}]}}]}`,
+		"recitation":     `{"candidates": [{"finishReason": "RECITATION"}]}`,
+		"blocked prompt": `{"promptFeedback": {"blockReason": "PROHIBITED_CONTENT"}}`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := generateRecommendations(context.Background(), testGeminiClient(t, body), in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("generateRecommendations() = %q, want the fallback %q", got, want)
+			}
+		})
+	}
+}
+
+func TestGenerateRecommendationsUsesModelOutput(t *testing.T) {
+	body := `{"candidates": [{"finishReason": "STOP", "content": {"parts": [{"text": "[\"Sleep more\", \"Drink water\"]"}]}}]}`
+	got, err := generateRecommendations(context.Background(), testGeminiClient(t, body), recommendationInput{Count: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Sleep more", "Drink water"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("generateRecommendations() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dietaryRestrictions maps each supported restriction to the words that mark
+// a recommendation as conflicting with it
+var dietaryRestrictions = map[string][]string{
+	"vegan":        {"meat", "chicken", "beef", "pork", "fish", "seafood", "shellfish", "egg", "dairy", "milk", "cheese", "yogurt", "honey"},
+	"vegetarian":   {"meat", "chicken", "beef", "pork", "fish", "seafood", "shellfish"},
+	"pescatarian":  {"meat", "chicken", "beef", "pork"},
+	"gluten-free":  {"gluten", "wheat", "barley", "rye", "bread", "pasta"},
+	"dairy-free":   {"dairy", "milk", "cheese", "yogurt", "butter", "cream"},
+	"lactose-free": {"dairy", "milk", "cheese", "yogurt", "cream"},
+	"nut-free":     {"nut", "peanut", "almond", "walnut", "cashew"},
+	"halal":        {"pork"},
+	"kosher":       {"pork", "shellfish"},
+	"low-fodmap":   {"onion", "garlic", "bean", "lentil", "wheat"},
+}
+
+// parseRestrictions normalizes restriction names and rejects unknown ones.
+// Duplicates and empty entries are dropped.
+func parseRestrictions(values []string) ([]string, error) {
+	seen := map[string]bool{}
+	var restrictions []string
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" || seen[v] {
+			continue
+		}
+		if _, ok := dietaryRestrictions[v]; !ok {
+			return nil, fmt.Errorf("invalid restriction %q, expected one of %s", v, strings.Join(knownRestrictions(), ", "))
+		}
+		seen[v] = true
+		restrictions = append(restrictions, v)
+	}
+	return restrictions, nil
+}
+
+func knownRestrictions() []string {
+	var names []string
+	for name := range dietaryRestrictions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// respectsRestrictions reports whether a recommendation avoids every word
+// that conflicts with the given restrictions
+func respectsRestrictions(recommendation string, restrictions []string) bool {
+	for _, r := range restrictions {
+		if containsKeyword([]string{recommendation}, dietaryRestrictions[r]) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterRestricted drops the recommendations that conflict with the given
+// restrictions, for model output that ignored the system instruction
+func filterRestricted(recommendations []string, restrictions []string) []string {
+	var kept []string
+	for _, r := range recommendations {
+		if respectsRestrictions(r, restrictions) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
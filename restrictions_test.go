@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterRestricted(t *testing.T) {
+	recommendations := []string{
+		"Add Greek yogurt to breakfast for probiotics",
+		"Stay hydrated throughout the day",
+		"Swap white bread for oats",
+		"Eat more grilled chicken",
+	}
+	tests := []struct {
+		restrictions []string
+		want         []string
+	}{
+		{nil, recommendations},
+		{[]string{"vegan"}, []string{recommendations[1], recommendations[2]}},
+		{[]string{"lactose-free"}, []string{recommendations[1], recommendations[2], recommendations[3]}},
+		{[]string{"vegetarian", "gluten-free"}, []string{recommendations[0], recommendations[1]}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.restrictions, ","), func(t *testing.T) {
+			if got := filterRestricted(recommendations, tt.restrictions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterRestricted(%v) = %q, want %q", tt.restrictions, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFallbackRecommendationsRespectsRestrictions(t *testing.T) {
+	const fish = "Favour anti-inflammatory foods like leafy greens and oily fish"
+	contains := func(recommendations []string, want string) bool {
+		for _, r := range recommendations {
+			if r == want {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !contains(fallbackRecommendations(triggerCounts{}, maxRecommendationCount, nil), fish) {
+		t.Fatalf("unrestricted fallback is missing %q", fish)
+	}
+	for _, restriction := range []string{"vegan", "vegetarian"} {
+		got := fallbackRecommendations(triggerCounts{}, maxRecommendationCount, []string{restriction})
+		if contains(got, fish) {
+			t.Errorf("%s fallback includes %q", restriction, fish)
+		}
+	}
+}
+
+func TestRecommendationPromptIncludesRestrictions(t *testing.T) {
+	prompt := buildRecommendationPrompt(analysisData{}, triggerCounts{}, 3, []string{"vegan", "nut-free"})
+	for _, s := range []string{prompt.Prompt, prompt.SystemInstruction} {
+		if !strings.Contains(s, "vegan, nut-free") {
+			t.Errorf("prompt %q is missing the restrictions", s)
+		}
+	}
+}
+
+func TestParseRestrictions(t *testing.T) {
+	got, err := parseRestrictions([]string{" Vegan", "", "vegan", "gluten-free"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"vegan", "gluten-free"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRestrictions() = %q, want %q", got, want)
+	}
+	if _, err := parseRestrictions([]string{"keto"}); err == nil {
+		t.Error("parseRestrictions accepted an unknown restriction")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"terrahack2025-backend/database"
+)
+
+// Records older than the "retention" setting are purged, e.g.
+//
+//	{"keep_days": 730}
+//
+// keeps two years. Without the setting everything is kept forever.
+const retentionSetting = "retention"
+
+const (
+	retentionPurgeInterval = 24 * time.Hour
+
+	// A short window is more likely a mistake than a wish to lose the history
+	minRetentionDays = 30
+)
+
+var errRetentionDisabled = errors.New("no retention setting, all data is kept forever. Set retention to {\"keep_days\": n} to enable purging")
+
+type retentionConfig struct {
+	KeepDays *int `json:"keep_days"`
+}
+
+func (r retentionConfig) validate() error {
+	if r.KeepDays == nil || *r.KeepDays < minRetentionDays {
+		return errors.New("invalid keep_days, expected at least 30")
+	}
+	return nil
+}
+
+// validRetentionSetting checks a value for the retention setting before it
+// is stored
+func validRetentionSetting(value []byte) error {
+	var r retentionConfig
+	if err := json.Unmarshal(value, &r); err != nil {
+		return errors.New("retention must be an object with keep_days")
+	}
+	return r.validate()
+}
+
+// loadRetentionConfig returns errRetentionDisabled when the setting is
+// missing
+func loadRetentionConfig(ctx context.Context, queries *database.Queries) (retentionConfig, error) {
+	var r retentionConfig
+	if err := loadSetting(ctx, queries, retentionSetting, &r); err != nil {
+		return r, err
+	}
+	if r.KeepDays == nil {
+		return r, errRetentionDisabled
+	}
+	return r, nil
+}
+
+// cutoff is the first date kept when today is the user's current date
+func (r retentionConfig) cutoff(today time.Time) time.Time {
+	return today.AddDate(0, 0, -*r.KeepDays)
+}
+
+type purgeReport struct {
+	KeepDays int       `json:"keep_days"`
+	Cutoff   time.Time `json:"cutoff"`
+	// Rows deleted per domain, soft-deleted ones included
+	Purged map[string]int64 `json:"purged"`
+}
+
+// purgeBefore deletes every record dated before cutoff, along with the
+// version history of the deleted records. queries should be bound to a
+// transaction so a failure leaves nothing half purged.
+func purgeBefore(ctx context.Context, queries *database.Queries, cutoff time.Time) (map[string]int64, error) {
+	date := pgtype.Date{Time: cutoff, Valid: true}
+	domains := []struct {
+		name  string
+		purge func(context.Context, pgtype.Date) (int64, error)
+	}{
+		{"sleep", queries.PurgeSleepBefore},
+		{"diet", queries.PurgeDietBefore},
+		{"menstrual", queries.PurgeMenstrualBefore},
+		{"symptoms", queries.PurgeSymptomsBefore},
+		{"journal", queries.PurgeJournalBefore},
+		{"custom_factors", queries.PurgeCustomFactorsBefore},
+	}
+	purged := map[string]int64{}
+	for _, d := range domains {
+		n, err := d.purge(ctx, date)
+		if err != nil {
+			return nil, err
+		}
+		purged[d.name] = n
+	}
+	n, err := queries.PurgeOrphanedRecordVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	purged["record_versions"] = n
+	return purged, nil
+}
+
+// runRetentionPurge purges the records outside the retention window with
+// today as the user's current date. It returns errRetentionDisabled, and
+// deletes nothing, when no retention is set.
+func runRetentionPurge(ctx context.Context, pool *pgxpool.Pool, today time.Time) (purgeReport, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return purgeReport{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	queries := database.New(pool).WithTx(tx)
+	cfg, err := loadRetentionConfig(ctx, queries)
+	if err != nil {
+		return purgeReport{}, err
+	}
+	report := purgeReport{KeepDays: *cfg.KeepDays, Cutoff: cfg.cutoff(today)}
+	if report.Purged, err = purgeBefore(ctx, queries, report.Cutoff); err != nil {
+		return purgeReport{}, err
+	}
+	return report, tx.Commit(ctx)
+}
+
+// startRetentionPurge purges expired records once a day, dating today by
+// the timezone setting
+func startRetentionPurge(ctx context.Context, pool *pgxpool.Pool) {
+	go func() {
+		ticker := time.NewTicker(retentionPurgeInterval)
+		defer ticker.Stop()
+		for {
+			if err := purgeExpired(ctx, pool); err != nil {
+				slog.Error("retention purge failed", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func purgeExpired(ctx context.Context, pool *pgxpool.Pool) error {
+	var tz string
+	if err := loadSetting(ctx, database.New(pool), timezoneSetting, &tz); err != nil {
+		return err
+	}
+	loc := time.UTC
+	if tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return err
+		}
+	}
+	report, err := runRetentionPurge(ctx, pool, dateIn(time.Now(), loc))
+	if errors.Is(err, errRetentionDisabled) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("retention purge finished", "cutoff", report.Cutoff.Format("2006-01-02"), "purged", report.Purged)
+	return nil
+}
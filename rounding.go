@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Decimal places computed numbers are rounded to in analytics responses,
+// overridable per request with precision=0..10
+const (
+	defaultOutputPrecision = 2
+	maxOutputPrecision     = 10
+)
+
+func roundTo(v float64, places int) float64 {
+	// Beyond this a float64 has no fractional digits left to round
+	if math.Abs(v) >= 1e15 {
+		return v
+	}
+	scale := math.Pow(10, float64(places))
+	r := math.Round(v*scale) / scale
+	if r == 0 {
+		return 0 // not -0
+	}
+	return r
+}
+
+// roundJSONNumbers rounds every non-integer number in encoded JSON to the
+// given decimal places. Integers and strings are copied unchanged, as is the
+// key order, so it can post-process any encoding/json output.
+func roundJSONNumbers(b []byte, places int) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); {
+		switch ch := b[i]; {
+		case ch == '"':
+			j := i + 1
+			for j < len(b) && b[j] != '"' {
+				if b[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			out = append(out, b[i:min(j+1, len(b))]...)
+			i = j + 1
+		case ch == '-' || (ch >= '0' && ch <= '9'):
+			j := i
+			for j < len(b) && strings.IndexByte("+-0123456789.eE", b[j]) >= 0 {
+				j++
+			}
+			num := b[i:j]
+			if strings.ContainsAny(string(num), ".eE") {
+				if f, err := strconv.ParseFloat(string(num), 64); err == nil {
+					num = strconv.AppendFloat(nil, roundTo(f, places), 'f', -1, 64)
+				}
+			}
+			out = append(out, num...)
+			i = j
+		default:
+			out = append(out, ch)
+			i++
+		}
+	}
+	return out
+}
+
+// respondRounded writes v as JSON with computed numbers rounded for
+// display. Only the response is rounded, never stored data, so it is meant
+// for analytics results rather than raw records. The Accept header may ask
+// for CSV instead, see respondAnalytics.
+func respondRounded(c *gin.Context, v any) {
+	format, ok := negotiateAnalytics(c)
+	if !ok {
+		return
+	}
+	places := defaultOutputPrecision
+	if p := c.Query("precision"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > maxOutputPrecision {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid precision, expected an integer between 0 and 10"})
+			return
+		}
+		places = n
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeAnalytics(c, format, roundJSONNumbers(b, places))
+}
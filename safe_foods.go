@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+const defaultSafeFoodMinOccurrences = 5
+
+type safeFood struct {
+	Item string `json:"item"`
+	// Days the food was logged and the following day was scored
+	DaysEaten int `json:"days_eaten"`
+	// Of those, how many next days were symptom spikes
+	SpikesAfter int `json:"spikes_after"`
+	// Of those, how many next days scored at or below the user's average
+	LowSymptomDaysAfter int     `json:"low_symptom_days_after"`
+	SpikeRate           float64 `json:"spike_rate"`
+	Lift                float64 `json:"lift"`
+}
+
+// safeFoods is the flip side of trigger detection. It returns foods eaten at
+// least minOccurrences times whose lift is below 1, meaning spikes are less
+// likely after them than on an average day, and which were mostly followed
+// by low-symptom days. The safest foods come first.
+func (a triggerAnalysis) safeFoods(minOccurrences int) []safeFood {
+	_, lifts := a.lifts()
+
+	lowDaysAfter := map[string]int{}
+	for i := 1; i < len(a.ScoredDays); i++ {
+		d := a.ScoredDays[i]
+		if d.Score > a.Mean {
+			continue
+		}
+		for factor := range a.ByDate.factors(d.Date.AddDate(0, 0, -1).Format("2006-01-02")) {
+			lowDaysAfter[factor]++
+		}
+	}
+
+	var foods []safeFood
+	for factor, l := range lifts {
+		item, ok := strings.CutPrefix(factor, "food:")
+		if !ok || l.DaysPresent < minOccurrences || l.Lift >= 1 {
+			continue
+		}
+		if 2*lowDaysAfter[factor] < l.DaysPresent {
+			continue
+		}
+		foods = append(foods, safeFood{
+			Item:                item,
+			DaysEaten:           l.DaysPresent,
+			SpikesAfter:         l.Spikes,
+			LowSymptomDaysAfter: lowDaysAfter[factor],
+			SpikeRate:           float64(l.Spikes) / float64(l.DaysPresent),
+			Lift:                l.Lift,
+		})
+	}
+
+	sort.Slice(foods, func(i, j int) bool {
+		if foods[i].Lift != foods[j].Lift {
+			return foods[i].Lift < foods[j].Lift
+		}
+		if foods[i].DaysEaten != foods[j].DaysEaten {
+			return foods[i].DaysEaten > foods[j].DaysEaten
+		}
+		return foods[i].Item < foods[j].Item
+	})
+	return foods
+}
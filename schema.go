@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// jsonSchema is the subset of JSON Schema the insert payloads use: type
+// (one name or a list), required, properties, additionalProperties: false,
+// items, enum, minimum, maximum and maxLength. Object and array keywords
+// only apply when the value has that type.
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []string               `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MaxLength            *int                   `json:"maxLength"`
+}
+
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = schemaTypes{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// requestSchemas maps a route to the schema its JSON body must match,
+// loaded from schemas/<route>.json
+var requestSchemas = loadRequestSchemas(
+	"/insert_sleep",
+	"/insert_diet",
+	"/insert_menstrual",
+	"/insert_symptoms",
+	"/insert_custom_factor",
+	"/insert_journal",
+)
+
+func loadRequestSchemas(routes ...string) map[string]*jsonSchema {
+	schemas := map[string]*jsonSchema{}
+	for _, route := range routes {
+		b, err := schemaFiles.ReadFile("schemas/" + strings.TrimPrefix(route, "/") + ".json")
+		if err != nil {
+			log.Fatalf("Missing request schema for %s: %v", route, err)
+		}
+		var s jsonSchema
+		if err := json.Unmarshal(b, &s); err != nil {
+			log.Fatalf("Invalid request schema for %s: %v", route, err)
+		}
+		schemas[route] = &s
+	}
+	return schemas
+}
+
+// validateRequestSchema rejects a body that doesn't match its route's
+// schema before the handler binds it, responding 400 in the bindJSON shape
+// with every problem found, unknown fields included. Routes without a
+// schema pass through.
+func validateRequestSchema() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		schema, ok := requestSchemas[c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// The handler still binds the body itself
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		if errs := schema.validateBody(body); len(errs) > 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":  "invalid request body",
+				"errors": errs,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// validateBody checks an encoded JSON body against s
+func (s *jsonSchema) validateBody(body []byte) []fieldError {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return []fieldError{{Message: "malformed JSON"}}
+	}
+	return s.validate("", v)
+}
+
+// validate checks v against s, naming fields by their path from the body
+// root, e.g. "items[1].quantity"
+func (s *jsonSchema) validate(path string, v any) []fieldError {
+	fail := func(format string, args ...any) []fieldError {
+		return []fieldError{{Field: path, Message: fmt.Sprintf(format, args...)}}
+	}
+	if len(s.Type) > 0 && !s.Type.match(v) {
+		return fail("must be %s", s.Type.describe())
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		var errs []fieldError
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs = append(errs, fieldError{Field: joinPath(path, name), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					errs = append(errs, fieldError{Field: joinPath(path, name), Message: "is not an allowed field"})
+				}
+				continue
+			}
+			errs = append(errs, prop.validate(joinPath(path, name), v[name])...)
+		}
+		return errs
+	case []any:
+		if s.Items == nil {
+			return nil
+		}
+		var errs []fieldError
+		for i, item := range v {
+			errs = append(errs, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+		return errs
+	case string:
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, v) {
+			return fail("must be one of %s", strings.Join(s.Enum, ", "))
+		}
+		if s.MaxLength != nil && len([]rune(v)) > *s.MaxLength {
+			return fail("must be at most %d characters", *s.MaxLength)
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			return fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return fail("must be at most %v", *s.Maximum)
+		}
+	}
+	return nil
+}
+
+func (t schemaTypes) match(v any) bool {
+	for _, name := range t {
+		switch x := v.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case json.Number:
+			if name == "number" {
+				return true
+			}
+			if name == "integer" {
+				n, err := x.Float64()
+				if err == nil && n == math.Trunc(n) {
+					return true
+				}
+			}
+		case []any:
+			if name == "array" {
+				return true
+			}
+		case map[string]any:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describe names the allowed types the way bindJSON's messages do
+func (t schemaTypes) describe() string {
+	var names []string
+	for _, name := range t {
+		switch name {
+		case "integer", "array", "object":
+			names = append(names, "an "+name)
+		case "null":
+			names = append(names, "null")
+		default:
+			names = append(names, "a "+name)
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
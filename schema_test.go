@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		route string
+		body  string
+		want  []fieldError
+	}{
+		{
+			name:  "valid",
+			route: "/insert_sleep",
+			body:  `{"date": "2025-07-19T08:00:00Z", "duration": 7.5, "quality": 6}`,
+		},
+		{
+			name:  "null optional strings",
+			route: "/insert_sleep",
+			body:  `{"date": "2025-07-19T08:00:00Z", "notes": null, "disruptions": null, "source": null}`,
+		},
+		{
+			name:  "null meal and items",
+			route: "/insert_diet",
+			body:  `{"date": "2025-07-19T08:00:00Z", "meal": null, "items": null, "notes": null}`,
+		},
+		{
+			name:  "null menstrual fields",
+			route: "/insert_menstrual",
+			body:  `{"date": "2025-07-19T08:00:00Z", "period_event": null, "flow_level": null}`,
+		},
+		{
+			name:  "unknown fields",
+			route: "/insert_sleep",
+			body:  `{"date": "2025-07-19T08:00:00Z", "hours": 7, "mood": "ok"}`,
+			want: []fieldError{
+				{Field: "hours", Message: "is not an allowed field"},
+				{Field: "mood", Message: "is not an allowed field"},
+			},
+		},
+		{
+			name:  "unknown nested field",
+			route: "/insert_diet",
+			body:  `{"date": "2025-07-19T08:00:00Z", "items": [{"name": "rice", "grams": 10}]}`,
+			want:  []fieldError{{Field: "items[0].grams", Message: "is not an allowed field"}},
+		},
+		{
+			name:  "type mismatches",
+			route: "/insert_sleep",
+			body:  `{"date": 20250719, "duration": "7", "quality": 6.5, "notes": ["a"]}`,
+			want: []fieldError{
+				{Field: "date", Message: "must be a string"},
+				{Field: "duration", Message: "must be a number or null"},
+				{Field: "notes", Message: "must be a string or null"},
+				{Field: "quality", Message: "must be an integer or null"},
+			},
+		},
+		{
+			name:  "item type mismatch",
+			route: "/insert_diet",
+			body:  `{"date": "2025-07-19T08:00:00Z", "items": ["rice", 3]}`,
+			want:  []fieldError{{Field: "items[1]", Message: "must be a string or an object"}},
+		},
+		{
+			name:  "missing required and out of range",
+			route: "/insert_symptoms",
+			body:  `{"pain": 11}`,
+			want: []fieldError{
+				{Field: "date", Message: "is required"},
+				{Field: "pain", Message: "must be at most 10"},
+			},
+		},
+		{
+			name:  "enum",
+			route: "/insert_symptoms",
+			body:  `{"date": "2025-07-19T08:00:00Z", "pain": 3, "source": "fax"}`,
+			want:  []fieldError{{Field: "source", Message: "must be one of manual, import, nlp"}},
+		},
+		{
+			name:  "not an object",
+			route: "/insert_journal",
+			body:  `[]`,
+			want:  []fieldError{{Message: "must be an object"}},
+		},
+		{
+			name:  "malformed",
+			route: "/insert_journal",
+			body:  `{"date": `,
+			want:  []fieldError{{Message: "malformed JSON"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := requestSchemas[tt.route].validateBody([]byte(tt.body))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateBody(%s) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// envOrFile reads name from the file at name_FILE when that is set, for
+// deploys that mount secrets as files, and from name itself otherwise.
+// A _FILE variant that can't be read is fatal rather than silently ignored.
+func envOrFile(name string) string {
+	v, err := readEnvOrFile(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return v
+}
+
+// readEnvOrFile is envOrFile returning the read error instead
+func readEnvOrFile(name string) (string, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return os.Getenv(name), nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read %s_FILE: %w", name, err)
+	}
+	// Mounted secrets usually end with a newline
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadEnvOrFile(t *testing.T) {
+	dir := t.TempDir()
+	secret := func(content string) string {
+		path := filepath.Join(dir, "secret")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name string
+		env  string
+		file string // written and set as TEST_SECRET_FILE when not empty
+		want string
+	}{
+		{"env only", "from-env", "", "from-env"},
+		{"neither", "", "", ""},
+		{"file takes precedence", "from-env", "from-file", "from-file"},
+		{"trailing newline trimmed", "", "from-file\n", "from-file"},
+		{"trailing CRLF trimmed", "", "from-file\r\n", "from-file"},
+		{"inner whitespace kept", "", "  two words \n", "  two words "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_SECRET", tt.env)
+			t.Setenv("TEST_SECRET_FILE", "")
+			if tt.file != "" {
+				t.Setenv("TEST_SECRET_FILE", secret(tt.file))
+			}
+			got, err := readEnvOrFile("TEST_SECRET")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("readEnvOrFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadEnvOrFileUnreadable(t *testing.T) {
+	t.Setenv("TEST_SECRET", "from-env")
+	t.Setenv("TEST_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	// An unreadable file is an error, not a silent fall back to the env var
+	got, err := readEnvOrFile("TEST_SECRET")
+	if err == nil {
+		t.Fatalf("readEnvOrFile() = %q, want an error", got)
+	}
+	if !strings.HasPrefix(err.Error(), "Unable to read TEST_SECRET_FILE: ") {
+		t.Errorf("error = %q", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"terrahack2025-backend/database"
+)
+
+// seedConfig tunes the demo data generated by POST /seed. The trigger fields
+// inject a known pattern: eating TriggerFood (with TriggerProbability per day)
+// raises the next day's symptoms by TriggerEffect, so tests can check that
+// /find_triggers picks it up.
+type seedConfig struct {
+	Days               int     `json:"days"`
+	Seed               uint64  `json:"seed"`
+	TriggerFood        string  `json:"trigger_food"`
+	TriggerProbability float64 `json:"trigger_probability"`
+	TriggerEffect      float64 `json:"trigger_effect"`
+	LowSleepEffect     float64 `json:"low_sleep_effect"`
+}
+
+func defaultSeedConfig() seedConfig {
+	return seedConfig{
+		Days:               60,
+		Seed:               1,
+		TriggerFood:        "dairy",
+		TriggerProbability: 0.25,
+		TriggerEffect:      4,
+		LowSleepEffect:     2,
+	}
+}
+
+type seedData struct {
+	Sleep     []database.InsertSleepParams
+	Diet      []database.InsertDietParams
+	Menstrual []database.InsertMenstrualParams
+	Symptoms  []database.InsertSymptomsParams
+}
+
+var seedMeals = map[string][]string{
+	"breakfast": {"oatmeal", "toast", "eggs", "banana", "coffee", "yogurt", "granola"},
+	"lunch":     {"salad", "chicken", "rice", "soup", "sandwich", "apple", "lentils"},
+	"dinner":    {"salmon", "pasta", "broccoli", "potatoes", "tofu", "steak", "quinoa"},
+}
+
+// generateSeedData builds cfg.Days days of correlated records ending on end,
+// following a 28 day cycle with a 5 day period
+func generateSeedData(cfg seedConfig, end time.Time) seedData {
+	rng := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+	var data seedData
+
+	text := func(s string) pgtype.Text { return pgtype.Text{String: s, Valid: true} }
+	clampScore := func(v float64) pgtype.Int4 {
+		return pgtype.Int4{Int32: int32(math.Max(1, math.Min(10, math.Round(v)))), Valid: true}
+	}
+
+	start := end.AddDate(0, 0, -(cfg.Days - 1))
+	var prevTrigger, prevLowSleep bool
+	for i := 0; i < cfg.Days; i++ {
+		day := start.AddDate(0, 0, i)
+		date := pgtype.Date{Time: day, Valid: true}
+		cycleDay := i % 28
+
+		duration := math.Round((7+rng.NormFloat64())*10) / 10
+		if rng.Float64() < 0.2 {
+			duration = math.Round((4.5+rng.Float64())*10) / 10
+		}
+		data.Sleep = append(data.Sleep, database.InsertSleepParams{
+			Date:        date,
+			Duration:    pgtype.Float8{Float64: duration, Valid: true},
+			Quality:     clampScore(duration + rng.NormFloat64()),
+			Disruptions: text(""),
+			Notes:       text("seed"),
+		})
+
+		ateTrigger := cfg.TriggerFood != "" && rng.Float64() < cfg.TriggerProbability
+		for _, meal := range []string{"breakfast", "lunch", "dinner"} {
+			options := seedMeals[meal]
+			items := []string{options[rng.IntN(len(options))], options[rng.IntN(len(options))]}
+			if ateTrigger && meal == "dinner" {
+				items = append(items, normalizeItem(cfg.TriggerFood))
+			}
+			items = normalizeItems(items)
+			caffeine, alcohol := dietFlags(items)
+			data.Diet = append(data.Diet, database.InsertDietParams{
+				Meal:             text(meal),
+				Date:             date,
+				Items:            items,
+				Notes:            text("seed"),
+				ContainsCaffeine: caffeine,
+				ContainsAlcohol:  alcohol,
+			})
+		}
+
+		periodBoost := 0.0
+		if cycleDay < 5 {
+			flow := []string{"heavy", "heavy", "medium", "medium", "light"}[cycleDay]
+			event := "ongoing"
+			switch cycleDay {
+			case 0:
+				event = "start"
+			case 4:
+				event = "end"
+			}
+			data.Menstrual = append(data.Menstrual, database.InsertMenstrualParams{
+				PeriodEvent: text(event),
+				Date:        date,
+				FlowLevel:   text(flow),
+				Notes:       text("seed"),
+			})
+			periodBoost = 1.5
+		}
+
+		base := 2.5 + periodBoost
+		if prevTrigger {
+			base += cfg.TriggerEffect
+		}
+		if prevLowSleep {
+			base += cfg.LowSleepEffect
+		}
+		data.Symptoms = append(data.Symptoms, database.InsertSymptomsParams{
+			Date:    date,
+			Nausea:  clampScore(base + rng.NormFloat64()),
+			Fatigue: clampScore(base + rng.NormFloat64()),
+			Pain:    clampScore(base + rng.NormFloat64()),
+			Notes:   text("seed"),
+		})
+
+		prevTrigger = ateTrigger
+		prevLowSleep = duration < lowSleepHours
+	}
+
+	return data
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"terrahack2025-backend/database"
+)
+
+// loadSetting decodes the stored JSON value for key into dst. A missing
+// setting is not an error and leaves dst untouched, so callers can fill dst
+// with defaults first.
+func loadSetting(ctx context.Context, queries *database.Queries, key string, dst any) error {
+	setting, err := queries.GetSetting(ctx, key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(setting.Value, dst)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+)
+
+// Share links expire after this long unless the request asks otherwise, up
+// to the 90 days POST /share's binding allows
+const defaultShareExpiry = 7 * 24 * time.Hour
+
+// Weeks of average severity included in a shared view
+const shareTrendWeeks = 8
+
+type weekAverage struct {
+	WeekStart  string  `json:"week_start"`
+	Average    float64 `json:"average"`
+	DaysScored int     `json:"days_scored"`
+}
+
+// sharedAnalysis is what a share link shows. It only holds aggregates and
+// derived findings, never raw records or notes.
+type sharedAnalysis struct {
+	SymptomAverage float64         `json:"symptom_average"`
+	DaysScored     int             `json:"days_scored"`
+	Triggers       []rankedTrigger `json:"triggers"`
+	Trend          []weekAverage   `json:"trend"`
+	// Only the probability is shared, the predictions name dated entries.
+	// Null when there wasn't enough recent data to predict.
+	FlareupProbability *float64  `json:"flareup_probability"`
+	GeneratedAt        time.Time `json:"generated_at"`
+	Disclaimer         string    `json:"disclaimer"`
+}
+
+// buildSharedAnalysis computes the shared view with the default options.
+// Callers must check there is symptom data first.
+func buildSharedAnalysis(data analysisData, generatedAt time.Time) sharedAnalysis {
+	analysis := analyzeTriggers(data, defaultAnalysisOptions())
+	shared := sharedAnalysis{
+		SymptomAverage: analysis.Mean,
+		DaysScored:     len(analysis.ScoredDays),
+		Triggers:       analysis.rankTriggers(),
+		Trend:          []weekAverage{},
+		GeneratedAt:    generatedAt,
+		Disclaimer:     medicalDisclaimer,
+	}
+	if p := predictFlareups(data, analysis, flareupModels[flareupModelRatio]); p.Requirement == "" {
+		shared.FlareupProbability = &p.Probability
+	}
+	if shared.Triggers == nil {
+		shared.Triggers = []rankedTrigger{}
+	}
+
+	// Weeks end on the latest scored day
+	days := analysis.ScoredDays
+	if len(days) == 0 {
+		return shared
+	}
+	latest := days[len(days)-1].Date
+	for week := shareTrendWeeks - 1; week >= 0; week-- {
+		end := latest.AddDate(0, 0, -7*week)
+		start := end.AddDate(0, 0, -6)
+		var scores []float64
+		for _, d := range days {
+			if !d.Date.Before(start) && !d.Date.After(end) {
+				scores = append(scores, d.Score)
+			}
+		}
+		if len(scores) == 0 {
+			continue
+		}
+		mean, _ := meanStdDev(scores)
+		shared.Trend = append(shared.Trend, weekAverage{WeekStart: start.Format("2006-01-02"), Average: mean, DaysScored: len(scores)})
+	}
+	return shared
+}
+
+// newShareToken returns an unguessable URL-safe token
+func newShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import "sort"
+
+// Below this p-value a trigger is reported as significantly linked to spikes
+const significanceLevel = 0.05
+
+type significanceResult struct {
+	Test        string  `json:"test"`
+	PValue      float64 `json:"p_value"`
+	Significant bool    `json:"significant"`
+}
+
+// significance tests whether spikes follow a factor more often than chance
+func (a triggerAnalysis) significance(l factorLift) significanceResult {
+	// Every scored day after the first could have been a spike
+	p := spikeEnrichmentPValue(len(a.ScoredDays)-1, len(a.SpikeDays), l.DaysPresent, l.Spikes)
+	return significanceResult{
+		Test:        "fisher_exact_one_sided",
+		PValue:      p,
+		Significant: p < significanceLevel,
+	}
+}
+
+type significantTrigger struct {
+	rankedTrigger
+	PValue float64 `json:"p_value"`
+}
+
+// significantTriggers returns the ranked triggers whose link to spikes is
+// significant, strongest evidence first
+func (a triggerAnalysis) significantTriggers() []significantTrigger {
+	_, lifts := a.lifts()
+	var res []significantTrigger
+	for _, t := range a.rankTriggers() {
+		key := t.Type + ":" + t.Name
+		if t.Type == "low_sleep" {
+			key = "low_sleep"
+		}
+		if s := a.significance(lifts[key]); s.Significant {
+			res = append(res, significantTrigger{rankedTrigger: t, PValue: s.PValue})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].PValue < res[j].PValue })
+	return res
+}
+
+// significantCounts keeps only the counts of the significant triggers, so a
+// fallback for mode=significant doesn't bring the others back in
+func significantCounts(triggers triggerCounts, significant []significantTrigger) triggerCounts {
+	res := triggerCounts{
+		MenstrualEvent: map[string]int{},
+		FlowLevel:      map[string]int{},
+		FoodItems:      map[string]int{},
+		CustomFactors:  map[string]int{},
+	}
+	for _, t := range significant {
+		switch t.Type {
+		case "low_sleep":
+			res.LowSleepHours = triggers.LowSleepHours
+		case "food":
+			res.FoodItems[t.Name] = triggers.FoodItems[t.Name]
+		case "menstrual_event":
+			res.MenstrualEvent[t.Name] = triggers.MenstrualEvent[t.Name]
+		case "flow_level":
+			res.FlowLevel[t.Name] = triggers.FlowLevel[t.Name]
+		case "custom":
+			res.CustomFactors[t.Name] = triggers.CustomFactors[t.Name]
+		}
+	}
+	return res
+}
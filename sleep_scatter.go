@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	"terrahack2025-backend/database"
+)
+
+type sleepPoint struct {
+	Date     time.Time `json:"date"`
+	Duration float64   `json:"duration"`
+	Quality  int32     `json:"quality"`
+}
+
+type sleepScatter struct {
+	Points      []sleepPoint `json:"points"`
+	Correlation *float64     `json:"correlation"`
+	SampleSize  int          `json:"sample_size"`
+	// Fewer than the minimum entries leaves the correlation out
+	InsufficientData bool `json:"insufficient_data"`
+	MinEntries       int  `json:"min_entries"`
+}
+
+// sleepQualityScatter pairs each entry's duration with its quality rating,
+// skipping entries missing either, and correlates the two
+func sleepQualityScatter(sleep []database.Sleep, minEntries int) sleepScatter {
+	res := sleepScatter{Points: []sleepPoint{}, MinEntries: minEntries}
+	var durations, qualities []float64
+	for _, s := range sleep {
+		if !s.Duration.Valid || !s.Quality.Valid {
+			continue
+		}
+		res.Points = append(res.Points, sleepPoint{Date: s.Date.Time, Duration: s.Duration.Float64, Quality: s.Quality.Int32})
+		durations = append(durations, s.Duration.Float64)
+		qualities = append(qualities, float64(s.Quality.Int32))
+	}
+	res.SampleSize = len(res.Points)
+	if res.SampleSize < minEntries {
+		res.InsufficientData = true
+	} else if r, ok := pearson(durations, qualities); ok {
+		res.Correlation = &r
+	}
+	return res
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/genai"
+
+	"terrahack2025-backend/database"
+)
+
+// How often the background job checks whether the data changed since the
+// last snapshot
+const snapshotRefreshInterval = 5 * time.Minute
+
+// analysisSnapshot is the dashboard's precomputed view, built with the
+// default analysis options and the stored dietary restrictions
+type analysisSnapshot struct {
+	Triggers        []rankedTrigger   `json:"triggers"`
+	Prediction      flareupPrediction `json:"prediction"`
+	Recommendations []string          `json:"recommendations"`
+}
+
+func buildSnapshot(ctx context.Context, queries *database.Queries, client *genai.Client) (analysisSnapshot, error) {
+	snapshot := analysisSnapshot{Triggers: []rankedTrigger{}, Recommendations: []string{}}
+	data, err := loadAnalysisData(ctx, queries)
+	if err != nil {
+		return snapshot, err
+	}
+	if len(data.Symptoms) == 0 {
+		snapshot.Prediction = flareupPrediction{Message: "No symptom data found.", Requirement: requireSymptomEntry}
+		return snapshot, nil
+	}
+
+	var restrictionValues []string
+	if err := loadSetting(ctx, queries, "restrictions", &restrictionValues); err != nil {
+		return snapshot, err
+	}
+	restrictions, err := parseRestrictions(restrictionValues)
+	if err != nil {
+		return snapshot, err
+	}
+
+	analysis := analyzeTriggers(data, defaultAnalysisOptions())
+	snapshot.Triggers = analysis.rankTriggers()
+	snapshot.Prediction = predictFlareups(data, analysis, flareupModels[flareupModelRatio])
+
+	in := recommendationInput{
+		Count:        defaultRecommendationCount,
+		Restrictions: restrictions,
+		Analysis:     analysis,
+		Prompt:       buildRecommendationPrompt(data, analysis.Triggers, defaultRecommendationCount, restrictions),
+	}
+	// A Gemini outage shouldn't leave the dashboard without a snapshot
+	snapshot.Recommendations, err = generateRecommendations(ctx, client, in)
+	if err != nil {
+		slog.Warn("snapshot recommendations failed, using fallback", "error", err)
+		snapshot.Recommendations = fallbackRecommendations(analysis.Triggers, in.Count, restrictions)
+	}
+	return snapshot, nil
+}
+
+// dataVersion identifies the current logged data and settings by when
+// data_changes was last bumped, so a settings change such as new
+// restrictions marks the snapshot stale as well
+func dataVersion(ctx context.Context, queries *database.Queries) (string, error) {
+	changed, err := queries.GetLastDataChange(ctx)
+	if err != nil {
+		return "", err
+	}
+	return changed.Time.UTC().Format(time.RFC3339Nano), nil
+}
+
+// refreshSnapshot recomputes and stores the snapshot
+func refreshSnapshot(ctx context.Context, queries *database.Queries, client *genai.Client) (database.AnalysisSnapshot, error) {
+	// Read the version first, so a write landing mid-refresh marks the new
+	// snapshot stale instead of going unnoticed
+	version, err := dataVersion(ctx, queries)
+	if err != nil {
+		return database.AnalysisSnapshot{}, err
+	}
+	snapshot, err := buildSnapshot(ctx, queries, client)
+	if err != nil {
+		return database.AnalysisSnapshot{}, err
+	}
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return database.AnalysisSnapshot{}, err
+	}
+	return queries.UpsertAnalysisSnapshot(ctx, database.UpsertAnalysisSnapshotParams{
+		Data:        payload,
+		DataVersion: version,
+	})
+}
+
+func refreshSnapshotIfStale(ctx context.Context, queries *database.Queries, client *genai.Client) error {
+	version, err := dataVersion(ctx, queries)
+	if err != nil {
+		return err
+	}
+	current, err := queries.GetAnalysisSnapshot(ctx)
+	if err == nil && current.DataVersion == version {
+		return nil
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	_, err = refreshSnapshot(ctx, queries, client)
+	return err
+}
+
+// startSnapshotRefresh keeps the snapshot current in the background so
+// GET /snapshot never has to run the analysis itself
+func startSnapshotRefresh(ctx context.Context, queries *database.Queries, client *genai.Client) {
+	go func() {
+		ticker := time.NewTicker(snapshotRefreshInterval)
+		defer ticker.Stop()
+		for {
+			if err := refreshSnapshotIfStale(ctx, queries, client); err != nil {
+				slog.Error("snapshot refresh failed", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+type snapshotResponse struct {
+	Snapshot    json.RawMessage `json:"snapshot"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	// The logged data changed after the snapshot was computed
+	Stale bool `json:"stale"`
+}
+
+func newSnapshotResponse(s database.AnalysisSnapshot, currentVersion string) snapshotResponse {
+	return snapshotResponse{
+		Snapshot:    s.Data,
+		GeneratedAt: s.CreatedAt.Time,
+		Stale:       s.DataVersion != currentVersion,
+	}
+}
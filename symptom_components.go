@@ -0,0 +1,70 @@
+package main
+
+import (
+	"time"
+
+	"terrahack2025-backend/database"
+)
+
+// Longest date axis /symptom_components will build, about ten years
+const maxComponentDays = 3660
+
+// symptomComponents holds one series per symptom on a shared date axis.
+// Days without an entry are null; several entries on a day are averaged.
+type symptomComponents struct {
+	Dates   []string   `json:"dates"`
+	Nausea  []*float64 `json:"nausea"`
+	Fatigue []*float64 `json:"fatigue"`
+	Pain    []*float64 `json:"pain"`
+}
+
+// componentSeries lays the symptom entries out day by day from from to to,
+// both inclusive
+func componentSeries(symptoms []database.Symptom, from, to time.Time) symptomComponents {
+	type sums struct {
+		nausea, fatigue, pain    float64
+		nNausea, nFatigue, nPain int
+	}
+	byDate := map[string]*sums{}
+	for _, s := range symptoms {
+		date := s.Date.Time.Format("2006-01-02")
+		day := byDate[date]
+		if day == nil {
+			day = &sums{}
+			byDate[date] = day
+		}
+		if s.Nausea.Valid {
+			day.nausea += float64(s.Nausea.Int32)
+			day.nNausea++
+		}
+		if s.Fatigue.Valid {
+			day.fatigue += float64(s.Fatigue.Int32)
+			day.nFatigue++
+		}
+		if s.Pain.Valid {
+			day.pain += float64(s.Pain.Int32)
+			day.nPain++
+		}
+	}
+
+	mean := func(total float64, n int) *float64 {
+		if n == 0 {
+			return nil
+		}
+		v := total / float64(n)
+		return &v
+	}
+	res := symptomComponents{Dates: []string{}, Nausea: []*float64{}, Fatigue: []*float64{}, Pain: []*float64{}}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		res.Dates = append(res.Dates, date)
+		day := byDate[date]
+		if day == nil {
+			day = &sums{}
+		}
+		res.Nausea = append(res.Nausea, mean(day.nausea, day.nNausea))
+		res.Fatigue = append(res.Fatigue, mean(day.fatigue, day.nFatigue))
+		res.Pain = append(res.Pain, mean(day.pain, day.nPain))
+	}
+	return res
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"terrahack2025-backend/database"
+)
+
+// The user's default IANA timezone, e.g. "Pacific/Auckland", is stored as a
+// JSON string in the "timezone" setting
+const timezoneSetting = "timezone"
+
+// userLocation resolves the client's timezone from the X-Timezone header,
+// falling back to the timezone setting and then UTC. It responds itself and
+// returns false when the header or the database lookup fails.
+func userLocation(c *gin.Context, queries *database.Queries) (*time.Location, bool) {
+	tz := c.GetHeader("X-Timezone")
+	if tz == "" {
+		if err := loadSetting(c.Request.Context(), queries, timezoneSetting, &tz); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+	}
+	if tz == "" {
+		return time.UTC, true
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid timezone %q", tz)})
+		return nil, false
+	}
+	return loc, true
+}
+
+// userToday returns the current calendar date in the user's timezone (see
+// userLocation) as UTC midnight so it compares directly with stored dates.
+// Anything that defaults to "today" should use it rather than the server
+// clock, which is UTC.
+func userToday(c *gin.Context, queries *database.Queries) (time.Time, bool) {
+	loc, ok := userLocation(c, queries)
+	if !ok {
+		return time.Time{}, false
+	}
+	return dateIn(time.Now(), loc), true
+}
+
+// dateIn is the calendar date of t in loc, as UTC midnight
+func dateIn(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// validTimezoneSetting checks a timezone setting value before it is stored
+func validTimezoneSetting(value []byte) error {
+	var tz string
+	if err := json.Unmarshal(value, &tz); err != nil {
+		return fmt.Errorf("timezone must be a JSON string")
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("invalid timezone %q, expected an IANA name like \"Europe/London\"", tz)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"terrahack2025-backend/database"
+)
+
+// settingsDB serves GetSetting from a map of raw JSON values. Every other
+// query fails with err, or with an error naming the query.
+type settingsDB struct {
+	settings map[string]string
+	err      error
+}
+
+type settingRow struct {
+	key, value string
+	err        error
+}
+
+func (r settingRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*string) = r.key
+	*dest[1].(*[]byte) = []byte(r.value)
+	return nil
+}
+
+func (db settingsDB) QueryRow(_ context.Context, _ string, args ...any) pgx.Row {
+	if db.err != nil {
+		return settingRow{err: db.err}
+	}
+	key := args[0].(string)
+	value, ok := db.settings[key]
+	if !ok {
+		return settingRow{err: pgx.ErrNoRows}
+	}
+	return settingRow{key: key, value: value}
+}
+
+func (db settingsDB) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("settingsDB only serves settings")
+}
+
+func (db settingsDB) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, errors.New("settingsDB only serves settings")
+}
+
+func TestUserLocation(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		db      settingsDB
+		want    string
+		wantErr int
+	}{
+		{"header", "Pacific/Auckland", settingsDB{}, "Pacific/Auckland", 0},
+		{"header overrides setting", "Asia/Tokyo", settingsDB{settings: map[string]string{timezoneSetting: `"Europe/London"`}}, "Asia/Tokyo", 0},
+		{"setting", "", settingsDB{settings: map[string]string{timezoneSetting: `"Europe/London"`}}, "Europe/London", 0},
+		{"neither", "", settingsDB{}, "UTC", 0},
+		{"invalid header", "Mars/Olympus_Mons", settingsDB{}, "", http.StatusBadRequest},
+		{"invalid setting", "", settingsDB{settings: map[string]string{timezoneSetting: `"Nowhere"`}}, "", http.StatusBadRequest},
+		{"database error", "", settingsDB{err: errors.New("connection refused")}, "", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testContext("/day")
+			if tt.header != "" {
+				c.Request.Header.Set("X-Timezone", tt.header)
+			}
+			w := c.Writer
+
+			loc, ok := userLocation(c, database.New(tt.db))
+			if tt.wantErr != 0 {
+				if ok {
+					t.Fatalf("userLocation() = %v, want a %d response", loc, tt.wantErr)
+				}
+				if w.Status() != tt.wantErr {
+					t.Errorf("status = %d, want %d", w.Status(), tt.wantErr)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("userLocation() responded %d", w.Status())
+			}
+			if loc.String() != tt.want {
+				t.Errorf("userLocation() = %s, want %s", loc, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserToday(t *testing.T) {
+	c := testContext("/day")
+	c.Request.Header.Set("X-Timezone", "Pacific/Kiritimati")
+	loc, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := dateIn(time.Now(), loc)
+	got, ok := userToday(c, database.New(settingsDB{}))
+	after := dateIn(time.Now(), loc)
+	if !ok {
+		t.Fatal("userToday() failed")
+	}
+	if !got.Equal(before) && !got.Equal(after) {
+		t.Errorf("userToday() = %s, want today in Kiritimati, %s", got.Format("2006-01-02"), before.Format("2006-01-02"))
+	}
+	if got.Location() != time.UTC || got.Hour() != 0 {
+		t.Errorf("userToday() = %s, want UTC midnight", got)
+	}
+
+	c = testContext("/day")
+	c.Request.Header.Set("X-Timezone", "not a zone")
+	if _, ok := userToday(c, database.New(settingsDB{})); ok {
+		t.Error("userToday() accepted an invalid timezone")
+	}
+}
+
+func TestDateIn(t *testing.T) {
+	// 11:00 UTC is already tomorrow on Kiritimati (+14) and only just today
+	// on Pago Pago (-11), either side of the date line
+	instant := time.Date(2025, 7, 19, 11, 0, 0, 0, time.UTC)
+	tests := []struct {
+		zone string
+		want string
+	}{
+		{"UTC", "2025-07-19"},
+		{"Pacific/Kiritimati", "2025-07-20"},
+		{"Pacific/Pago_Pago", "2025-07-19"},
+		{"Pacific/Auckland", "2025-07-19"},
+		{"America/Los_Angeles", "2025-07-19"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := dateIn(instant, loc)
+			if got.Format("2006-01-02") != tt.want {
+				t.Errorf("dateIn(%s) = %s, want %s", tt.zone, got.Format("2006-01-02"), tt.want)
+			}
+			if got.Location() != time.UTC || got.Hour() != 0 {
+				t.Errorf("dateIn(%s) = %s, want UTC midnight", tt.zone, got)
+			}
+		})
+	}
+
+	// Just before midnight UTC on Auckland's clock is the next morning
+	late := time.Date(2025, 7, 19, 23, 30, 0, 0, time.UTC)
+	auckland, _ := time.LoadLocation("Pacific/Auckland")
+	if got := dateIn(late, auckland).Format("2006-01-02"); got != "2025-07-20" {
+		t.Errorf("dateIn(23:30Z, Auckland) = %s, want 2025-07-20", got)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"terrahack2025-backend/database"
+)
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// registerValidators reports fields by their JSON names and adds the custom
+// tags used on request structs
+func registerValidators() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	v.RegisterValidation("rfc3339", func(fl validator.FieldLevel) bool {
+		_, err := parseTimestamp(fl.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("meal", func(fl validator.FieldLevel) bool {
+		_, err := normalizeMeal(fl.Field().String())
+		return err == nil
+	})
+}
+
+const exampleTimestamp = "2025-07-19T08:00:00Z"
+
+// parseTimestamp parses an RFC3339 timestamp. When it doesn't parse, the
+// error says whether the format, a value's range or the timezone is wrong.
+func parseTimestamp(v string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	var parseErr *time.ParseError
+	if err == nil || !errors.As(err, &parseErr) {
+		return t, err
+	}
+	switch {
+	case strings.Contains(parseErr.Message, "time zone"):
+		return t, fmt.Errorf("has a timezone offset out of range, expected Z or an offset like +02:00, e.g. %s", exampleTimestamp)
+	case strings.Contains(parseErr.Message, "out of range"):
+		field := strings.TrimPrefix(parseErr.Message, ": ")
+		article := "a"
+		if strings.HasPrefix(field, "hour") {
+			article = "an"
+		}
+		return t, fmt.Errorf("has %s %s, e.g. %s", article, field, exampleTimestamp)
+	case parseErr.LayoutElem == "Z07:00" && parseErr.ValueElem == "":
+		return t, fmt.Errorf("is missing a timezone, end it with Z or an offset like +02:00, e.g. %s", exampleTimestamp)
+	case parseErr.LayoutElem == "Z07:00":
+		return t, fmt.Errorf("has an invalid timezone %q, expected Z or an offset like +02:00, e.g. %s", parseErr.ValueElem, exampleTimestamp)
+	case parseErr.LayoutElem == "T" && parseErr.ValueElem == "":
+		return t, fmt.Errorf("is missing the time, expected a full timestamp, e.g. %s", exampleTimestamp)
+	}
+	return t, fmt.Errorf("must be an RFC3339 timestamp, e.g. %s", exampleTimestamp)
+}
+
+// Logged timestamps are stored as the calendar date the user meant, never
+// the UTC date of the instant:
+//
+//   - With an explicit offset the date is read on that offset's clock, so
+//     2025-07-19T23:30:00-05:00 is stored as 2025-07-19.
+//   - Midnight UTC (2025-07-19T00:00:00Z) is how clients commonly send a
+//     bare date, so it is stored as that date.
+//   - Any other UTC timestamp is an instant, converted to the user's
+//     timezone (X-Timezone or the timezone setting) before taking its date,
+//     so 2025-07-20T02:00:00Z from New York is stored as 2025-07-19.
+//
+// calendarDate applies this policy to a timestamp t parsed from v, returning
+// the date as UTC midnight.
+func calendarDate(v string, t time.Time, loc *time.Location) time.Time {
+	if isUTCInstant(v, t) {
+		return dateIn(t, loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// isUTCInstant reports whether v is a UTC timestamp other than midnight,
+// the only kind whose date depends on the user's timezone
+func isUTCInstant(v string, t time.Time) bool {
+	utc := strings.HasSuffix(v, "Z") || strings.HasSuffix(v, "z")
+	return utc && !t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+}
+
+// checkRequestDate parses a timestamp field already read from the request
+// into the calendar date to store (see calendarDate), returning field
+// problems when it doesn't parse or falls after the user's today. It
+// responds itself and returns false only when the user's timezone can't be
+// resolved.
+func checkRequestDate(c *gin.Context, queries *database.Queries, field, v string) (time.Time, []fieldError, bool) {
+	t, err := parseTimestamp(v)
+	if err != nil {
+		return t, []fieldError{{Field: field, Message: err.Error()}}, true
+	}
+	loc, ok := userLocation(c, queries)
+	if !ok {
+		return t, nil, false
+	}
+	date := calendarDate(v, t, loc)
+	if today := dateIn(time.Now(), loc); date.After(today) {
+		msg := fmt.Sprintf("is in the future, expected %s or earlier", today.Format("2006-01-02"))
+		return date, []fieldError{{Field: field, Message: msg}}, true
+	}
+	return date, nil, true
+}
+
+// parseRequestDate is checkRequestDate for the insert routes, responding
+// 400 in the bindJSON shape when the date is invalid
+func parseRequestDate(c *gin.Context, queries *database.Queries, field, v string) (time.Time, bool) {
+	date, errs, ok := checkRequestDate(c, queries, field, v)
+	if !ok {
+		return date, false
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request body",
+			"errors": errs,
+		})
+		return date, false
+	}
+	return date, true
+}
+
+// bindJSON binds the request body and, on failure, responds 400 with every
+// field problem at once rather than just the first
+func bindJSON(c *gin.Context, req any) bool {
+	err := c.ShouldBindJSON(req)
+	if err == nil {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "invalid request body",
+		"errors": fieldErrors(err),
+	})
+	return false
+}
+
+// checkRequest runs the checks on req that its binding tags can't express,
+// responding 400 in the bindJSON shape when any fail
+func checkRequest(c *gin.Context, req entryRequest) bool {
+	errs := req.check()
+	if len(errs) == 0 {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "invalid request body",
+		"errors": errs,
+	})
+	return false
+}
+
+func fieldErrors(err error) []fieldError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		var res []fieldError
+		for _, fe := range validationErrs {
+			res = append(res, fieldError{Field: fe.Field(), Message: validationMessage(fe)})
+		}
+		return res
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []fieldError{{Field: typeErr.Field, Message: "must be " + jsonTypeName(typeErr.Type)}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return []fieldError{{Message: "malformed JSON"}}
+	}
+
+	return []fieldError{{Message: err.Error()}}
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "rfc3339":
+		if _, err := parseTimestamp(fmt.Sprint(fe.Value())); err != nil {
+			return err.Error()
+		}
+		return "must be an RFC3339 timestamp, e.g. " + exampleTimestamp
+	case "meal":
+		return "must be one of breakfast, lunch, dinner, snack"
+	case "min":
+		return "must be at least " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return "must be at most " + fe.Param() + " characters"
+		}
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	}
+	return fmt.Sprintf("failed %s validation", fe.Tag())
+}
+
+// jsonTypeName describes a Go type in JSON terms for error messages
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
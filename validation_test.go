@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMain registers the custom validation tags once, as main does before
+// serving
+func TestMain(m *testing.M) {
+	registerValidators()
+	os.Exit(m.Run())
+}
+
+func TestParseTimestampErrors(t *testing.T) {
+	tests := []struct {
+		v    string
+		want string
+	}{
+		{"2025-07-19T08:00:00Z", ""},
+		{"2025-07-19T08:00:00+02:00", ""},
+		{"yesterday", "must be an RFC3339 timestamp, e.g. " + exampleTimestamp},
+		{"", "must be an RFC3339 timestamp, e.g. " + exampleTimestamp},
+		{"2025-07-19", "is missing the time, expected a full timestamp, e.g. " + exampleTimestamp},
+		{"2025-13-19T08:00:00Z", "has a month out of range, e.g. " + exampleTimestamp},
+		{"2025-02-30T08:00:00Z", "has a day out of range, e.g. " + exampleTimestamp},
+		{"2025-07-19T25:00:00Z", "has an hour out of range, e.g. " + exampleTimestamp},
+		{"2025-07-19T08:00:00", "is missing a timezone, end it with Z or an offset like +02:00, e.g. " + exampleTimestamp},
+		{"2025-07-19T08:00:00PST", `has an invalid timezone "PST", expected Z or an offset like +02:00, e.g. ` + exampleTimestamp},
+		{"2025-07-19T08:00:00+0200", `has an invalid timezone "+0200", expected Z or an offset like +02:00, e.g. ` + exampleTimestamp},
+		{"2025-07-19T08:00:00+25:00", "has a timezone offset out of range, expected Z or an offset like +02:00, e.g. " + exampleTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.v, func(t *testing.T) {
+			_, err := parseTimestamp(tt.v)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("parseTimestamp(%q) = %v, want no error", tt.v, err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("parseTimestamp(%q) = %v, want %q", tt.v, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendarDate(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		v    string
+		loc  *time.Location
+		want string
+	}{
+		{"Z at midnight is a bare date", "2025-07-19T00:00:00Z", newYork, "2025-07-19"},
+		{"Z at midnight without a timezone", "2025-07-19T00:00:00Z", time.UTC, "2025-07-19"},
+		{"Z instant read in the user's timezone", "2025-07-20T02:00:00Z", newYork, "2025-07-19"},
+		{"Z instant without a timezone", "2025-07-20T02:00:00Z", time.UTC, "2025-07-20"},
+		{"+00:00 is an explicit offset", "2025-07-20T02:00:00+00:00", newYork, "2025-07-20"},
+		{"-05:00 late evening", "2025-07-19T23:30:00-05:00", time.UTC, "2025-07-19"},
+		{"-05:00 ignores the timezone setting", "2025-07-19T23:30:00-05:00", newYork, "2025-07-19"},
+		{"+14:00 early morning", "2025-07-20T00:30:00+14:00", time.UTC, "2025-07-20"},
+		{"+14:00 at midnight", "2025-07-20T00:00:00+14:00", newYork, "2025-07-20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseTimestamp(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := calendarDate(tt.v, parsed, tt.loc).Format("2006-01-02"); got != tt.want {
+				t.Errorf("calendarDate(%q) = %s, want %s", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImportDates(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseImport(importPayload{
+		Sleep: []importSleepRow{
+			{Date: "2025-07-19T00:00:00Z"},
+			{Date: "2025-07-20T02:00:00Z"},
+			{Date: "2025-07-19T23:30:00-05:00"},
+		},
+		Symptoms: []importSymptomsRow{{Date: "2025-07-20T00:30:00+14:00", Pain: int32Ptr(3)}},
+	}, newYork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"2025-07-19", "2025-07-19", "2025-07-19"} {
+		if got := p.Sleep[i].Date.Time.Format("2006-01-02"); got != want {
+			t.Errorf("sleep[%d] stored as %s, want %s", i, got, want)
+		}
+	}
+	if got := p.Symptoms[0].Date.Time.Format("2006-01-02"); got != "2025-07-20" {
+		t.Errorf("symptoms[0] stored as %s, want 2025-07-20", got)
+	}
+}
+
+func TestBindJSONReportsEveryField(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		body string
+		want []fieldError
+	}{
+		{
+			"every invalid field",
+			`{"date": "2025-07-19", "duration": 30, "quality": -1, "source": "fitbit"}`,
+			[]fieldError{
+				{Field: "date", Message: "is missing the time, expected a full timestamp, e.g. " + exampleTimestamp},
+				{Field: "duration", Message: "must be at most 24"},
+				{Field: "quality", Message: "must be at least 0"},
+				{Field: "source", Message: "must be one of manual, import, nlp"},
+			},
+		},
+		{
+			"missing required field",
+			`{"duration": 7}`,
+			[]fieldError{{Field: "date", Message: "is required"}},
+		},
+		{
+			"wrong JSON type",
+			`{"date": "2025-07-19T08:00:00Z", "quality": "good"}`,
+			[]fieldError{{Field: "quality", Message: "must be an integer"}},
+		},
+		{
+			"malformed JSON",
+			`{"date": }`,
+			[]fieldError{{Message: "malformed JSON"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/sleep", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			var req sleepRequest
+			if bindJSON(c, &req) {
+				t.Fatal("bindJSON accepted an invalid body")
+			}
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			var body struct {
+				Errors []fieldError `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(body.Errors, tt.want) {
+				t.Errorf("errors = %+v, want %+v", body.Errors, tt.want)
+			}
+		})
+	}
+}
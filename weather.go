@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"terrahack2025-backend/database"
+)
+
+// The weather integration is configured through the "weather" setting, e.g.
+//
+//	{"latitude": 51.5, "longitude": -0.12, "api_url": "https://archive-api.open-meteo.com/v1/archive", "api_key": "..."}
+//
+// api_url is any Open-Meteo compatible daily weather API and defaults to the
+// free archive. Without the setting the feature is disabled.
+const weatherSetting = "weather"
+
+const defaultWeatherAPIURL = "https://archive-api.open-meteo.com/v1/archive"
+
+// Weather is fetched at most this often, the stored days serve reads
+const weatherFetchInterval = 10 * time.Minute
+
+// One refresh backfills at most this many days
+const maxWeatherFetchDays = 366
+
+var errWeatherDisabled = errors.New("weather is not configured, set the weather setting with a latitude and longitude to enable it")
+
+type weatherConfig struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	APIURL    string   `json:"api_url"`
+	APIKey    string   `json:"api_key"`
+}
+
+func (w weatherConfig) validate() error {
+	if w.Latitude == nil || *w.Latitude < -90 || *w.Latitude > 90 {
+		return errors.New("invalid latitude, expected a number between -90 and 90")
+	}
+	if w.Longitude == nil || *w.Longitude < -180 || *w.Longitude > 180 {
+		return errors.New("invalid longitude, expected a number between -180 and 180")
+	}
+	if w.APIURL != "" {
+		u, err := url.Parse(w.APIURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.New("invalid api_url, expected an http or https URL")
+		}
+	}
+	return nil
+}
+
+// validWeatherSetting checks a value for the weather setting before it is
+// stored
+func validWeatherSetting(value []byte) error {
+	var w weatherConfig
+	if err := json.Unmarshal(value, &w); err != nil {
+		return errors.New("weather must be an object with latitude, longitude and optionally api_url and api_key")
+	}
+	return w.validate()
+}
+
+// redactWeatherSetting replaces the api_key in a stored weather setting so
+// reading the settings back doesn't hand out the key
+func redactWeatherSetting(value []byte) json.RawMessage {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(value, &m); err != nil {
+		return value
+	}
+	var key string
+	if json.Unmarshal(m["api_key"], &key) != nil || key == "" {
+		return value
+	}
+	m["api_key"] = json.RawMessage(`"redacted"`)
+	b, err := json.Marshal(m)
+	if err != nil {
+		return value
+	}
+	return b
+}
+
+// loadWeatherConfig returns errWeatherDisabled when the setting is missing
+func loadWeatherConfig(ctx context.Context, queries *database.Queries) (weatherConfig, error) {
+	var w weatherConfig
+	if err := loadSetting(ctx, queries, weatherSetting, &w); err != nil {
+		return w, err
+	}
+	if w.Latitude == nil || w.Longitude == nil {
+		return w, errWeatherDisabled
+	}
+	if w.APIURL == "" {
+		w.APIURL = defaultWeatherAPIURL
+	}
+	return w, nil
+}
+
+// weatherLimiter spaces out calls to the weather API
+type weatherLimiter struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// allow reports whether a fetch may start now and, if not, how long until
+// one can
+func (l *weatherLimiter) allow(now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if wait := l.last.Add(weatherFetchInterval).Sub(now); !l.last.IsZero() && wait > 0 {
+		return false, wait
+	}
+	l.last = now
+	return true, 0
+}
+
+var weatherHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// fetchWeather asks the API for the daily mean pressure and humidity from
+// from to to inclusive
+func fetchWeather(ctx context.Context, w weatherConfig, from, to time.Time) ([]database.UpsertWeatherParams, error) {
+	q := url.Values{}
+	q.Set("latitude", fmt.Sprint(*w.Latitude))
+	q.Set("longitude", fmt.Sprint(*w.Longitude))
+	q.Set("start_date", from.Format("2006-01-02"))
+	q.Set("end_date", to.Format("2006-01-02"))
+	q.Set("daily", "pressure_msl_mean,relative_humidity_2m_mean")
+	q.Set("timezone", "UTC")
+	if w.APIKey != "" {
+		q.Set("apikey", w.APIKey)
+	}
+
+	ctx, span := tracer.Start(ctx, "weather.fetch")
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.APIURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := weatherHTTPClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("weather API responded %s", resp.Status)
+	}
+
+	var body struct {
+		Daily struct {
+			Time     []string   `json:"time"`
+			Pressure []*float64 `json:"pressure_msl_mean"`
+			Humidity []*float64 `json:"relative_humidity_2m_mean"`
+		} `json:"daily"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("unreadable weather API response: %w", err)
+	}
+	d := body.Daily
+	if len(d.Pressure) != len(d.Time) || len(d.Humidity) != len(d.Time) {
+		return nil, errors.New("unreadable weather API response: daily series differ in length")
+	}
+
+	var days []database.UpsertWeatherParams
+	for i, v := range d.Time {
+		date, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return nil, fmt.Errorf("unreadable weather API response: %w", err)
+		}
+		days = append(days, database.UpsertWeatherParams{
+			Date:        pgtype.Date{Time: date, Valid: true},
+			PressureHpa: optionalFloat8(d.Pressure[i]),
+			HumidityPct: optionalFloat8(d.Humidity[i]),
+		})
+	}
+	return days, nil
+}
+
+func optionalFloat8(v *float64) pgtype.Float8 {
+	if v == nil {
+		return pgtype.Float8{}
+	}
+	return pgtype.Float8{Float64: *v, Valid: true}
+}
+
+// missingWeatherRange spans the scored days that have no stored weather yet,
+// capped to the most recent maxWeatherFetchDays. ok is false when nothing
+// is missing.
+func missingWeatherRange(days []scoredDay, stored []database.Weather) (from, to time.Time, ok bool) {
+	have := map[string]bool{}
+	for _, w := range stored {
+		// Days the API had no data for yet are tried again
+		if w.PressureHpa.Valid || w.HumidityPct.Valid {
+			have[w.Date.Time.Format("2006-01-02")] = true
+		}
+	}
+	for _, d := range days {
+		if have[d.Date.Format("2006-01-02")] {
+			continue
+		}
+		if !ok || d.Date.Before(from) {
+			from = d.Date
+		}
+		if !ok || d.Date.After(to) {
+			to = d.Date
+		}
+		ok = true
+	}
+	if ok && daysBetween(from, to) >= maxWeatherFetchDays {
+		from = to.AddDate(0, 0, 1-maxWeatherFetchDays)
+	}
+	return from, to, ok
+}
+
+type weatherCorrelation struct {
+	Factor      string   `json:"factor"`
+	Correlation *float64 `json:"correlation"`
+	SampleSize  int      `json:"sample_size"`
+	// Fewer than the minimum overlapping days leaves the correlation out
+	InsufficientData bool `json:"insufficient_data"`
+}
+
+// weatherImpact correlates each weather measure with the same day's symptom
+// score, skipping days without that measure. pressure_change is the change
+// from the previous day, for the common report of flares when pressure drops.
+func weatherImpact(days []scoredDay, weather []database.Weather, minOverlap int) []weatherCorrelation {
+	byDate := map[string]database.Weather{}
+	for _, w := range weather {
+		byDate[w.Date.Time.Format("2006-01-02")] = w
+	}
+	measures := []struct {
+		name  string
+		value func(date time.Time) (float64, bool)
+	}{
+		{"pressure_hpa", func(date time.Time) (float64, bool) {
+			w := byDate[date.Format("2006-01-02")]
+			return w.PressureHpa.Float64, w.PressureHpa.Valid
+		}},
+		{"humidity_pct", func(date time.Time) (float64, bool) {
+			w := byDate[date.Format("2006-01-02")]
+			return w.HumidityPct.Float64, w.HumidityPct.Valid
+		}},
+		{"pressure_change", func(date time.Time) (float64, bool) {
+			today := byDate[date.Format("2006-01-02")].PressureHpa
+			yesterday := byDate[date.AddDate(0, 0, -1).Format("2006-01-02")].PressureHpa
+			return today.Float64 - yesterday.Float64, today.Valid && yesterday.Valid
+		}},
+	}
+
+	var res []weatherCorrelation
+	for _, m := range measures {
+		var xs, ys []float64
+		for _, d := range days {
+			if v, ok := m.value(d.Date); ok {
+				xs = append(xs, v)
+				ys = append(ys, d.Score)
+			}
+		}
+		wc := weatherCorrelation{Factor: m.name, SampleSize: len(xs)}
+		if len(xs) < minOverlap {
+			wc.InsufficientData = true
+		} else if r, ok := pearson(xs, ys); ok {
+			wc.Correlation = &r
+		}
+		res = append(res, wc)
+	}
+	return res
+}
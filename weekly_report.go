@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"terrahack2025-backend/database"
+)
+
+// The weekly report is opted into through the "weekly_report" setting, e.g.
+//
+//	{"enabled": true, "email": "me@example.com", "weekday": "monday", "hour": 8, "timezone": "Europe/London"}
+//
+// The time of the last successful send is kept in the
+// "weekly_report_last_sent" setting so a restart doesn't send twice.
+
+const (
+	weeklyReportSetting         = "weekly_report"
+	weeklyReportLastSentSetting = "weekly_report_last_sent"
+
+	weeklyReportCheckInterval = 15 * time.Minute
+)
+
+type weeklyReportSettings struct {
+	Enabled  bool   `json:"enabled"`
+	Email    string `json:"email"`
+	Weekday  string `json:"weekday"`
+	Hour     int    `json:"hour"`
+	Timezone string `json:"timezone"`
+}
+
+func defaultWeeklyReportSettings() weeklyReportSettings {
+	return weeklyReportSettings{Weekday: "monday", Hour: 8, Timezone: "UTC"}
+}
+
+// smtpConfig is read from SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD
+// and SMTP_FROM, the password also from SMTP_PASSWORD_FILE. Without
+// SMTP_HOST no reports are sent.
+type smtpConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func smtpConfigFromEnv() smtpConfig {
+	cfg := smtpConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: envOrFile("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+	return cfg
+}
+
+func (cfg smtpConfig) send(to, subject, body string) error {
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	msg := "From: " + cfg.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+	return smtp.SendMail(net.JoinHostPort(cfg.Host, cfg.Port), auth, cfg.From, []string{to}, []byte(msg))
+}
+
+// lastScheduledTime returns the most recent scheduled send at or before now
+func (s weeklyReportSettings) lastScheduledTime(now time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+	weekday := -1
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), s.Weekday) {
+			weekday = int(d)
+		}
+	}
+	if weekday < 0 {
+		return time.Time{}, fmt.Errorf("invalid weekday %q", s.Weekday)
+	}
+	if s.Hour < 0 || s.Hour > 23 {
+		return time.Time{}, fmt.Errorf("invalid hour %d", s.Hour)
+	}
+
+	local := now.In(loc)
+	scheduled := time.Date(local.Year(), local.Month(), local.Day(), s.Hour, 0, 0, 0, loc)
+	scheduled = scheduled.AddDate(0, 0, -((int(local.Weekday()) - weekday + 7) % 7))
+	if scheduled.After(now) {
+		scheduled = scheduled.AddDate(0, 0, -7)
+	}
+	return scheduled, nil
+}
+
+// startWeeklyReports checks on an interval whether the weekly report is due
+// and sends it. It returns immediately when email isn't configured.
+func startWeeklyReports(ctx context.Context, queries *database.Queries, mail smtpConfig) {
+	if mail.Host == "" {
+		slog.Info("weekly reports disabled, SMTP_HOST is not set")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(weeklyReportCheckInterval)
+		defer ticker.Stop()
+		for {
+			if err := sendWeeklyReportIfDue(ctx, queries, mail, time.Now()); err != nil {
+				slog.Error("weekly report failed", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func sendWeeklyReportIfDue(ctx context.Context, queries *database.Queries, mail smtpConfig, now time.Time) error {
+	settings := defaultWeeklyReportSettings()
+	if err := loadSetting(ctx, queries, weeklyReportSetting, &settings); err != nil {
+		return err
+	}
+	if !settings.Enabled || settings.Email == "" {
+		return nil
+	}
+	scheduled, err := settings.lastScheduledTime(now)
+	if err != nil {
+		return err
+	}
+
+	var lastSent time.Time
+	if err := loadSetting(ctx, queries, weeklyReportLastSentSetting, &lastSent); err != nil {
+		return err
+	}
+	if !lastSent.Before(scheduled) {
+		return nil
+	}
+
+	// The report covers the seven days before the scheduled local date
+	end := time.Date(scheduled.Year(), scheduled.Month(), scheduled.Day(), 0, 0, 0, 0, time.UTC)
+	body, err := buildWeeklyReport(ctx, queries, end)
+	if err != nil {
+		return err
+	}
+	subject := "Your weekly symptom report, week ending " + end.AddDate(0, 0, -1).Format("2 Jan 2006")
+	if err := mail.send(settings.Email, subject, body); err != nil {
+		return err
+	}
+
+	sentAt, err := json.Marshal(now.UTC())
+	if err != nil {
+		return err
+	}
+	if _, err := queries.UpsertSetting(ctx, database.UpsertSettingParams{Key: weeklyReportLastSentSetting, Value: sentAt}); err != nil {
+		return err
+	}
+	slog.Info("weekly report sent", "week_start", end.AddDate(0, 0, -7).Format("2006-01-02"))
+	return nil
+}
+
+// buildWeeklyReport summarizes the seven days before end as plain text
+func buildWeeklyReport(ctx context.Context, queries *database.Queries, end time.Time) (string, error) {
+	start := end.AddDate(0, 0, -7)
+	inWeek := func(t time.Time) bool { return !t.Before(start) && t.Before(end) }
+
+	scoredDays, err := loadDailyScores(ctx, queries, aggregateMean, nil)
+	if err != nil {
+		return "", err
+	}
+	dietData, err := queries.GetAllDiet(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Week of %s to %s\n\n", start.Format("2 Jan"), end.AddDate(0, 0, -1).Format("2 Jan 2006"))
+
+	var scores []float64
+	var worst scoredDay
+	for _, d := range scoredDays {
+		if !inWeek(d.Date) {
+			continue
+		}
+		scores = append(scores, d.Score)
+		if d.Score > worst.Score {
+			worst = d
+		}
+	}
+	if len(scores) == 0 {
+		b.WriteString("No symptoms were logged this week.\n")
+	} else {
+		mean, _ := meanStdDev(scores)
+		fmt.Fprintf(&b, "Days with symptoms logged: %d of 7\n", len(scores))
+		fmt.Fprintf(&b, "Average severity: %.1f / 10\n", mean)
+		if !worst.Date.IsZero() {
+			fmt.Fprintf(&b, "Worst day: %s (%.1f)\n", worst.Date.Format("Monday 2 Jan"), worst.Score)
+		}
+	}
+
+	foods := map[string]int{}
+	for _, d := range dietData {
+		if inWeek(d.Date.Time) {
+			for _, item := range d.Items {
+				foods[item]++
+			}
+		}
+	}
+	if len(foods) > 0 {
+		var items []string
+		for item := range foods {
+			items = append(items, item)
+		}
+		sort.Slice(items, func(i, j int) bool {
+			if foods[items[i]] != foods[items[j]] {
+				return foods[items[i]] > foods[items[j]]
+			}
+			return items[i] < items[j]
+		})
+		if len(items) > 5 {
+			items = items[:5]
+		}
+		fmt.Fprintf(&b, "Most logged foods: %s\n", strings.Join(items, ", "))
+	}
+
+	b.WriteString("\n" + medicalDisclaimer + "\n")
+	return b.String(), nil
+}
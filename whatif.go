@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const whatIfNote = "A correlational estimate from your own logs, not a guarantee. It assumes the extra spikes seen after this trigger were caused by it, which may not be true."
+
+// whatIfResult estimates how many past spikes might not have happened
+// without a trigger. Spikes after the trigger above the usual rate are
+// attributed to it, so with lift L only (L-1)/L of them count as avoidable.
+type whatIfResult struct {
+	Remove string `json:"remove"`
+	// The factors removed, in the "low_sleep", "food:x" form
+	Factors     []string `json:"factors"`
+	TotalSpikes int      `json:"total_spikes"`
+	// Spikes any of the factors was logged the day before, an upper bound
+	SpikesPreceded         int     `json:"spikes_preceded"`
+	Lift                   float64 `json:"lift"`
+	EstimatedSpikesAvoided float64 `json:"estimated_spikes_avoided"`
+	EstimatedShareAvoided  float64 `json:"estimated_share_avoided"`
+	UpperBoundShare        float64 `json:"upper_bound_share"`
+	Estimate               bool    `json:"estimate"`
+	Note                   string  `json:"note"`
+}
+
+// whatIfFactors resolves remove into trigger factors. It takes a factor in
+// its prefixed form ("low_sleep", "flow_level:heavy", "custom:x"), a food
+// item, or a food category covering every logged item in it.
+func whatIfFactors(remove string, logged map[string]factorLift, categories map[string]string) ([]string, error) {
+	remove = strings.TrimSpace(remove)
+	if remove == "low_sleep" {
+		return []string{remove}, nil
+	}
+	for _, prefix := range []string{"food:", "menstrual_event:", "flow_level:", "custom:"} {
+		if name, ok := strings.CutPrefix(remove, prefix); ok {
+			if prefix == "food:" || prefix == "custom:" {
+				name = normalizeItem(name)
+			}
+			return []string{prefix + name}, nil
+		}
+	}
+
+	item := normalizeItem(remove)
+	if _, ok := logged["food:"+item]; ok {
+		return []string{"food:" + item}, nil
+	}
+	var factors []string
+	for factor := range logged {
+		if name, ok := strings.CutPrefix(factor, "food:"); ok && categories[name] == item {
+			factors = append(factors, factor)
+		}
+	}
+	if len(factors) == 0 {
+		return nil, fmt.Errorf("no logged food or food category named %q, prefix other triggers like low_sleep, flow_level:heavy or custom:name", remove)
+	}
+	sort.Strings(factors)
+	return factors, nil
+}
+
+// whatIf estimates the spikes that removing every one of factors might
+// have avoided
+func (a triggerAnalysis) whatIf(remove string, factors []string) whatIfResult {
+	res := whatIfResult{Remove: remove, Factors: factors, TotalSpikes: len(a.SpikeDays), Estimate: true, Note: whatIfNote}
+
+	var days, present int
+	for i := 1; i < len(a.ScoredDays); i++ {
+		days++
+		before := a.ByDate.factors(a.ScoredDays[i].Date.AddDate(0, 0, -1).Format("2006-01-02"))
+		hit := false
+		for _, f := range factors {
+			hit = hit || before[f]
+		}
+		if !hit {
+			continue
+		}
+		present++
+		if _, spike := a.SpikeDays[a.ScoredDays[i].Date.Format("2006-01-02")]; spike {
+			res.SpikesPreceded++
+		}
+	}
+	if present == 0 || res.TotalSpikes == 0 {
+		return res
+	}
+
+	baseRate := float64(res.TotalSpikes) / float64(days)
+	res.Lift = (float64(res.SpikesPreceded) / float64(present)) / baseRate
+	if res.Lift > 1 {
+		res.EstimatedSpikesAvoided = float64(res.SpikesPreceded) * (res.Lift - 1) / res.Lift
+	}
+	res.EstimatedShareAvoided = res.EstimatedSpikesAvoided / float64(res.TotalSpikes)
+	res.UpperBoundShare = float64(res.SpikesPreceded) / float64(res.TotalSpikes)
+	return res
+}
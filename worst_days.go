@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	defaultWorstDaysLimit = 10
+	maxWorstDaysLimit     = 100
+)
+
+// worstDay is a high-severity day with the factors logged around it, in the
+// same "low_sleep", "food:x" form the trigger analysis counts
+type worstDay struct {
+	Date             string   `json:"date"`
+	Score            float64  `json:"score"`
+	Spike            bool     `json:"spike"`
+	FactorsSameDay   []string `json:"factors_same_day"`
+	FactorsDayBefore []string `json:"factors_day_before"`
+}
+
+// worstDays returns the limit highest-scoring days, most severe first and
+// earliest first on ties
+func (a triggerAnalysis) worstDays(limit int) []worstDay {
+	days := make([]scoredDay, len(a.ScoredDays))
+	copy(days, a.ScoredDays)
+	sort.SliceStable(days, func(i, j int) bool {
+		if days[i].Score != days[j].Score {
+			return days[i].Score > days[j].Score
+		}
+		return days[i].Date.Before(days[j].Date)
+	})
+	if len(days) > limit {
+		days = days[:limit]
+	}
+
+	res := make([]worstDay, 0, len(days))
+	for _, d := range days {
+		key := d.Date.Format("2006-01-02")
+		_, spike := a.SpikeDays[key]
+		res = append(res, worstDay{
+			Date:             key,
+			Score:            d.Score,
+			Spike:            spike,
+			FactorsSameDay:   sortedFactors(a.ByDate, d.Date),
+			FactorsDayBefore: sortedFactors(a.ByDate, d.Date.AddDate(0, 0, -1)),
+		})
+	}
+	return res
+}
+
+func sortedFactors(byDate dailyData, date time.Time) []string {
+	factors := []string{}
+	for factor := range byDate.factors(date.Format("2006-01-02")) {
+		factors = append(factors, factor)
+	}
+	sort.Strings(factors)
+	return factors
+}